@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+const (
+	defaultSegmentSize = 16 * 1024 * 1024
+	defaultSegmentAge  = 5 * time.Minute
+	// the range from which a server ID is picked when none is given, well clear of those usually
+	// given to servers
+	minRandomServerID = 1 << 24
+	maxRandomServerID = 1 << 31
+)
+
+func binlogCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:   "binlog",
+		Short: "archive the binary log",
+		Long: `Archive the binary log of a database server, for point-in-time recovery from a dump.
+		Connects to the server as a replica, and streams its binary log to the targets, in segments, each of which is
+		compressed, and optionally encrypted, like a dump. A segment is completed at the end of each binary log file,
+		and when it reaches the segment size or age. Runs until stopped, or, with --once, until it reaches the current
+		end of the binary log. Resumes from the end of the last segment archived to the targets.
+		Requires binary logging to be enabled on the server, and the REPLICATION SLAVE and REPLICATION CLIENT privileges.
+		`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("starting binlog")
+			// check targets
+			targetURLs := v.GetStringSlice("target")
+			var (
+				targets []storage.Storage
+				err     error
+			)
+			if len(targetURLs) > 0 {
+				for _, t := range targetURLs {
+					store, err := storage.ParseURL(t, cmdConfig.creds)
+					if err != nil {
+						return fmt.Errorf("invalid target url: %v", err)
+					}
+					targets = append(targets, store)
+				}
+			} else {
+				// try the config file
+				if cmdConfig.configuration != nil {
+					// parse the target objects, then the ones listed for the backup
+					targetStructures := cmdConfig.configuration.Targets
+					dumpTargets := cmdConfig.configuration.Dump.Targets
+					for _, t := range dumpTargets {
+						var store storage.Storage
+						if target, ok := targetStructures[t]; !ok {
+							return fmt.Errorf("target %s from dump configuration not found in targets configuration", t)
+						} else {
+							store, err = target.Storage.Storage()
+							if err != nil {
+								return fmt.Errorf("target %s from dump configuration has invalid URL: %v", t, err)
+							}
+						}
+						targets = append(targets, store)
+					}
+				}
+			}
+			if len(targets) == 0 {
+				return fmt.Errorf("no targets specified")
+			}
+			safechars := v.GetBool("safechars")
+			if !v.IsSet("safechars") && cmdConfig.configuration != nil {
+				safechars = cmdConfig.configuration.Dump.Safechars
+			}
+			serverID := v.GetUint32("server-id")
+			if !v.IsSet("server-id") && cmdConfig.configuration != nil {
+				serverID = cmdConfig.configuration.Binlog.ServerID
+			}
+			if serverID == 0 {
+				serverID = uint32(minRandomServerID + rand.Int63n(maxRandomServerID-minRandomServerID))
+				log.Debugf("reading binary log with server ID %d", serverID)
+			}
+			start := binlog.Position{File: v.GetString("start-file"), Pos: v.GetUint64("start-position")}
+			if start.File == "" && start.Pos != 0 {
+				return fmt.Errorf("start-position requires start-file")
+			}
+			if start.File != "" && start.Pos == 0 {
+				// the first event of every binary log file follows its magic number
+				start.Pos = uint64(len(binlog.Magic))
+			}
+			segmentSize := v.GetInt64("segment-size")
+			if !v.IsSet("segment-size") && cmdConfig.configuration != nil && cmdConfig.configuration.Binlog.SegmentSize != 0 {
+				segmentSize = cmdConfig.configuration.Binlog.SegmentSize
+			}
+			segmentAge := v.GetDuration("segment-age")
+			if !v.IsSet("segment-age") && cmdConfig.configuration != nil && cmdConfig.configuration.Binlog.SegmentAge != "" {
+				if segmentAge, err = time.ParseDuration(cmdConfig.configuration.Binlog.SegmentAge); err != nil {
+					return fmt.Errorf("invalid segment-age in configuration: %v", err)
+				}
+			}
+			if segmentSize < 0 || segmentAge < 0 {
+				return fmt.Errorf("segment-size and segment-age must not be negative")
+			}
+			once := v.GetBool("once")
+
+			// compression algorithm: check config, then CLI/env var overrides
+			compressionAlgo := v.GetString("compression")
+			if !v.IsSet("compression") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.Compression != "" {
+				compressionAlgo = cmdConfig.configuration.Dump.Compression
+			}
+			compressionLevel := v.GetInt("compression-level")
+			if !v.IsSet("compression-level") && cmdConfig.configuration != nil {
+				compressionLevel = cmdConfig.configuration.Dump.CompressionLevel
+			}
+			compressor, err := compression.GetCompressor(compressionAlgo, compressionLevel)
+			if err != nil {
+				return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+			}
+			// encryption: check config, then CLI/env var overrides
+			encryption := v.GetString("encryption")
+			if !v.IsSet("encryption") && cmdConfig.configuration != nil {
+				encryption = cmdConfig.configuration.Dump.Encryption.Type
+			}
+			encryptionKey := v.GetString("encryption-key")
+			if !v.IsSet("encryption-key") && cmdConfig.configuration != nil {
+				encryptionKey = cmdConfig.configuration.Dump.Encryption.Key
+			}
+			var encryptor encrypt.Encryptor
+			switch {
+			case encryption == "" && encryptionKey == "":
+			case encryption == "":
+				return fmt.Errorf("encryption key %s provided without an encryption type", encryptionKey)
+			case encryptionKey == "":
+				return fmt.Errorf("encryption %s requires an encryption key", encryption)
+			default:
+				key, err := os.ReadFile(encryptionKey)
+				if err != nil {
+					return fmt.Errorf("failed to read encryption key: %v", err)
+				}
+				if encryptor, err = encrypt.GetEncryptor(encryption, key); err != nil {
+					return fmt.Errorf("failure to get encryption '%s': %v", encryption, err)
+				}
+			}
+			binlogOpts := core.BinlogOptions{
+				Targets:     targets,
+				Safechars:   safechars,
+				DBConn:      cmdConfig.dbconn,
+				Compressor:  compressor,
+				Encryptor:   encryptor,
+				ServerID:    serverID,
+				Start:       start,
+				SegmentSize: segmentSize,
+				SegmentAge:  segmentAge,
+				Once:        once,
+			}
+
+			archive := core.Binlog
+			if execs != nil {
+				archive = execs.binlog
+			}
+			// at this point, any errors should not have usage
+			cmd.SilenceUsage = true
+			// stop cleanly, archiving what has been read, when the container is stopped
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := archive(ctx, binlogOpts); err != nil {
+				return fmt.Errorf("error archiving binary log: %w", err)
+			}
+			log.Info("Binary log archiving complete")
+			return nil
+		},
+	}
+
+	v = viper.New()
+	v.SetEnvPrefix("db_binlog")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	// target - where the binary log is to be saved
+	flags.StringSlice("target", []string{}, "full URL target to where the binary log should be archived. Should be a directory, usually that of the dumps, so it is pruned with them. Accepts multiple targets. Supports the same formats as for dump.")
+
+	// server ID
+	flags.Uint32("server-id", 0, "Server ID with which to connect as a replica. Must differ from that of the server and of any of its replicas. 0 means to pick one at random.")
+
+	// start
+	flags.String("start-file", "", "Binary log file from which to start archiving. If blank, archiving resumes from the end of the last segment archived to the targets, or, if there are none, starts from the current position of the server.")
+	flags.Uint64("start-position", 0, "Position in `--start-file` from which to start archiving. 0 means from the start of the file.")
+
+	// segments
+	flags.Int64("segment-size", defaultSegmentSize, "Size in bytes at which to complete a segment and archive it. 0 means no limit, i.e. a segment for each binary log file.")
+	flags.Duration("segment-age", defaultSegmentAge, "Age at which to complete a segment and archive it, e.g. `5m`, which bounds how much of the binary log can be lost with the server. 0 means no limit.")
+
+	// once
+	flags.Bool("once", false, "Archive up to the current end of the binary log and exit, rather than waiting for more. Useful if you use an external scheduler.")
+
+	// safechars
+	flags.Bool("safechars", false, "The segment filename usually includes the character `:` in the date, to comply with RFC3339. Some systems and shells don't like that character. If true, will replace all `:` with `-`.")
+
+	// compression
+	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`, `zstd`, `xz`, `lz4`, `none`")
+	flags.Int("compression-level", 0, "Compression level to use, within the range supported by the compression. 0 means to use the default level.")
+
+	// encryption
+	flags.String("encryption", "", "Encryption to use. Supported are: `age`, `pgp`. Requires `--encryption-key`.")
+	flags.String("encryption-key", "", "File with the keys to encrypt to: for `age`, a recipients file, with one recipient per line; for `pgp`, one or more public keys.")
+
+	return cmd, nil
+}
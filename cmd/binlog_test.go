@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/file"
+	"github.com/go-test/deep"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBinlogCmd(t *testing.T) {
+	t.Parallel()
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+
+	tests := []struct {
+		name                  string
+		args                  []string // "binlog" will be prepended automatically
+		wantErr               bool
+		expectedBinlogOptions core.BinlogOptions
+	}{
+		{"missing target", []string{"--server", "abc", "--server-id", "100"}, true, core.BinlogOptions{}},
+		{"invalid target URL", []string{"--server", "abc", "--target", "def", "--server-id", "100"}, true, core.BinlogOptions{}},
+		{"file URL", []string{"--server", "abc", "--target", fileTarget, "--server-id", "100"}, false, core.BinlogOptions{
+			Targets:     []storage.Storage{file.New(*fileTargetURL)},
+			Compressor:  &compression.GzipCompressor{},
+			DBConn:      database.Connection{Host: "abc", Port: defaultPort},
+			ServerID:    100,
+			SegmentSize: defaultSegmentSize,
+			SegmentAge:  defaultSegmentAge,
+		}},
+		{"start and segments", []string{"--server", "abc", "--target", fileTarget, "--server-id", "100", "--start-file", "binlog.000002", "--segment-size", "0", "--segment-age", "1h", "--once"}, false, core.BinlogOptions{
+			Targets:    []storage.Storage{file.New(*fileTargetURL)},
+			Compressor: &compression.GzipCompressor{},
+			DBConn:     database.Connection{Host: "abc", Port: defaultPort},
+			ServerID:   100,
+			Start:      binlog.Position{File: "binlog.000002", Pos: 4},
+			SegmentAge: time.Hour,
+			Once:       true,
+		}},
+		{"start position without file", []string{"--server", "abc", "--target", fileTarget, "--server-id", "100", "--start-position", "1000"}, true, core.BinlogOptions{}},
+		{"negative segment age", []string{"--server", "abc", "--target", fileTarget, "--server-id", "100", "--segment-age", "-1m"}, true, core.BinlogOptions{}},
+		{"config file", []string{"--config-file", "testdata/config.yml", "--server-id", "100"}, false, core.BinlogOptions{
+			Targets:     []storage.Storage{file.New(*fileTargetURL)},
+			Compressor:  &compression.GzipCompressor{},
+			DBConn:      database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			ServerID:    100,
+			SegmentSize: defaultSegmentSize,
+			SegmentAge:  defaultSegmentAge,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("binlog", mock.MatchedBy(func(binlogOpts core.BinlogOptions) bool {
+				diff := deep.Equal(binlogOpts, tt.expectedBinlogOptions)
+				if diff == nil {
+					return true
+				}
+				t.Errorf("binlogOpts compare failed: %v", diff)
+				return false
+			})).Return(nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetArgs(append([]string{"binlog"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+		})
+	}
+}
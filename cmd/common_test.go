@@ -1,10 +1,9 @@
 package cmd
 
 import (
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"context"
+
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -22,15 +21,40 @@ func (m *mockExecs) dump(opts core.DumpOptions) error {
 	return args.Error(0)
 }
 
-func (m *mockExecs) restore(target storage.Storage, targetFile string, dbconn database.Connection, databasesMap map[string]string, compressor compression.Compressor) error {
-	args := m.Called(target, targetFile, dbconn, databasesMap, compressor)
+func (m *mockExecs) restore(opts core.RestoreOptions) error {
+	args := m.Called(opts)
 	return args.Error(0)
 }
 
-func (m *mockExecs) prune(opts core.PruneOptions) error {
+func (m *mockExecs) drill(opts core.DrillOptions) (*core.DrillReport, error) {
+	args := m.Called(opts)
+	report, _ := args.Get(0).(*core.DrillReport)
+	return report, args.Error(1)
+}
+
+func (m *mockExecs) prune(opts core.PruneOptions) (*core.PruneResult, error) {
+	args := m.Called(opts)
+	result, _ := args.Get(0).(*core.PruneResult)
+	return result, args.Error(1)
+}
+
+func (m *mockExecs) list(opts core.ListOptions) ([]core.Backup, error) {
+	args := m.Called(opts)
+	backups, _ := args.Get(0).([]core.Backup)
+	return backups, args.Error(1)
+}
+
+func (m *mockExecs) verify(opts core.VerifyOptions) (*core.VerifyResult, error) {
+	args := m.Called(opts)
+	result, _ := args.Get(0).(*core.VerifyResult)
+	return result, args.Error(1)
+}
+
+func (m *mockExecs) binlog(ctx context.Context, opts core.BinlogOptions) error {
 	args := m.Called(opts)
 	return args.Error(0)
 }
+
 func (m *mockExecs) timer(timerOpts core.TimerOptions, cmd func() error) error {
 	args := m.Called(timerOpts)
 	err := args.Error(0)
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -10,6 +12,10 @@ import (
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 )
 
@@ -18,6 +24,7 @@ const (
 	defaultBegin            = "+0"
 	defaultFrequency        = 1440
 	defaultMaxAllowedPacket = 4194304
+	defaultParallelism      = 1
 )
 
 func dumpCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
@@ -95,6 +102,30 @@ func dumpCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
 			if len(exclude) == 0 {
 				exclude = nil
 			}
+			includeTables := v.GetStringSlice("include-table")
+			if len(includeTables) == 0 && cmdConfig.configuration != nil {
+				includeTables = cmdConfig.configuration.Dump.IncludeTables
+			}
+			excludeTables := v.GetStringSlice("exclude-table")
+			if len(excludeTables) == 0 && cmdConfig.configuration != nil {
+				excludeTables = cmdConfig.configuration.Dump.ExcludeTables
+			}
+			includeTables, excludeTables = nonEmpty(includeTables), nonEmpty(excludeTables)
+			if _, err := database.NewTableFilter(includeTables, excludeTables); err != nil {
+				return err
+			}
+			rowFilters, err := dumpRowFilters(cmd, cmdConfig)
+			if err != nil {
+				return err
+			}
+			masks, err := dumpMasks(cmd, cmdConfig)
+			if err != nil {
+				return err
+			}
+			maskSalt := v.GetString("mask-salt")
+			if maskSalt == "" && cmdConfig.configuration != nil {
+				maskSalt = cmdConfig.configuration.Dump.Masking.Salt
+			}
 			preBackupScripts := v.GetString("pre-backup-scripts")
 			if preBackupScripts == "" && cmdConfig.configuration != nil {
 				preBackupScripts = cmdConfig.configuration.Dump.Scripts.PreBackup
@@ -107,10 +138,59 @@ func dumpCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
 			if !v.IsSet("compact") && cmdConfig.configuration != nil {
 				compact = cmdConfig.configuration.Dump.Compact
 			}
+			noData := v.GetBool("no-data")
+			if !v.IsSet("no-data") && cmdConfig.configuration != nil {
+				noData = cmdConfig.configuration.Dump.NoData
+			}
+			noCreateInfo := v.GetBool("no-create-info")
+			if !v.IsSet("no-create-info") && cmdConfig.configuration != nil {
+				noCreateInfo = cmdConfig.configuration.Dump.NoCreateInfo
+			}
+			if noData && noCreateInfo {
+				return fmt.Errorf("no-data and no-create-info cannot be used together, as there would be no tables to dump")
+			}
+			noDataTables := v.GetStringSlice("no-data-table")
+			if len(noDataTables) == 0 && cmdConfig.configuration != nil {
+				noDataTables = cmdConfig.configuration.Dump.NoDataTables
+			}
+			noDataTables = nonEmpty(noDataTables)
+			if _, err := database.NewTableFilter(nil, noDataTables); err != nil {
+				return err
+			}
 			maxAllowedPacket := v.GetInt("max-allowed-packet")
 			if !v.IsSet("max-allowed-packet") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.MaxAllowedPacket != 0 {
 				maxAllowedPacket = cmdConfig.configuration.Dump.MaxAllowedPacket
 			}
+			triggers := v.GetBool("triggers")
+			if !v.IsSet("triggers") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.Triggers != nil {
+				triggers = *cmdConfig.configuration.Dump.Triggers
+			}
+			routines := v.GetBool("routines")
+			if !v.IsSet("routines") && cmdConfig.configuration != nil {
+				routines = cmdConfig.configuration.Dump.Routines
+			}
+			events := v.GetBool("events")
+			if !v.IsSet("events") && cmdConfig.configuration != nil {
+				events = cmdConfig.configuration.Dump.Events
+			}
+			parallelism := v.GetInt("parallelism")
+			if !v.IsSet("parallelism") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.Parallelism != 0 {
+				parallelism = cmdConfig.configuration.Dump.Parallelism
+			}
+			if parallelism < 1 {
+				return fmt.Errorf("parallelism must be at least 1, not %d", parallelism)
+			}
+			sourceData := v.GetInt("source-data")
+			if !v.IsSet("source-data") && cmdConfig.configuration != nil {
+				sourceData = cmdConfig.configuration.Dump.SourceData
+			}
+			if sourceData < mysql.SourceDataNone || sourceData > mysql.SourceDataComment {
+				return fmt.Errorf("source-data must be %d, %d or %d, not %d", mysql.SourceDataNone, mysql.SourceDataStatement, mysql.SourceDataComment, sourceData)
+			}
+			streaming := v.GetBool("streaming")
+			if !v.IsSet("streaming") && cmdConfig.configuration != nil {
+				streaming = cmdConfig.configuration.Dump.Streaming
+			}
 
 			// compression algorithm: check config, then CLI/env var overrides
 			var (
@@ -124,24 +204,68 @@ func dumpCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
 			if compressionVar != "" {
 				compressionAlgo = compressionVar
 			}
+			compressionLevel := v.GetInt("compression-level")
+			if !v.IsSet("compression-level") && cmdConfig.configuration != nil {
+				compressionLevel = cmdConfig.configuration.Dump.CompressionLevel
+			}
 			if compressionAlgo != "" {
-				compressor, err = compression.GetCompressor(compressionAlgo)
+				compressor, err = compression.GetCompressor(compressionAlgo, compressionLevel)
 				if err != nil {
 					return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
 				}
 			}
+			// encryption: check config, then CLI/env var overrides
+			encryption := v.GetString("encryption")
+			if !v.IsSet("encryption") && cmdConfig.configuration != nil {
+				encryption = cmdConfig.configuration.Dump.Encryption.Type
+			}
+			encryptionKey := v.GetString("encryption-key")
+			if !v.IsSet("encryption-key") && cmdConfig.configuration != nil {
+				encryptionKey = cmdConfig.configuration.Dump.Encryption.Key
+			}
+			var encryptor encrypt.Encryptor
+			switch {
+			case encryption == "" && encryptionKey == "":
+			case encryption == "":
+				return fmt.Errorf("encryption key %s provided without an encryption type", encryptionKey)
+			case encryptionKey == "":
+				return fmt.Errorf("encryption %s requires an encryption key", encryption)
+			default:
+				key, err := os.ReadFile(encryptionKey)
+				if err != nil {
+					return fmt.Errorf("failed to read encryption key: %v", err)
+				}
+				if encryptor, err = encrypt.GetEncryptor(encryption, key); err != nil {
+					return fmt.Errorf("failure to get encryption '%s': %v", encryption, err)
+				}
+			}
 			dumpOpts := core.DumpOptions{
 				Targets:             targets,
 				Safechars:           safechars,
 				DBNames:             include,
 				DBConn:              cmdConfig.dbconn,
 				Compressor:          compressor,
+				Encryptor:           encryptor,
 				Exclude:             exclude,
+				IncludeTables:       includeTables,
+				ExcludeTables:       excludeTables,
+				RowFilters:          rowFilters,
+				Masks:               masks,
+				MaskSalt:            maskSalt,
 				PreBackupScripts:    preBackupScripts,
 				PostBackupScripts:   preBackupScripts,
 				SuppressUseDatabase: noDatabaseName,
 				Compact:             compact,
+				NoData:              noData,
+				NoCreateInfo:        noCreateInfo,
+				NoDataTables:        noDataTables,
 				MaxAllowedPacket:    maxAllowedPacket,
+				Triggers:            triggers,
+				Routines:            routines,
+				Events:              events,
+				Parallelism:         parallelism,
+				SourceData:          sourceData,
+				Streaming:           streaming,
 			}
 
 			// retention, if enabled
@@ -149,6 +273,7 @@ func dumpCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
 			if retention == "" && cmdConfig.configuration != nil {
 				retention = cmdConfig.configuration.Prune.Retention
 			}
+			keep := retentionPolicy(v, cmdConfig)
 
 			// timer options
 			once := v.GetBool("once")
@@ -188,8 +313,10 @@ func dumpCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
 				if err != nil {
 					return fmt.Errorf("error running dump: %w", err)
 				}
-				if retention != "" {
-					if err := prune(core.PruneOptions{Targets: targets, Retention: retention}); err != nil {
+				if retention != "" || !keep.IsZero() {
+					pruneOpts := core.PruneOptions{Targets: targets, Retention: retention, Keep: keep}
+					setPruneGuards(&pruneOpts, v, cmdConfig)
+					if _, err := prune(pruneOpts); err != nil {
 						return fmt.Errorf("error running prune: %w", err)
 					}
 				}
@@ -220,6 +347,23 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	// exclude
 	flags.StringSlice("exclude", []string{}, "databases to exclude from the dump.")
 
+	// tables to include or exclude
+	flags.StringSlice("include-table", []string{}, "Tables to dump, as patterns of `schema.table`, comma-separated; empty to do all. A pattern is a glob, e.g. `shop.*`, or a regular expression between slashes, e.g. `/^shop\\.order_\\d+$/`.")
+	flags.StringSlice("exclude-table", []string{}, "Tables to exclude from the dump, as patterns of `schema.table`, comma-separated, e.g. `*.sessions`. A pattern is a glob, or a regular expression between slashes. Takes precedence over `--include-table`.")
+
+	// structure or data only
+	flags.Bool("no-data", false, "Dump only the structure of tables, without their rows.")
+	flags.Bool("no-create-info", false, "Dump only the rows of tables, without their structure or views, to load into tables that already exist.")
+	flags.StringSlice("no-data-table", []string{}, "Tables of which to dump only the structure, without their rows, as patterns of `schema.table`, comma-separated, e.g. `*.sessions`. A pattern is a glob, or a regular expression between slashes.")
+
+	// rows of tables
+	flags.StringArray("where", []string{}, "Dump only the rows of a table that match a condition, as `schema.table=condition`, e.g. `shop.orders=created_at > '2024-01-01'`. Accepts multiple tables. Replaces the table filters in the configuration file.")
+	flags.StringArray("limit", []string{}, "Dump at most a number of rows of a table, as `schema.table=rows`, e.g. `shop.orders=1000`. Accepts multiple tables. Replaces the table filters in the configuration file.")
+
+	// masking
+	flags.StringArray("mask", []string{}, "Mask the values of a column as they are dumped, as `schema.table.column=rule`, e.g. `shop.customers.email=email`. The rule is one of `null`, `fixed:<value>`, `hash`, `hash:<length>`, `email`, `name`, `partial:<keep-start>:<keep-end>` or `digits`. Accepts multiple columns. Replaces the masking rules in the configuration file.")
+	flags.String("mask-salt", "", "Salt of the masks that derive their value from the original, i.e. `hash`, `email`, `name` and `digits`, which then mask a value the same way in every dump. If blank, a random salt is used for each dump.")
+
 	// single database, do not include `USE database;` in dump
 	flags.Bool("no-database-name", false, "Omit `USE <database>;` in the dump, so it can be restored easily to a different database.")
 
@@ -239,7 +383,14 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	flags.Bool("safechars", false, "The dump filename usually includes the character `:` in the date, to comply with RFC3339. Some systems and shells don't like that character. If true, will replace all `:` with `-`.")
 
 	// compression
-	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`")
+	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`, `zstd`, `xz`, `lz4`, `none`")
+
+	// compression level
+	flags.Int("compression-level", 0, "Compression level to use, within the range supported by the compression: 1-9 for `gzip`, `bzip2`, `xz` and `lz4`, 1-22 for `zstd`. 0 means to use the default level.")
+
+	// encryption
+	flags.String("encryption", "", "Encryption to use. Supported are: `age`, `pgp`. Requires `--encryption-key`.")
+	flags.String("encryption-key", "", "File with the keys to encrypt to: for `age`, a recipients file, with one recipient per line; for `pgp`, one or more public keys.")
 
 	// source filename pattern
 	flags.String("filename-pattern", "db_backup_{{ .now }}.{{ .compression }}", "Pattern to use for filename in target. See documentation.")
@@ -253,6 +404,20 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	// max-allowed-packet size
 	flags.Int("max-allowed-packet", defaultMaxAllowedPacket, "Maximum size of the buffer for client/server communication, similar to mysqldump's max_allowed_packet. 0 means to use the default size.")
 
+	// triggers, routines, events
+	flags.Bool("triggers", true, "Dump the triggers defined on each dumped table.")
+	flags.Bool("routines", false, "Dump stored procedures and functions.")
+	flags.Bool("events", false, "Dump scheduled events.")
+
+	// streaming
+	flags.Bool("streaming", false, "Stream the backup directly to the targets as it is dumped, without writing it to local disk. Pre- and post-backup scripts are not supported when streaming.")
+
+	// parallelism
+	flags.Int("parallelism", defaultParallelism, "Number of tables to dump at once, each on its own connection. When greater than 1, all connections share a single consistent snapshot, which requires the RELOAD privilege, and each table is written to its own file.")
+
+	// position in the binary log
+	flags.Int("source-data", mysql.SourceDataNone, "Write the position in the binary log, and GTIDs, to the dump of each schema, for seeding replicas and point-in-time recovery: 0 not at all, 1 as a CHANGE MASTER TO statement that runs on restore, 2 as a comment. Dumps from a consistent snapshot, which requires the RELOAD privilege, and needs binary logging to be enabled.")
+
 	cmd.MarkFlagsMutuallyExclusive("once", "cron")
 	cmd.MarkFlagsMutuallyExclusive("once", "begin")
 	cmd.MarkFlagsMutuallyExclusive("once", "frequency")
@@ -260,6 +425,103 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	cmd.MarkFlagsMutuallyExclusive("cron", "frequency")
 	// retention
 	flags.String("retention", "", "Retention period for backups. Optional. If not specified, no pruning will be done. Can be number of backups or time-based. For time-based, the format is: 1d, 1w, 1m, 1y for days, weeks, months, years, respectively. For number-based, the format is: 1c, 2c, 3c, etc. for the count of backups to keep.")
+	addRetentionPolicyFlags(flags)
+	addPruneGuardFlags(flags)
 
 	return cmd, nil
 }
+
+// dumpRowFilters the filters of the rows to dump of each table, by schema.table, from the
+// --where and --limit flags or, if neither is set, the table filters in the configuration
+func dumpRowFilters(cmd *cobra.Command, cmdConfig *cmdConfiguration) (map[string]mysql.RowFilter, error) {
+	// read from the flags themselves, as viper would split each condition on whitespace
+	wheres, err := cmd.Flags().GetStringArray("where")
+	if err != nil {
+		return nil, err
+	}
+	limits, err := cmd.Flags().GetStringArray("limit")
+	if err != nil {
+		return nil, err
+	}
+	filters := map[string]mysql.RowFilter{}
+	if len(wheres) == 0 && len(limits) == 0 {
+		if cmdConfig.configuration == nil || len(cmdConfig.configuration.Dump.TableFilters) == 0 {
+			return nil, nil
+		}
+		for table, f := range cmdConfig.configuration.Dump.TableFilters {
+			filters[table] = mysql.RowFilter{Where: f.Where, Limit: f.Limit}
+		}
+	}
+	for _, w := range wheres {
+		table, where, ok := strings.Cut(w, "=")
+		if !ok || strings.TrimSpace(where) == "" {
+			return nil, fmt.Errorf("invalid where, must be schema.table=condition: %s", w)
+		}
+		f := filters[table]
+		f.Where = where
+		filters[table] = f
+	}
+	for _, l := range limits {
+		table, limit, ok := strings.Cut(l, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid limit, must be schema.table=rows: %s", l)
+		}
+		rows, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit of %s: %v", table, err)
+		}
+		f := filters[table]
+		f.Limit = rows
+		filters[table] = f
+	}
+	for table, f := range filters {
+		if schema, name, ok := strings.Cut(table, "."); !ok || schema == "" || name == "" {
+			return nil, fmt.Errorf("invalid table %s in table filters, must be schema.table", table)
+		}
+		if f.Limit < 0 {
+			return nil, fmt.Errorf("invalid limit of %s, must not be negative: %d", table, f.Limit)
+		}
+	}
+	return filters, nil
+}
+
+// dumpMasks the masks of columns, by schema.table.column, from the --mask flags or, if none
+// is set, the masking rules in the configuration
+func dumpMasks(cmd *cobra.Command, cmdConfig *cmdConfiguration) (map[string]mask.Rule, error) {
+	// read from the flag itself, as viper would split each rule on whitespace
+	maskFlags, err := cmd.Flags().GetStringArray("mask")
+	if err != nil {
+		return nil, err
+	}
+	masks := map[string]mask.Rule{}
+	switch {
+	case len(maskFlags) > 0:
+		for _, m := range maskFlags {
+			column, r, ok := strings.Cut(m, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid mask, must be schema.table.column=rule: %s", m)
+			}
+			rule, err := mask.ParseRule(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mask of %s: %v", column, err)
+			}
+			masks[column] = rule
+		}
+	case cmdConfig.configuration != nil && len(cmdConfig.configuration.Dump.Masking.Rules) > 0:
+		for column, r := range cmdConfig.configuration.Dump.Masking.Rules {
+			rule := mask.Rule{Type: r.Type, Value: r.Value, KeepStart: r.KeepStart, KeepEnd: r.KeepEnd, Length: r.Length}
+			if err := rule.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid mask of %s: %v", column, err)
+			}
+			masks[column] = rule
+		}
+	default:
+		return nil, nil
+	}
+	for column := range masks {
+		if parts := strings.Split(column, "."); len(parts) < 3 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return nil, fmt.Errorf("invalid masked column %s, must be schema.table.column", column)
+		}
+	}
+	return masks, nil
+}
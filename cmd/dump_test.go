@@ -7,6 +7,9 @@ import (
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/file"
 	"github.com/go-test/deep"
@@ -36,26 +39,42 @@ func TestDumpCmd(t *testing.T) {
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 		{"file URL with prune", []string{"--server", "abc", "--target", "file:///foo/bar", "--retention", "1h"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}},
+		{"file URL with prune policy", []string{"--server", "abc", "--target", "file:///foo/bar", "--keep-daily", "7", "--keep-monthly", "12"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Daily: 7, Monthly: 12}}},
 
 		// database name and port
 		{"database explicit name with default port", []string{"--server", "abc", "--target", "file:///foo/bar"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 		{"database explicit name with explicit port", []string{"--server", "abc", "--port", "3307", "--target", "file:///foo/bar"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: 3307},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 
@@ -64,38 +83,246 @@ func TestDumpCmd(t *testing.T) {
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}},
 		{"config file with port override", []string{"--config-file", "testdata/config.yml", "--port", "3307"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abcd", Port: 3307, User: "user2", Pass: "xxxx2"},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}},
 
+		// triggers, routines, events
+		{"routines and events", []string{"--server", "abc", "--target", "file:///foo/bar", "--routines", "--events"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			Routines:         true,
+			Events:           true,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"no triggers", []string{"--server", "abc", "--target", "file:///foo/bar", "--triggers=false"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"parallelism", []string{"--server", "abc", "--target", "file:///foo/bar", "--parallelism", "4"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      4,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"streaming", []string{"--server", "abc", "--target", "file:///foo/bar", "--streaming"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			Streaming:        true,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid parallelism", []string{"--server", "abc", "--target", "file:///foo/bar", "--parallelism", "0"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"source data", []string{"--server", "abc", "--target", "file:///foo/bar", "--source-data", "2"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			SourceData:       mysql.SourceDataComment,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid source data", []string{"--server", "abc", "--target", "file:///foo/bar", "--source-data", "3"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"compression level", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression", "zstd", "--compression-level", "19"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.ZstdCompressor{Level: 19},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"no compression", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression", "none"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.NoneCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"encryption", []string{"--server", "abc", "--target", "file:///foo/bar", "--encryption", "age", "--encryption-key", "testdata/age-recipients.txt"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Encryptor:        &encrypt.AgeEncryptor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"encryption without key", []string{"--server", "abc", "--target", "file:///foo/bar", "--encryption", "age"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"encryption key without type", []string{"--server", "abc", "--target", "file:///foo/bar", "--encryption-key", "testdata/age-recipients.txt"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"encryption with invalid key", []string{"--server", "abc", "--target", "file:///foo/bar", "--encryption", "age", "--encryption-key", "testdata/config.yml"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid compression level", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression", "gzip", "--compression-level", "10"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+
+		// schemas and tables
+		{"exclude schemas and tables", []string{"--server", "abc", "--target", "file:///foo/bar", "--exclude", "logs", "--include-table", "shop.*", "--exclude-table", "*.sessions,/^shop\\.audit_\\d+$/"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			Exclude:          []string{"logs"},
+			IncludeTables:    []string{"shop.*"},
+			ExcludeTables:    []string{"*.sessions", `/^shop\.audit_\d+$/`},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid table pattern", []string{"--server", "abc", "--target", "file:///foo/bar", "--exclude-table", "sessions"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid table regex", []string{"--server", "abc", "--target", "file:///foo/bar", "--exclude-table", "/shop.(/"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+
+		// rows of tables
+		{"where and limit", []string{"--server", "abc", "--target", "file:///foo/bar", "--where", "shop.orders=created_at > '2024-01-01' AND status = 'paid'", "--limit", "shop.orders=1000", "--limit", "shop.sessions=10"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			RowFilters: map[string]mysql.RowFilter{
+				"shop.orders":   {Where: "created_at > '2024-01-01' AND status = 'paid'", Limit: 1000},
+				"shop.sessions": {Limit: 10},
+			},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"table filters config file", []string{"--config-file", "testdata/table-filters.yml"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			RowFilters: map[string]mysql.RowFilter{
+				"shop.orders":   {Where: "created_at > '2024-01-01'", Limit: 1000},
+				"shop.sessions": {Limit: 10},
+			},
+			Masks: map[string]mask.Rule{
+				"shop.customers.email": {Type: mask.Email},
+				"shop.customers.card":  {Type: mask.Partial, KeepEnd: 4},
+			},
+			MaskSalt:     "pepper",
+			NoDataTables: []string{"*.cache"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"where replaces config file", []string{"--config-file", "testdata/table-filters.yml", "--where", "crm.customers=id < 100"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			RowFilters:       map[string]mysql.RowFilter{"crm.customers": {Where: "id < 100"}},
+			Masks: map[string]mask.Rule{
+				"shop.customers.email": {Type: mask.Email},
+				"shop.customers.card":  {Type: mask.Partial, KeepEnd: 4},
+			},
+			MaskSalt:     "pepper",
+			NoDataTables: []string{"*.cache"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid where", []string{"--server", "abc", "--target", "file:///foo/bar", "--where", "shop.orders"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid where table", []string{"--server", "abc", "--target", "file:///foo/bar", "--where", "orders=id > 1"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid limit", []string{"--server", "abc", "--target", "file:///foo/bar", "--limit", "shop.orders=many"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+
+		// structure or data only
+		{"no data", []string{"--server", "abc", "--target", "file:///foo/bar", "--no-data"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			NoData:           true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"no create info with no data tables", []string{"--server", "abc", "--target", "file:///foo/bar", "--no-create-info", "--no-data-table", "*.sessions,shop.cache"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			NoCreateInfo:     true,
+			NoDataTables:     []string{"*.sessions", "shop.cache"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"no data and no create info", []string{"--server", "abc", "--target", "file:///foo/bar", "--no-data", "--no-create-info"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid no data table", []string{"--server", "abc", "--target", "file:///foo/bar", "--no-data-table", "sessions"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+
+		// masking
+		{"masks", []string{"--server", "abc", "--target", "file:///foo/bar", "--mask", "shop.customers.name=name", "--mask", "shop.customers.notes=fixed:no notes, sorry", "--mask-salt", "pepper"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			Masks: map[string]mask.Rule{
+				"shop.customers.name":  {Type: mask.Name},
+				"shop.customers.notes": {Type: mask.Fixed, Value: "no notes, sorry"},
+			},
+			MaskSalt: "pepper",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"masks replace config file", []string{"--config-file", "testdata/table-filters.yml", "--mask", "shop.customers.phone=digits"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
+			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			RowFilters: map[string]mysql.RowFilter{
+				"shop.orders":   {Where: "created_at > '2024-01-01'", Limit: 1000},
+				"shop.sessions": {Limit: 10},
+			},
+			Masks:        map[string]mask.Rule{"shop.customers.phone": {Type: mask.Digits}},
+			MaskSalt:     "pepper",
+			NoDataTables: []string{"*.cache"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid mask rule", []string{"--server", "abc", "--target", "file:///foo/bar", "--mask", "shop.customers.name=scramble"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid masked column", []string{"--server", "abc", "--target", "file:///foo/bar", "--mask", "customers.name=name"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+
 		// timer options
 		{"once flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--once"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Once: true, Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 		{"cron flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--cron", "0 0 * * *"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin, Cron: "0 0 * * *"}, nil},
 		{"begin flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--begin", "1234"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: "1234"}, nil},
 		{"frequency flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--frequency", "10"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
 			Compressor:       &compression.GzipCompressor{},
+			Triggers:         true,
+			Parallelism:      defaultParallelism,
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 		}, core.TimerOptions{Frequency: 10, Begin: defaultBegin}, nil},
 		{"incompatible flags: once/cron", []string{"--server", "abc", "--target", "file:///foo/bar", "--once", "--cron", "0 0 * * *"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
@@ -134,7 +361,7 @@ func TestDumpCmd(t *testing.T) {
 					}
 					t.Errorf("pruneOpts compare failed: %v", diff)
 					return false
-				})).Return(nil)
+				})).Return(nil, nil)
 			}
 
 			cmd, err := rootCmd(m)
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+const (
+	listFormatTable = "table"
+	listFormatJSON  = "json"
+	dateFormat      = "2006-01-02"
+	rfc3339Minutes  = "2006-01-02T15:04Z07:00"
+)
+
+func listCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "list backups",
+		Long: `List the backups in one or more targets, oldest first, with their time, size, target and compression.
+		If no targets are given, lists the dump targets from the configuration file.
+		`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("starting list")
+			targetURLs := v.GetStringSlice("target")
+			var targets []storage.Storage
+			if len(targetURLs) > 0 {
+				for _, t := range targetURLs {
+					store, err := parseTarget(t, cmdConfig)
+					if err != nil {
+						return err
+					}
+					targets = append(targets, store)
+				}
+			} else if cmdConfig.configuration != nil {
+				for _, t := range cmdConfig.configuration.Dump.Targets {
+					store, err := parseTarget("config://"+t, cmdConfig)
+					if err != nil {
+						return err
+					}
+					targets = append(targets, store)
+				}
+			}
+			if len(targets) == 0 {
+				return fmt.Errorf("no targets specified")
+			}
+
+			since, err := parseTime(v.GetString("since"), false)
+			if err != nil {
+				return fmt.Errorf("invalid since: %v", err)
+			}
+			until, err := parseTime(v.GetString("until"), true)
+			if err != nil {
+				return fmt.Errorf("invalid until: %v", err)
+			}
+
+			format := v.GetString("format")
+			if format != listFormatTable && format != listFormatJSON {
+				return fmt.Errorf("invalid format %s, must be one of: %s, %s", format, listFormatTable, listFormatJSON)
+			}
+
+			// encryption key, only needed to read the manifests of encrypted backups
+			encryptionKey := v.GetString("encryption-key")
+			if !v.IsSet("encryption-key") && cmdConfig.configuration != nil {
+				encryptionKey = cmdConfig.configuration.Restore.Encryption.Key
+			}
+			decryptor, err := getDecryptor("", encryptionKey)
+			if err != nil {
+				return err
+			}
+
+			listOpts := core.ListOptions{
+				Targets:   targets,
+				Since:     since,
+				Until:     until,
+				Manifest:  v.GetBool("manifest"),
+				Decryptor: decryptor,
+			}
+			list := core.List
+			if execs != nil {
+				list = execs.list
+			}
+			backups, err := list(listOpts)
+			if err != nil {
+				return fmt.Errorf("error listing backups: %w", err)
+			}
+			if format == listFormatJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if backups == nil {
+					backups = []core.Backup{}
+				}
+				return enc.Encode(backups)
+			}
+			return writeBackupTable(cmd.OutOrStdout(), backups, listOpts.Manifest)
+		},
+	}
+	v = viper.New()
+	v.SetEnvPrefix("db_list")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	flags.StringSlice("target", []string{}, "full URL target to the directory where the backups are stored. Can be a file URL, or a reference to a target in the configuration file, e.g. `config://targetname`. Accepts multiple targets. Defaults to the dump targets in the configuration file.")
+	flags.String("since", "", "only list backups made at or after this time, either RFC3339, e.g. `2024-01-02T15:04:05Z`, or a date, e.g. `2024-01-02`")
+	flags.String("until", "", "only list backups made before this time, either RFC3339, e.g. `2024-01-02T15:04:05Z`, or a date, e.g. `2024-01-02`, which includes all of that day")
+	flags.String("format", listFormatTable, "output format, one of: table, json")
+	flags.Bool("manifest", false, "read the manifest of each backup, and include a summary of it. Requires reading the start of each backup, and does not find the manifests of streamed backups.")
+	flags.String("encryption-key", "", "path to the private key used to read the manifests of encrypted backups")
+
+	return cmd, nil
+}
+
+// parseTime parses a time as RFC3339, with or without seconds, or a date. If endOfDay
+// is set, a date is treated as the end of that day, so that all of it is included.
+func parseTime(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, rfc3339Minutes} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.Parse(dateFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither RFC3339 nor %s", s, dateFormat)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// writeBackupTable writes the backups as a table
+func writeBackupTable(out io.Writer, backups []core.Backup, manifest bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "TIME\tSIZE\tTARGET\tNAME\tCOMPRESSION\tENCRYPTION"
+	if manifest {
+		header += "\tSERVER\tSCHEMAS\tTABLES\tROWS\tDURATION"
+	}
+	fmt.Fprintln(w, header)
+	for _, b := range backups {
+		line := fmt.Sprintf("%s\t%d\t%s\t%s\t%s\t%s", b.Time.Format(time.RFC3339), b.Size, b.Target, b.Name, dash(b.Compression), dash(b.Encryption))
+		if manifest {
+			if m := b.Manifest; m != nil && m.Preliminary {
+				// only the end of a streamed backup has its tables, rows and duration
+				line += fmt.Sprintf("\t%s\t%d\t-\t-\t-", dash(strings.TrimSpace(m.ServerHost+" "+m.ServerVersion)), m.Schemas)
+			} else if m != nil {
+				line += fmt.Sprintf("\t%s\t%d\t%d\t%d\t%s", dash(strings.TrimSpace(m.ServerHost+" "+m.ServerVersion)), m.Schemas, m.Tables, m.Rows, m.Duration.Round(time.Second))
+			} else {
+				line += "\t-\t-\t-\t-\t-"
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/file"
+)
+
+func TestListCmd(t *testing.T) {
+	t.Parallel()
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+	otherTarget := "file:///baz"
+	otherTargetURL, _ := url.Parse(otherTarget)
+	backups := []core.Backup{
+		{Target: fileTarget, Name: "db_backup_2024-01-02T03:04:05Z.tgz", Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Size: 100, Compression: "gzip"},
+	}
+
+	tests := []struct {
+		name                string
+		args                []string // "list" will be prepended automatically
+		wantErr             bool
+		expectedListOptions core.ListOptions
+		expectedOutput      []string
+	}{
+		{"invalid target URL", []string{"--target", "def"}, true, core.ListOptions{}, nil},
+		{"no targets", []string{}, true, core.ListOptions{}, nil},
+		{"invalid format", []string{"--target", fileTarget, "--format", "xml"}, true, core.ListOptions{}, nil},
+		{"invalid since", []string{"--target", fileTarget, "--since", "yesterday"}, true, core.ListOptions{}, nil},
+		{"file URL", []string{"--target", fileTarget}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}}, []string{"TIME", "db_backup_2024-01-02T03:04:05Z.tgz", "gzip"}},
+		{"multiple targets", []string{"--target", fileTarget, "--target", otherTarget}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL), file.New(*otherTargetURL)}}, nil},
+		{"config file", []string{"--config-file", "testdata/config.yml"}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}}, nil},
+		{"config target", []string{"--config-file", "testdata/config.yml", "--target", "config://other"}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}}, nil},
+		{"date range", []string{"--target", fileTarget, "--since", "2024-01-01", "--until", "2024-01-02"}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)}, nil},
+		{"RFC3339 range", []string{"--target", fileTarget, "--since", "2024-01-01T10:00:00Z", "--until", "2024-01-02T10:00:00Z"}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Since: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), Until: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)}, nil},
+		{"json with manifest", []string{"--target", fileTarget, "--format", "json", "--manifest"}, false, core.ListOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Manifest: true}, []string{`"name": "db_backup_2024-01-02T03:04:05Z.tgz"`, `"size": 100`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("list", mock.MatchedBy(func(listOpts core.ListOptions) bool {
+				diff := deep.Equal(listOpts, tt.expectedListOptions)
+				if diff == nil {
+					return true
+				}
+				t.Errorf("listOpts compare failed: %v", diff)
+				return false
+			})).Return(backups, nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs(append([]string{"list"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+				for _, s := range tt.expectedOutput {
+					if !strings.Contains(out.String(), s) {
+						t.Errorf("output missing %q: %s", s, out.String())
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
@@ -26,6 +31,15 @@ func pruneCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error)
 		
 		For time-based, prune always converts the time to hours, and then rounds up. This means that 2d is treated as 48h, and
 		any backups must be at least 48 full hours ago to be pruned.
+
+		Instead of, or as well as, the retention period, backups can be kept by a grandfather-father-son policy, with
+		--keep-last, --keep-daily, --keep-weekly, --keep-monthly and --keep-yearly. A backup is kept if any of them keeps it.
+
+		With --dry-run, prune runs once, and prints which files it would keep and remove, and why, without removing any.
+
+		Prune refuses to leave fewer than --min-keep backups in a target, to prune when the newest backup is older than
+		--max-backup-age, as backups may be failing, or to remove more than --max-delete-fraction of the backups at once.
+		Use --force to prune anyway despite the last two.
 		`,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			bindFlags(cmd, v)
@@ -71,6 +85,12 @@ func pruneCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error)
 			if retention == "" && cmdConfig.configuration != nil {
 				retention = cmdConfig.configuration.Prune.Retention
 			}
+			keep := retentionPolicy(v, cmdConfig)
+			dryRun := v.GetBool("dry-run")
+			format := v.GetString("format")
+			if format != listFormatTable && format != listFormatJSON {
+				return fmt.Errorf("invalid format %s, must be one of: %s, %s", format, listFormatTable, listFormatJSON)
+			}
 
 			// timer options
 			once := v.GetBool("once")
@@ -95,6 +115,10 @@ func pruneCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error)
 				Begin:     begin,
 				Frequency: frequency,
 			}
+			// a dry run is to review the plan, so there is no point in repeating it
+			if dryRun {
+				timerOpts = core.TimerOptions{Once: true}
+			}
 
 			prune := core.Prune
 			timer := core.TimerCommand
@@ -103,7 +127,16 @@ func pruneCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error)
 				timer = execs.timer
 			}
 			if err := timer(timerOpts, func() error {
-				return prune(core.PruneOptions{Targets: targets, Retention: retention})
+				pruneOpts := core.PruneOptions{Targets: targets, Retention: retention, Keep: keep, DryRun: dryRun, Force: v.GetBool("force")}
+				setPruneGuards(&pruneOpts, v, cmdConfig)
+				result, err := prune(pruneOpts)
+				// a dry run shows the plan even if a guard stops it
+				if dryRun {
+					if werr := writePruneResult(cmd.OutOrStdout(), format, result); werr != nil {
+						return werr
+					}
+				}
+				return err
 			}); err != nil {
 				return fmt.Errorf("error running prune: %w", err)
 			}
@@ -123,6 +156,17 @@ func pruneCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error)
 	// retention
 	flags.String("retention", "", "Retention period for backups. REQUIRED. Can be number of backups or time-based. For time-based, the format is: 1d, 1w, 1m, 1y for days, weeks, months, years, respectively. For number-based, the format is: 1c, 2c, 3c, etc. for the count of backups to keep.")
 
+	// grandfather-father-son retention
+	addRetentionPolicyFlags(flags)
+
+	// guards
+	addPruneGuardFlags(flags)
+	flags.Bool("force", false, "Prune even if the newest backup is older than `--max-backup-age`, or more than `--max-delete-fraction` of the backups would be removed. Does not override `--min-keep`.")
+
+	// dry run
+	flags.Bool("dry-run", false, "Do not remove anything; run once, and print which files would be kept and removed, and why.")
+	flags.String("format", listFormatTable, "output format of a dry run, one of: table, json")
+
 	// frequency
 	flags.Int("frequency", defaultFrequency, "how often to run prunes, in minutes")
 
@@ -137,3 +181,105 @@ func pruneCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error)
 
 	return cmd, nil
 }
+
+// addRetentionPolicyFlags adds the flags of the grandfather-father-son retention policy
+func addRetentionPolicyFlags(flags *pflag.FlagSet) {
+	flags.Int("keep-last", 0, "Number of the most recent backups to keep.")
+	flags.Int("keep-daily", 0, "Number of days for which to keep the most recent backup of the day, going back over the days that have backups.")
+	flags.Int("keep-weekly", 0, "Number of weeks, starting on Monday, for which to keep the most recent backup of the week.")
+	flags.Int("keep-monthly", 0, "Number of months for which to keep the most recent backup of the month.")
+	flags.Int("keep-yearly", 0, "Number of years for which to keep the most recent backup of the year.")
+}
+
+// addPruneGuardFlags adds the flags of the guards against pruning too much
+func addPruneGuardFlags(flags *pflag.FlagSet) {
+	flags.Int("min-keep", 0, "Fewest backups to leave in each target. A prune that would leave fewer fails, and removes nothing.")
+	flags.String("max-backup-age", "", "If the newest backup in a target is older than this, e.g. `2d`, in the same format as a time-based retention, backups may be failing, so prune fails, and removes nothing.")
+	flags.Float64("max-delete-fraction", 0, "Largest fraction of the backups in a target, from 0 to 1, e.g. `0.5`, to remove at once. A prune that would remove more fails, and removes nothing. 0 for no limit.")
+}
+
+// setPruneGuards sets the guards against pruning too much, from the flags or, for those not set,
+// the prune configuration
+func setPruneGuards(opts *core.PruneOptions, v *viper.Viper, cmdConfig *cmdConfiguration) {
+	opts.MinKeep = v.GetInt("min-keep")
+	opts.MaxBackupAge = v.GetString("max-backup-age")
+	opts.MaxDeleteFraction = v.GetFloat64("max-delete-fraction")
+	if cmdConfig.configuration == nil {
+		return
+	}
+	pruneConfig := cmdConfig.configuration.Prune
+	if !v.IsSet("min-keep") {
+		opts.MinKeep = pruneConfig.MinKeep
+	}
+	if !v.IsSet("max-backup-age") {
+		opts.MaxBackupAge = pruneConfig.MaxBackupAge
+	}
+	if !v.IsSet("max-delete-fraction") {
+		opts.MaxDeleteFraction = pruneConfig.MaxDeleteFraction
+	}
+}
+
+// retentionPolicy the grandfather-father-son retention policy, from the flags or, for those not
+// set, the prune configuration
+func retentionPolicy(v *viper.Viper, cmdConfig *cmdConfiguration) core.RetentionPolicy {
+	keep := core.RetentionPolicy{
+		Last:    v.GetInt("keep-last"),
+		Daily:   v.GetInt("keep-daily"),
+		Weekly:  v.GetInt("keep-weekly"),
+		Monthly: v.GetInt("keep-monthly"),
+		Yearly:  v.GetInt("keep-yearly"),
+	}
+	if cmdConfig.configuration == nil {
+		return keep
+	}
+	pruneConfig := cmdConfig.configuration.Prune
+	if !v.IsSet("keep-last") {
+		keep.Last = pruneConfig.KeepLast
+	}
+	if !v.IsSet("keep-daily") {
+		keep.Daily = pruneConfig.KeepDaily
+	}
+	if !v.IsSet("keep-weekly") {
+		keep.Weekly = pruneConfig.KeepWeekly
+	}
+	if !v.IsSet("keep-monthly") {
+		keep.Monthly = pruneConfig.KeepMonthly
+	}
+	if !v.IsSet("keep-yearly") {
+		keep.Yearly = pruneConfig.KeepYearly
+	}
+	return keep
+}
+
+// writePruneResult writes what prune would do, or did, in each target, as a table or JSON
+func writePruneResult(out io.Writer, format string, result *core.PruneResult) error {
+	if result == nil {
+		return nil
+	}
+	if format == listFormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tACTION\tKIND\tTIME\tNAME\tREASON")
+	for _, t := range result.Targets {
+		for _, f := range t.Files {
+			action, kind := "keep", "backup"
+			if !f.Keep {
+				action = "remove"
+			}
+			if f.Segment {
+				kind = "binlog"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Target, action, kind, f.Time.Format(time.RFC3339), f.Name, f.Reason)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, t := range result.Targets {
+		fmt.Fprintf(out, "%s: %d of %d files to remove\n", t.Target, t.Removed(), len(t.Files))
+	}
+	return nil
+}
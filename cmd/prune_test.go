@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
@@ -15,18 +20,31 @@ func TestPruneCmd(t *testing.T) {
 	t.Parallel()
 	fileTarget := "file:///foo/bar"
 	fileTargetURL, _ := url.Parse(fileTarget)
+	result := &core.PruneResult{DryRun: true, Targets: []core.PruneTarget{{Target: fileTarget, Files: []core.PruneFile{
+		{Name: "db_backup_2024-01-02T03:04:05Z.tgz", Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Keep: true, Reason: "one of the last 1"},
+		{Name: "db_backup_2024-01-01T03:04:05Z.tgz", Time: time.Date(2024, 1, 1, 3, 4, 5, 0, time.UTC), Reason: "not kept by any retention rule"},
+	}}}}
 
 	tests := []struct {
 		name                 string
-		args                 []string // "dump" will be prepended automatically
+		args                 []string // "prune" will be prepended automatically
 		config               string
 		wantErr              bool
 		expectedPruneOptions core.PruneOptions
 		expectedTimerOptions core.TimerOptions
+		expectedOutput       []string
 	}{
-		{"invalid target URL", []string{"--target", "def"}, "", true, core.PruneOptions{}, core.TimerOptions{}},
-		{"file URL", []string{"--target", fileTarget, "--retention", "1h"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
-		{"config file", []string{"--config-file", "testdata/config.yml"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"invalid target URL", []string{"--target", "def"}, "", true, core.PruneOptions{}, core.TimerOptions{}, nil},
+		{"file URL", []string{"--target", fileTarget, "--retention", "1h"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"config file", []string{"--config-file", "testdata/config.yml"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"keep flags", []string{"--target", fileTarget, "--keep-last", "3", "--keep-daily", "7", "--keep-weekly", "4", "--keep-monthly", "6", "--keep-yearly", "2"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 3, Daily: 7, Weekly: 4, Monthly: 6, Yearly: 2}}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"keep config file", []string{"--config-file", "testdata/prune-policy.yml"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 7, Daily: 14, Weekly: 8, Monthly: 12, Yearly: 5}, MinKeep: 3, MaxBackupAge: "2d", MaxDeleteFraction: 0.5}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"dry run", []string{"--target", fileTarget, "--keep-last", "1", "--dry-run"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 1}, DryRun: true}, core.TimerOptions{Once: true}, []string{"ACTION", "remove", "db_backup_2024-01-01T03:04:05Z.tgz", "not kept by any retention rule", "1 of 2 files to remove"}},
+		{"dry run json", []string{"--target", fileTarget, "--keep-last", "1", "--dry-run", "--format", "json"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 1}, DryRun: true}, core.TimerOptions{Once: true}, []string{`"dry-run": true`, `"name": "db_backup_2024-01-01T03:04:05Z.tgz"`, `"keep": false`}},
+		{"guards", []string{"--target", fileTarget, "--keep-last", "1", "--min-keep", "2", "--max-backup-age", "1w", "--max-delete-fraction", "0.25", "--force"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 1}, MinKeep: 2, MaxBackupAge: "1w", MaxDeleteFraction: 0.25, Force: true}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"guard flags override config file", []string{"--config-file", "testdata/prune-policy.yml", "--min-keep", "1", "--max-delete-fraction", "0"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 7, Daily: 14, Weekly: 8, Monthly: 12, Yearly: 5}, MinKeep: 1, MaxBackupAge: "2d"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid format", []string{"--target", fileTarget, "--keep-last", "1", "--dry-run", "--format", "xml"}, "", true, core.PruneOptions{}, core.TimerOptions{}, nil},
+		{"keep flag overrides config file", []string{"--config-file", "testdata/prune-policy.yml", "--keep-daily", "30"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Keep: core.RetentionPolicy{Last: 7, Daily: 30, Weekly: 8, Monthly: 12, Yearly: 5}, MinKeep: 3, MaxBackupAge: "2d", MaxDeleteFraction: 0.5}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 	}
 
 	for _, tt := range tests {
@@ -39,12 +57,14 @@ func TestPruneCmd(t *testing.T) {
 				}
 				t.Errorf("pruneOpts compare failed: %v", diff)
 				return false
-			})).Return(nil)
+			})).Return(result, nil)
 			m.On("timer", tt.expectedTimerOptions).Return(nil)
 			cmd, err := rootCmd(m)
 			if err != nil {
 				t.Fatal(err)
 			}
+			var out bytes.Buffer
+			cmd.SetOut(&out)
 			cmd.SetArgs(append([]string{"prune"}, tt.args...))
 			err = cmd.Execute()
 			switch {
@@ -54,7 +74,37 @@ func TestPruneCmd(t *testing.T) {
 				t.Fatal(err)
 			case err == nil:
 				m.AssertExpectations(t)
+				for _, s := range tt.expectedOutput {
+					if !strings.Contains(out.String(), s) {
+						t.Errorf("output missing %q: %s", s, out.String())
+					}
+				}
 			}
 		})
 	}
 }
+
+func TestPruneCmdGuard(t *testing.T) {
+	t.Parallel()
+	result := &core.PruneResult{DryRun: true, Targets: []core.PruneTarget{{Target: "file:///foo/bar", Files: []core.PruneFile{
+		{Name: "db_backup_2024-01-01T03:04:05Z.tgz", Time: time.Date(2024, 1, 1, 3, 4, 5, 0, time.UTC), Reason: "not kept by any retention rule"},
+	}}}}
+	m := newMockExecs()
+	m.On("prune", mock.Anything).Return(result, fmt.Errorf("%w: file:///foo/bar would keep 0 of 1 backups, fewer than 1", core.ErrPruneMinKeep))
+	m.On("timer", core.TimerOptions{Once: true}).Return(nil)
+	cmd, err := rootCmd(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"prune", "--target", "file:///foo/bar", "--keep-last", "1", "--min-keep", "1", "--dry-run"})
+	err = cmd.Execute()
+	if !errors.Is(err, core.ErrPruneMinKeep) {
+		t.Fatalf("expected error %v, got %v", core.ErrPruneMinKeep, err)
+	}
+	// the plan is shown, even though the guard stopped the prune
+	if !strings.Contains(out.String(), "db_backup_2024-01-01T03:04:05Z.tgz") {
+		t.Errorf("output missing plan: %s", out.String())
+	}
+}
@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -9,9 +13,10 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/config"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/util"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
 )
 
 func restoreCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
@@ -20,17 +25,45 @@ func restoreCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error
 	}
 	var v *viper.Viper
 	var cmd = &cobra.Command{
-		Use:   "restore",
+		Use:   "restore [file|latest]",
 		Short: "restore a dump",
-		Long:  `Restore a database dump from a given location.`,
+		Long: `Restore a database dump from a given location.
+		The file to restore can be "latest", or omitted with --before, to restore the most recent backup in the target.
+		With --until or --until-gtid, the binary log archived to the target is replayed after the backup, to restore to a point in time.
+		`,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			bindFlags(cmd, v)
 		},
-		Args: cobra.MinimumNArgs(1),
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.Debug("starting restore")
-			targetFile := args[0]
 			target := v.GetString("target")
+			before, err := parseTime(v.GetString("before"), false)
+			if err != nil {
+				return fmt.Errorf("invalid before: %v", err)
+			}
+			until, err := parseTime(v.GetString("until"), true)
+			if err != nil {
+				return fmt.Errorf("invalid until: %v", err)
+			}
+			untilGTID := strings.TrimSpace(v.GetString("until-gtid"))
+			pointInTime := !until.IsZero() || untilGTID != ""
+			var targetFile string
+			switch {
+			case len(args) > 0:
+				targetFile = args[0]
+			case !before.IsZero(), pointInTime:
+				targetFile = core.LatestBackup
+			default:
+				return fmt.Errorf("requires the file to restore, or %s", core.LatestBackup)
+			}
+			if !before.IsZero() && targetFile != core.LatestBackup {
+				return fmt.Errorf("before can be used only to restore the %s backup, not %s", core.LatestBackup, targetFile)
+			}
+			skipGTIDs := nonEmpty(v.GetStringSlice("skip-gtid"))
+			if len(skipGTIDs) > 0 && !pointInTime {
+				return fmt.Errorf("skip-gtid can be used only with until or until-gtid")
+			}
 			// get databases namesand mappings
 			databasesMap := make(map[string]string)
 			databases := strings.TrimSpace(v.GetString("database"))
@@ -44,55 +77,85 @@ func restoreCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error
 				}
 			}
 
-			// compression algorithm: check config, then CLI/env var overrides
-			var (
-				compressionAlgo string
-				compressor      compression.Compressor
-				err             error
-			)
-			if cmdConfig.configuration != nil {
-				compressionAlgo = cmdConfig.configuration.Dump.Compression
+			// schemas and tables to restore, matched against their names in the backup, before any mapping
+			filter := database.RestoreFilter{
+				IncludeSchemas: nonEmpty(v.GetStringSlice("include-schema")),
+				ExcludeSchemas: nonEmpty(v.GetStringSlice("exclude-schema")),
+				IncludeTables:  nonEmpty(v.GetStringSlice("include-table")),
+				ExcludeTables:  nonEmpty(v.GetStringSlice("exclude-table")),
 			}
-			compressionVar := v.GetString("compression")
-			if compressionVar != "" {
-				compressionAlgo = compressionVar
+			if err := filter.Validate(); err != nil {
+				return err
 			}
+
+			// compression algorithm: only if overridden by CLI/env var, else it is detected from the file.
+			// The dump compression in the config file is not used, as the file may have been
+			// made with another.
+			var compressor compression.Compressor
+			compressionAlgo := v.GetString("compression")
 			if compressionAlgo != "" {
-				compressor, err = compression.GetCompressor(compressionAlgo)
+				compressor, err = compression.GetCompressor(compressionAlgo, 0)
 				if err != nil {
 					return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
 				}
 			}
 
-			// target URL can reference one from the config file, or an absolute one
-			// if it's not in the config file, it's an absolute one
-			// if it is in the config file, it's a reference to one of the targets in the config file
-			u, err := util.SmartParse(target)
+			// encryption: check config, then CLI/env var overrides. The type is detected from the key if not set.
+			encryption := v.GetString("encryption")
+			if !v.IsSet("encryption") && cmdConfig.configuration != nil {
+				encryption = cmdConfig.configuration.Restore.Encryption.Type
+			}
+			encryptionKey := v.GetString("encryption-key")
+			if !v.IsSet("encryption-key") && cmdConfig.configuration != nil {
+				encryptionKey = cmdConfig.configuration.Restore.Encryption.Key
+			}
+			decryptor, err := getDecryptor(encryption, encryptionKey)
 			if err != nil {
-				return fmt.Errorf("invalid target url: %v", err)
-			}
-			var store storage.Storage
-			if u.Scheme == "config" {
-				// get the target name
-				targetName := u.Host
-				// get the target from the config file
-				if cmdConfig.configuration == nil {
-					return fmt.Errorf("no configuration file found")
+				return err
+			}
+
+			store, err := parseTarget(target, cmdConfig)
+			if err != nil {
+				return err
+			}
+			parallelism := v.GetInt("parallelism")
+			if !v.IsSet("parallelism") && cmdConfig.configuration != nil && cmdConfig.configuration.Restore.Parallelism != 0 {
+				parallelism = cmdConfig.configuration.Restore.Parallelism
+			}
+			if parallelism < 1 {
+				return fmt.Errorf("parallelism must be at least 1, not %d", parallelism)
+			}
+			restoreOpts := core.RestoreOptions{
+				Target:       store,
+				TargetFile:   targetFile,
+				Before:       before,
+				DBConn:       cmdConfig.dbconn,
+				DatabasesMap: databasesMap,
+				Compressor:   compressor,
+				Decryptor:    decryptor,
+				Parallelism:  parallelism,
+				Filter:       filter,
+				Until:        until,
+				UntilGTID:    untilGTID,
+				SkipGTIDs:    skipGTIDs,
+			}
+			if pointInTime && len(databasesMap) > 0 {
+				return fmt.Errorf("database mappings cannot be used with until or until-gtid, which replay the binary log of the whole server")
+			}
+			if pointInTime && !filter.IsEmpty() {
+				return fmt.Errorf("schema and table filters cannot be used with until or until-gtid, which replay the binary log of the whole server")
+			}
+			if v.GetBool("drill") {
+				if pointInTime {
+					return fmt.Errorf("until and until-gtid cannot be used with drill")
 				}
-				if target, ok := cmdConfig.configuration.Targets[targetName]; !ok {
-					return fmt.Errorf("target %s not found in configuration", targetName)
-				} else {
-					if store, err = target.Storage.Storage(); err != nil {
-						return fmt.Errorf("error creating storage for target %s: %v", targetName, err)
-					}
+				if len(databasesMap) > 0 {
+					return fmt.Errorf("database mappings cannot be used with drill, which restores to scratch schemas")
 				}
-				// need to add the path to the specific target file
-			} else {
-				// parse the target URL
-				store, err = storage.ParseURL(target, cmdConfig.creds)
-				if err != nil {
-					return fmt.Errorf("invalid target url: %v", err)
+				if !filter.IsEmpty() {
+					return fmt.Errorf("schema and table filters cannot be used with drill, which restores the whole backup")
 				}
+				return runDrill(cmd, v, execs, cmdConfig, restoreOpts)
 			}
 			restore := core.Restore
 			if execs != nil {
@@ -100,7 +163,7 @@ func restoreCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error
 			}
 			// at this point, any errors should not have usage
 			cmd.SilenceUsage = true
-			if err := restore(store, targetFile, cmdConfig.dbconn, databasesMap, compressor); err != nil {
+			if err := restore(restoreOpts); err != nil {
 				return fmt.Errorf("error restoring: %v", err)
 			}
 			log.Info("Restore complete")
@@ -115,21 +178,182 @@ func restoreCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error
 
 	flags := cmd.Flags()
 	flags.String("target", "", "full URL target to the backup that you wish to restore")
+
+	// latest before
+	flags.String("before", "", "Restore the most recent backup made before this time, either RFC3339, e.g. `2024-01-02T15:04:05Z` or `2024-01-02T15:04Z`, or a date, e.g. `2024-01-02`. Implies restoring the latest backup.")
+
+	// point in time
+	flags.String("until", "", "Restore to a point in time: restore the most recent backup made before this time, then replay the binary log archived to the target up to it. Either RFC3339, e.g. `2024-01-02T15:04:05Z`, or a date, e.g. `2024-01-02`, for the end of that day. Requires backups made with `--source-data`.")
+	flags.String("until-gtid", "", "Restore to a transaction: restore the backup, then replay the binary log archived to the target up to and including the transaction with this GTID, e.g. `0-1-100` on MariaDB or `3e11fa47-71ca-11e1-9e33-c80aa9429562:23` on MySQL.")
+	flags.StringSlice("skip-gtid", []string{}, "GTIDs of transactions not to replay from the binary log, comma-separated, e.g. the one that dropped a table. Requires `--until` or `--until-gtid`.")
 	if err := cmd.MarkFlagRequired("target"); err != nil {
 		return nil, err
 	}
 
+	// encryption
+	flags.String("encryption", "", "Encryption of the backup file, overriding the encryption detected from the key. Supported are: `age`, `pgp`. Requires `--encryption-key`.")
+	flags.String("encryption-key", "", "File with the keys to decrypt the backup file with, if it is encrypted: for `age`, an identities file, with one identity per line; for `pgp`, one or more private keys, which must not be protected by a passphrase.")
+
 	// compression
-	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`")
+	flags.String("compression", "", "Compression of the backup file, overriding the compression detected from its contents and name. Supported are: `gzip`, `bzip2`, `zstd`, `xz`, `lz4`, `none`")
 
 	// specific database to which to restore
 	flags.String("database", "", "Mapping of from:to database names to which to restore, comma-separated, e.g. foo:bar,buz:qux. Replaces the `USE <database>` clauses in a backup file. If blank, uses the file as is.")
 
+	// schemas and tables to restore
+	flags.StringSlice("include-schema", []string{}, "Schemas to restore, comma-separated, as named in the backup; empty to restore all.")
+	flags.StringSlice("exclude-schema", []string{}, "Schemas not to restore, comma-separated, as named in the backup.")
+	flags.StringSlice("include-table", []string{}, "Tables to restore, comma-separated, as `schema.table`, named as in the backup; empty to restore all. Restores only those tables, their triggers and the statements that set up their schemas, not the other objects of the schemas, such as routines and events.")
+	flags.StringSlice("exclude-table", []string{}, "Tables not to restore, comma-separated, as `schema.table`, named as in the backup.")
+
 	// pre-restore scripts
 	flags.String("pre-restore-scripts", "", "Directory wherein any file ending in `.sh` will be run after retrieving the dump file but pre-restore.")
 
 	// post-restore scripts
 	flags.String("post-restore-scripts", "", "Directory wherein any file ending in `.sh` will be run post-restore.")
 
+	// drill
+	flags.Bool("drill", false, "Restore drill: restore the backup into scratch schemas, check the rows in each table against the manifest and run the drill queries, write a report, and then drop the scratch schemas. Runs on the schedule set by `--frequency`, `--begin`, `--cron` and `--once`.")
+	flags.StringArray("drill-query", []string{}, "Sanity query to run in a drill, as `<schema>:<query>`, e.g. `shop:SELECT COUNT(*) FROM orders`, run in the scratch schema to which the schema is restored. The schema may be blank, e.g. `:SELECT 1`. Accepts multiple queries. Passes as long as the query succeeds; to check its result, use the configuration file.")
+	flags.String("drill-report", "", "Directory in which to write the JSON report of each drill, named `drill_<timestamp>.json`. If blank, the report is written to stdout.")
+
+	// drill schedule, as for dump
+	flags.Int("frequency", defaultFrequency, "how often to run drills, in minutes")
+	flags.String("begin", defaultBegin, "What time to do the first drill. Must be in one of two formats: Absolute: HHMM, e.g. `2330` or `0415`; or Relative: +MM, i.e. how many minutes after starting the container, e.g. `+0` (immediate), `+10` (in 10 minutes), or `+90` in an hour and a half")
+	flags.String("cron", "", "Set the drill schedule using standard [crontab syntax](https://en.wikipedia.org/wiki/Cron), a single line.")
+	flags.Bool("once", false, "Override all other drill schedule settings and run the drill once immediately and exit.")
+
+	// parallelism
+	flags.Int("parallelism", defaultParallelism, "Number of files to restore at once, each on its own connection. Tables are restored first, then the views, triggers and other objects that depend on them.")
+
 	return cmd, nil
 }
+
+// nonEmpty make an empty slice nil, so it is consistent; used mainly for test consistency
+func nonEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+// getDecryptor get the decryptor for the encryption with the key in the file encryptionKey,
+// detecting the encryption from the key if it is not set. Returns nil if there is no key.
+func getDecryptor(encryption, encryptionKey string) (encrypt.Decryptor, error) {
+	if encryptionKey == "" {
+		if encryption != "" {
+			return nil, fmt.Errorf("encryption %s requires an encryption key", encryption)
+		}
+		return nil, nil
+	}
+	key, err := os.ReadFile(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key: %v", err)
+	}
+	decryptor, err := encrypt.GetDecryptor(encryption, key)
+	if err != nil {
+		return nil, fmt.Errorf("failure to get encryption '%s': %v", encryption, err)
+	}
+	return decryptor, nil
+}
+
+// runDrill runs restore drills of the backup, on the drill schedule
+func runDrill(cmd *cobra.Command, v *viper.Viper, execs execs, cmdConfig *cmdConfiguration, restoreOpts core.RestoreOptions) error {
+	var drillConfig config.Drill
+	if cmdConfig.configuration != nil {
+		drillConfig = cmdConfig.configuration.Restore.Drill
+	}
+	var queries []core.DrillQuery
+	// read from the flag itself, as viper would split each query on whitespace
+	queryFlags, err := cmd.Flags().GetStringArray("drill-query")
+	if err != nil {
+		return err
+	}
+	if len(queryFlags) > 0 {
+		for _, q := range queryFlags {
+			parts := strings.SplitN(q, ":", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+				return fmt.Errorf("invalid drill query, must be <schema>:<query>: %s", q)
+			}
+			queries = append(queries, core.DrillQuery{Schema: parts[0], Query: parts[1]})
+		}
+	} else {
+		for _, q := range drillConfig.Queries {
+			queries = append(queries, core.DrillQuery{Name: q.Name, Schema: q.Schema, Query: q.Query, Expect: q.Expect})
+		}
+	}
+	reportDir := v.GetString("drill-report")
+	if reportDir == "" {
+		reportDir = drillConfig.Report
+	}
+
+	// timer options
+	once := v.GetBool("once")
+	if !v.IsSet("once") {
+		once = drillConfig.Schedule.Once
+	}
+	cron := v.GetString("cron")
+	if cron == "" {
+		cron = drillConfig.Schedule.Cron
+	}
+	begin := v.GetString("begin")
+	if !v.IsSet("begin") && drillConfig.Schedule.Begin != "" {
+		begin = drillConfig.Schedule.Begin
+	}
+	frequency := v.GetInt("frequency")
+	if !v.IsSet("frequency") && drillConfig.Schedule.Frequency != 0 {
+		frequency = drillConfig.Schedule.Frequency
+	}
+	timerOpts := core.TimerOptions{
+		Once:      once,
+		Cron:      cron,
+		Begin:     begin,
+		Frequency: frequency,
+	}
+
+	drill := core.Drill
+	timer := core.TimerCommand
+	if execs != nil {
+		drill = execs.drill
+		timer = execs.timer
+	}
+	// at this point, any errors should not have usage
+	cmd.SilenceUsage = true
+	if err := timer(timerOpts, func() error {
+		report, err := drill(core.DrillOptions{Restore: restoreOpts, Queries: queries})
+		if report != nil {
+			if werr := writeDrillReport(cmd.OutOrStdout(), reportDir, report); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error running drill: %w", err)
+		}
+		log.Info("Restore drill passed")
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error running command: %w", err)
+	}
+	return nil
+}
+
+// writeDrillReport writes the report of a drill as JSON, to a file named for the time
+// of the drill in dir, or to out if dir is blank
+func writeDrillReport(out io.Writer, dir string, report *core.DrillReport) error {
+	if dir != "" {
+		name := filepath.Join(dir, fmt.Sprintf("drill_%s.json", report.Start.Format("20060102T150405Z")))
+		f, err := os.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to create drill report: %v", err)
+		}
+		defer f.Close()
+		out = f
+		log.Infof("writing drill report to %s", name)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("failed to write drill report: %v", err)
+	}
+	return nil
+}
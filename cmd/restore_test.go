@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"bytes"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-test/deep"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/file"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestRestoreCmd(t *testing.T) {
@@ -16,31 +24,205 @@ func TestRestoreCmd(t *testing.T) {
 	fileTarget := "file:///foo/bar"
 	fileTargetURL, _ := url.Parse(fileTarget)
 
+	tests := []struct {
+		name                   string
+		args                   []string // "restore" will be prepended automatically
+		config                 string
+		wantErr                bool
+		expectedRestoreOptions core.RestoreOptions
+	}{
+		{"missing server and target options", []string{""}, "", true, core.RestoreOptions{}},
+		{"invalid target URL", []string{"--server", "abc", "--target", "def"}, "", true, core.RestoreOptions{}},
+		{"valid URL missing dump filename", []string{"--server", "abc", "--target", "file:///foo/bar"}, "", true, core.RestoreOptions{}},
+		{"valid file URL", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--verbose", "2"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+		}},
+		{"parallelism", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--parallelism", "4"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  4,
+		}},
+		{"compression override", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--compression", "zstd"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Compressor:   &compression.ZstdCompressor{},
+			Parallelism:  defaultParallelism,
+		}},
+		{"encryption key", []string{"--server", "abc", "--target", fileTarget, "filename.tgz.age", "--encryption-key", "testdata/age-identity.txt"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz.age",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Decryptor:    &encrypt.AgeDecryptor{},
+			Parallelism:  defaultParallelism,
+		}},
+		{"encryption key of wrong type", []string{"--server", "abc", "--target", fileTarget, "filename.tgz.age", "--encryption", "pgp", "--encryption-key", "testdata/age-identity.txt"}, "", true, core.RestoreOptions{}},
+		{"encryption without key", []string{"--server", "abc", "--target", fileTarget, "filename.tgz.age", "--encryption", "age"}, "", true, core.RestoreOptions{}},
+		{"invalid compression", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--compression", "rar"}, "", true, core.RestoreOptions{}},
+		{"invalid parallelism", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--parallelism", "0"}, "", true, core.RestoreOptions{}},
+		{"latest", []string{"--server", "abc", "--target", fileTarget, "latest"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   core.LatestBackup,
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+		}},
+		{"latest before", []string{"--server", "abc", "--target", fileTarget, "--before", "2026-10-01T00:00Z"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   core.LatestBackup,
+			Before:       time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+		}},
+		{"latest before date", []string{"--server", "abc", "--target", fileTarget, "latest", "--before", "2026-10-01"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   core.LatestBackup,
+			Before:       time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+		}},
+		{"before with filename", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--before", "2026-10-01"}, "", true, core.RestoreOptions{}},
+		{"invalid before", []string{"--server", "abc", "--target", fileTarget, "--before", "last week"}, "", true, core.RestoreOptions{}},
+		{"until", []string{"--server", "abc", "--target", fileTarget, "--until", "2026-10-01T12:30:00Z", "--skip-gtid", "0-1-100,0-1-101"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   core.LatestBackup,
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+			Until:        time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC),
+			SkipGTIDs:    []string{"0-1-100", "0-1-101"},
+		}},
+		{"until gtid with filename", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--until-gtid", "0-1-200"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+			UntilGTID:    "0-1-200",
+		}},
+		{"invalid until", []string{"--server", "abc", "--target", fileTarget, "--until", "yesterday"}, "", true, core.RestoreOptions{}},
+		{"skip gtid without until", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--skip-gtid", "0-1-100"}, "", true, core.RestoreOptions{}},
+		{"until with database mapping", []string{"--server", "abc", "--target", fileTarget, "--until", "2026-10-01", "--database", "shop:shop_restored"}, "", true, core.RestoreOptions{}},
+		{"until with filter", []string{"--server", "abc", "--target", fileTarget, "--until", "2026-10-01", "--include-schema", "shop"}, "", true, core.RestoreOptions{}},
+		{"include table into renamed schema", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--include-table", "shop.orders", "--database", "shop:shop_restored"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{"shop": "shop_restored"},
+			Parallelism:  defaultParallelism,
+			Filter:       database.RestoreFilter{IncludeTables: []string{"shop.orders"}},
+		}},
+		{"include and exclude schemas", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--include-schema", "shop,crm", "--exclude-schema", "crm", "--exclude-table", "shop.audit"}, "", false, core.RestoreOptions{
+			Target:       file.New(*fileTargetURL),
+			TargetFile:   "filename.tgz",
+			DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+			DatabasesMap: map[string]string{},
+			Parallelism:  defaultParallelism,
+			Filter: database.RestoreFilter{
+				IncludeSchemas: []string{"shop", "crm"},
+				ExcludeSchemas: []string{"crm"},
+				ExcludeTables:  []string{"shop.audit"},
+			},
+		}},
+		{"invalid include table", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--include-table", "orders"}, "", true, core.RestoreOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("restore", mock.MatchedBy(func(restoreOpts core.RestoreOptions) bool {
+				diff := deep.Equal(restoreOpts, tt.expectedRestoreOptions)
+				if diff == nil {
+					return true
+				}
+				t.Errorf("restoreOpts compare failed: %v", diff)
+				return false
+			})).Return(nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetArgs(append([]string{"restore"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+
+		})
+	}
+}
+
+func TestRestoreDrillCmd(t *testing.T) {
+	t.Parallel()
+
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+	restoreOpts := core.RestoreOptions{
+		Target:       file.New(*fileTargetURL),
+		TargetFile:   "filename.tgz",
+		DBConn:       database.Connection{Host: "abc", Port: defaultPort},
+		DatabasesMap: map[string]string{},
+		Parallelism:  defaultParallelism,
+	}
+	configRestoreOpts := restoreOpts
+	configRestoreOpts.DBConn = database.Connection{Host: "abc", Port: defaultPort, User: "user2", Pass: "xxxx2"}
+	reportDir := t.TempDir()
+
 	tests := []struct {
 		name                 string
 		args                 []string // "restore" will be prepended automatically
-		config               string
 		wantErr              bool
-		expectedTarget       storage.Storage
-		expectedTargetFile   string
-		expectedDbconn       database.Connection
-		expectedDatabasesMap map[string]string
-		expectedCompressor   compression.Compressor
+		expectedDrillOptions core.DrillOptions
+		expectedTimerOptions core.TimerOptions
+		reportDir            string
 	}{
-		{"missing server and target options", []string{""}, "", true, nil, "", database.Connection{}, nil, &compression.GzipCompressor{}},
-		{"invalid target URL", []string{"--server", "abc", "--target", "def"}, "", true, nil, "", database.Connection{Host: "abc"}, nil, &compression.GzipCompressor{}},
-		{"valid URL missing dump filename", []string{"--server", "abc", "--target", "file:///foo/bar"}, "", true, nil, "", database.Connection{Host: "abc"}, nil, &compression.GzipCompressor{}},
-		{"valid file URL", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--verbose", "2"}, "", false, file.New(*fileTargetURL), "filename.tgz", database.Connection{Host: "abc", Port: defaultPort}, map[string]string{}, &compression.GzipCompressor{}},
+		{"drill", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--drill", "--once"}, false, core.DrillOptions{Restore: restoreOpts}, core.TimerOptions{Once: true, Frequency: defaultFrequency, Begin: defaultBegin}, ""},
+		{"queries", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--drill", "--drill-query", "shop:SELECT COUNT(*) FROM orders, customers", "--drill-query", ":SELECT 1"}, false, core.DrillOptions{
+			Restore: restoreOpts,
+			Queries: []core.DrillQuery{{Schema: "shop", Query: "SELECT COUNT(*) FROM orders, customers"}, {Query: "SELECT 1"}},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, ""},
+		{"config file", []string{"--config-file", "testdata/drill.yml", "--server", "abc", "--target", "config://local", "filename.tgz", "--drill", "--drill-report", reportDir}, false, core.DrillOptions{
+			Restore: configRestoreOpts,
+			Queries: []core.DrillQuery{{Name: "orders", Schema: "shop", Query: "SELECT COUNT(*) > 0 FROM orders", Expect: "1"}},
+		}, core.TimerOptions{Cron: "0 3 1 * *", Frequency: defaultFrequency, Begin: defaultBegin}, reportDir},
+		{"invalid query", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--drill", "--drill-query", "SELECT 1"}, true, core.DrillOptions{}, core.TimerOptions{}, ""},
+		{"database mapping", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--drill", "--database", "a:b"}, true, core.DrillOptions{}, core.TimerOptions{}, ""},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			report := &core.DrillReport{Target: fileTarget, File: "filename.tgz", Start: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Passed: true}
 			m := newMockExecs()
-			m.On("restore", tt.expectedTarget, tt.expectedTargetFile, tt.expectedDbconn, tt.expectedDatabasesMap, tt.expectedCompressor).Return(nil)
+			m.On("drill", mock.MatchedBy(func(drillOpts core.DrillOptions) bool {
+				diff := deep.Equal(drillOpts, tt.expectedDrillOptions)
+				if diff == nil {
+					return true
+				}
+				t.Errorf("drillOpts compare failed: %v", diff)
+				return false
+			})).Return(report, nil)
+			m.On("timer", tt.expectedTimerOptions).Return(nil)
 			cmd, err := rootCmd(m)
 			if err != nil {
 				t.Fatal(err)
 			}
+			var out bytes.Buffer
+			cmd.SetOut(&out)
 			cmd.SetArgs(append([]string{"restore"}, tt.args...))
 			err = cmd.Execute()
 			switch {
@@ -50,8 +232,14 @@ func TestRestoreCmd(t *testing.T) {
 				t.Fatal(err)
 			case err == nil:
 				m.AssertExpectations(t)
+				if tt.reportDir != "" {
+					if _, err := os.Stat(filepath.Join(tt.reportDir, "drill_20240102T030405Z.json")); err != nil {
+						t.Errorf("missing report: %v", err)
+					}
+				} else if !strings.Contains(out.String(), `"passed": true`) {
+					t.Errorf("report not written: %s", out.String())
+				}
 			}
-
 		})
 	}
 }
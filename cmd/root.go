@@ -1,16 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
 
-	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/config"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -19,14 +20,18 @@ import (
 
 type execs interface {
 	dump(opts core.DumpOptions) error
-	restore(target storage.Storage, targetFile string, dbconn database.Connection, databasesMap map[string]string, compressor compression.Compressor) error
-	prune(opts core.PruneOptions) error
+	restore(opts core.RestoreOptions) error
+	drill(opts core.DrillOptions) (*core.DrillReport, error)
+	prune(opts core.PruneOptions) (*core.PruneResult, error)
+	list(opts core.ListOptions) ([]core.Backup, error)
+	verify(opts core.VerifyOptions) (*core.VerifyResult, error)
+	binlog(ctx context.Context, opts core.BinlogOptions) error
 	timer(timerOpts core.TimerOptions, cmd func() error) error
 }
 
 type subCommand func(execs, *cmdConfiguration) (*cobra.Command, error)
 
-var subCommands = []subCommand{dumpCmd, restoreCmd, pruneCmd}
+var subCommands = []subCommand{dumpCmd, restoreCmd, pruneCmd, listCmd, verifyCmd, binlogCmd}
 
 type cmdConfiguration struct {
 	dbconn        database.Connection
@@ -195,10 +200,13 @@ func bindFlags(cmd *cobra.Command, v *viper.Viper) {
 		// Determine the naming convention of the flags when represented in the config file
 		configName := f.Name
 		_ = v.BindPFlag(configName, f)
-		// Apply the viper config value to the flag when the flag is not set and viper has a value
+		// Apply the viper config value to the flag when the flag is not set and viper has a value,
+		// other than the default of the flag itself, which would add it again to slice flags
 		if !f.Changed && v.IsSet(configName) {
-			val := v.Get(configName)
-			_ = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+			val := fmt.Sprintf("%v", v.Get(configName))
+			if val != f.DefValue {
+				_ = cmd.Flags().Set(f.Name, val)
+			}
 		}
 	})
 }
@@ -213,3 +221,33 @@ func Execute() {
 		log.Fatal(err)
 	}
 }
+
+// parseTarget get the storage for a target URL, which can reference one from the config file,
+// e.g. config://targetname, or be an absolute one
+func parseTarget(target string, cmdConfig *cmdConfiguration) (storage.Storage, error) {
+	u, err := util.SmartParse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target url: %v", err)
+	}
+	if u.Scheme != "config" {
+		store, err := storage.ParseURL(target, cmdConfig.creds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target url: %v", err)
+		}
+		return store, nil
+	}
+	// it is a reference to one of the targets in the config file
+	targetName := u.Host
+	if cmdConfig.configuration == nil {
+		return nil, fmt.Errorf("no configuration file found")
+	}
+	t, ok := cmdConfig.configuration.Targets[targetName]
+	if !ok {
+		return nil, fmt.Errorf("target %s not found in configuration", targetName)
+	}
+	store, err := t.Storage.Storage()
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage for target %s: %v", targetName, err)
+	}
+	return store, nil
+}
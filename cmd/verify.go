@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+)
+
+func verifyCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:   "verify",
+		Short: "verify a dump",
+		Long: `Verify that a database dump can be restored, without restoring it.
+		Pulls the dump, decrypts, uncompresses and extracts it, checks its files against the checksums in its manifest,
+		if it has one, and parses every statement in it. Reports the statements and rows in each schema, and exits with
+		an error if there are any problems.
+		`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("starting verify")
+			targetFile := args[0]
+
+			// compression algorithm: only if overridden by CLI/env var, else it is detected from the file
+			var (
+				compressor compression.Compressor
+				err        error
+			)
+			compressionAlgo := v.GetString("compression")
+			if compressionAlgo != "" {
+				compressor, err = compression.GetCompressor(compressionAlgo, 0)
+				if err != nil {
+					return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+				}
+			}
+
+			// encryption: as for restore, check config, then CLI/env var overrides
+			encryption := v.GetString("encryption")
+			if !v.IsSet("encryption") && cmdConfig.configuration != nil {
+				encryption = cmdConfig.configuration.Restore.Encryption.Type
+			}
+			encryptionKey := v.GetString("encryption-key")
+			if !v.IsSet("encryption-key") && cmdConfig.configuration != nil {
+				encryptionKey = cmdConfig.configuration.Restore.Encryption.Key
+			}
+			decryptor, err := getDecryptor(encryption, encryptionKey)
+			if err != nil {
+				return err
+			}
+
+			store, err := parseTarget(v.GetString("target"), cmdConfig)
+			if err != nil {
+				return err
+			}
+			verifyOpts := core.VerifyOptions{
+				Target:     store,
+				TargetFile: targetFile,
+				Compressor: compressor,
+				Decryptor:  decryptor,
+			}
+			verify := core.Verify
+			if execs != nil {
+				verify = execs.verify
+			}
+			// at this point, any errors should not have usage
+			cmd.SilenceUsage = true
+			result, err := verify(verifyOpts)
+			if result != nil {
+				if werr := writeVerifyResult(cmd.OutOrStdout(), result); werr != nil {
+					return werr
+				}
+			}
+			switch {
+			case errors.Is(err, core.ErrVerifyFailed):
+				return fmt.Errorf("%s failed verification with %d problems", targetFile, len(result.Problems))
+			case err != nil:
+				return fmt.Errorf("error verifying: %v", err)
+			}
+			log.Info("Verify complete")
+			return nil
+		},
+	}
+	// target - where the backup is
+	v = viper.New()
+	v.SetEnvPrefix("db_verify")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	flags.String("target", "", "full URL target to the directory of the backup that you wish to verify. Can be a file URL, or a reference to a target in the configuration file, e.g. `config://targetname`.")
+	if err := cmd.MarkFlagRequired("target"); err != nil {
+		return nil, err
+	}
+
+	// encryption
+	flags.String("encryption", "", "Encryption of the backup file, overriding the encryption detected from the key. Supported are: `age`, `pgp`. Requires `--encryption-key`.")
+	flags.String("encryption-key", "", "File with the keys to decrypt the backup file with, if it is encrypted: for `age`, an identities file, with one identity per line; for `pgp`, one or more private keys, which must not be protected by a passphrase.")
+
+	// compression
+	flags.String("compression", "", "Compression of the backup file, overriding the compression detected from its contents and name. Supported are: `gzip`, `bzip2`, `zstd`, `xz`, `lz4`, `none`")
+
+	return cmd, nil
+}
+
+// writeVerifyResult writes the report of a verify
+func writeVerifyResult(out io.Writer, result *core.VerifyResult) error {
+	manifest := "none"
+	if result.Manifest {
+		manifest = "checked"
+	}
+	fmt.Fprintf(out, "files: %d, manifest: %s\n\n", result.Files, manifest)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEMA\tSTATEMENTS\tROWS")
+	for _, s := range result.Schemas {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", s.Name, s.Statements, s.Rows)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(result.Problems) > 0 {
+		fmt.Fprintf(out, "\nproblems:\n")
+		for _, p := range result.Problems {
+			fmt.Fprintf(out, "  %s\n", p)
+		}
+	}
+	return nil
+}
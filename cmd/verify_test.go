@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/file"
+)
+
+func TestVerifyCmd(t *testing.T) {
+	t.Parallel()
+
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+	valid := &core.VerifyResult{Manifest: true, Files: 1, Schemas: []core.SchemaVerification{{Name: "app", Statements: 10, Rows: 100}}}
+	failed := &core.VerifyResult{Files: 1, Problems: []string{"app.sql: checksum mismatch"}}
+
+	tests := []struct {
+		name                  string
+		args                  []string // "verify" will be prepended automatically
+		wantErr               bool
+		expectedVerifyOptions core.VerifyOptions
+		result                *core.VerifyResult
+		resultErr             error
+		expectedOutput        []string
+	}{
+		{"missing target", []string{"filename.tgz"}, true, core.VerifyOptions{}, nil, nil, nil},
+		{"missing dump filename", []string{"--target", fileTarget}, true, core.VerifyOptions{}, nil, nil, nil},
+		{"invalid target URL", []string{"--target", "def", "filename.tgz"}, true, core.VerifyOptions{}, nil, nil, nil},
+		{"valid file URL", []string{"--target", fileTarget, "filename.tgz"}, false, core.VerifyOptions{
+			Target:     file.New(*fileTargetURL),
+			TargetFile: "filename.tgz",
+		}, valid, nil, []string{"manifest: checked", "app", "100"}},
+		{"compression override", []string{"--target", fileTarget, "filename.tgz", "--compression", "zstd"}, false, core.VerifyOptions{
+			Target:     file.New(*fileTargetURL),
+			TargetFile: "filename.tgz",
+			Compressor: &compression.ZstdCompressor{},
+		}, valid, nil, nil},
+		{"encryption key", []string{"--target", fileTarget, "filename.tgz.age", "--encryption-key", "testdata/age-identity.txt"}, false, core.VerifyOptions{
+			Target:     file.New(*fileTargetURL),
+			TargetFile: "filename.tgz.age",
+			Decryptor:  &encrypt.AgeDecryptor{},
+		}, valid, nil, nil},
+		{"encryption without key", []string{"--target", fileTarget, "filename.tgz.age", "--encryption", "age"}, true, core.VerifyOptions{}, nil, nil, nil},
+		{"failed verification", []string{"--target", fileTarget, "filename.tgz"}, true, core.VerifyOptions{
+			Target:     file.New(*fileTargetURL),
+			TargetFile: "filename.tgz",
+		}, failed, core.ErrVerifyFailed, []string{"problems:", "app.sql: checksum mismatch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("verify", mock.MatchedBy(func(verifyOpts core.VerifyOptions) bool {
+				diff := deep.Equal(verifyOpts, tt.expectedVerifyOptions)
+				if diff == nil {
+					return true
+				}
+				t.Errorf("verifyOpts compare failed: %v", diff)
+				return false
+			})).Return(tt.result, tt.resultErr)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs(append([]string{"verify"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			}
+			if tt.result != nil {
+				m.AssertExpectations(t)
+			}
+			for _, s := range tt.expectedOutput {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("output missing %q: %s", s, out.String())
+				}
+			}
+		})
+	}
+}
@@ -22,10 +22,16 @@ require (
 )
 
 require (
+	filippo.io/age v1.1.1
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/ProtonMail/go-crypto v1.0.0
 	github.com/aws/aws-sdk-go-v2/credentials v1.13.29
 	github.com/cloudsoda/go-smb2 v0.0.0-20231106205947-b0758ecc4c67
 	github.com/dsnet/compress v0.0.1
 	github.com/go-test/deep v1.1.0
+	github.com/klauspost/compress v1.17.11
+	github.com/pierrec/lz4/v4 v4.1.21
+	github.com/ulikunitz/xz v0.5.12
 )
 
 require (
@@ -45,6 +51,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.14.14 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.20.1 // indirect
 	github.com/aws/smithy-go v1.13.5 // indirect
+	github.com/cloudflare/circl v1.3.3 // indirect
 	github.com/containerd/containerd v1.7.11 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/docker/distribution v2.8.2+incompatible // indirect
@@ -55,7 +62,6 @@ require (
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/klauspost/compress v1.16.5 // indirect
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/magiconair/properties v1.8.1 // indirect
 	github.com/mitchellh/mapstructure v1.1.2 // indirect
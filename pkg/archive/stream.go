@@ -0,0 +1,227 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPartSize the size at which a file written to a StreamWriter is split into another part
+const DefaultPartSize = 16 * 1024 * 1024
+
+// partSuffix the suffix of each part of a file that was split by a StreamWriter
+var partSuffix = regexp.MustCompile(`\.part(\d{6})$`)
+
+// StreamWriter writes files to a tar archive as they are generated, without knowing their
+// size in advance and without staging them on disk. A tar header must give the size of its
+// file, so each file is buffered in memory up to the part size; a file that grows beyond that
+// is written as a series of parts, named <name>.part000000, <name>.part000001 and so on,
+// which Untar joins back together. A file that fits within a single part keeps its name.
+//
+// Files may be written concurrently; the parts of different files then may be interleaved
+// in the archive, but the parts of each file always are in order.
+type StreamWriter struct {
+	tw       *tar.Writer
+	mu       sync.Mutex
+	partSize int
+	err      error
+}
+
+// NewStreamWriter creates a StreamWriter writing the archive to w. A partSize of 0 uses DefaultPartSize.
+func NewStreamWriter(w io.Writer, partSize int) *StreamWriter {
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	return &StreamWriter{
+		tw:       tar.NewWriter(w),
+		partSize: partSize,
+	}
+}
+
+// Create starts a new file in the archive. It is written to the archive as it is filled,
+// and completed by closing it.
+func (s *StreamWriter) Create(name string) io.WriteCloser {
+	return &streamEntry{s: s, name: name}
+}
+
+// Close completes the archive. It does not close the underlying writer, and any files
+// that are still open are not included.
+func (s *StreamWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.tw.Close()
+}
+
+// writeEntry writes a single entry to the archive
+func (s *StreamWriter) writeEntry(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := s.tw.WriteHeader(header); err != nil {
+		s.err = err
+		return err
+	}
+	if _, err := s.tw.Write(data); err != nil {
+		s.err = err
+		return err
+	}
+	return nil
+}
+
+// streamEntry a single file being written to a StreamWriter
+type streamEntry struct {
+	s      *StreamWriter
+	name   string
+	buf    bytes.Buffer
+	part   int
+	closed bool
+}
+
+func (e *streamEntry) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, fmt.Errorf("write to closed archive file %s", e.name)
+	}
+	n, _ := e.buf.Write(p)
+	if e.buf.Len() >= e.s.partSize {
+		if err := e.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (e *streamEntry) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	// a file that fits in a single part keeps its own name
+	if e.part == 0 {
+		return e.s.writeEntry(e.name, e.buf.Bytes())
+	}
+	if e.buf.Len() == 0 {
+		return nil
+	}
+	return e.flush()
+}
+
+// flush writes the buffer to the archive as the next part
+func (e *streamEntry) flush() error {
+	if err := e.s.writeEntry(fmt.Sprintf("%s.part%06d", e.name, e.part), e.buf.Bytes()); err != nil {
+		return err
+	}
+	e.part++
+	e.buf.Reset()
+	return nil
+}
+
+// partName splits the name of an entry written by a StreamWriter into the name of the file,
+// and which part of it this is. An entry that is not a part is the whole file, part 0.
+func partName(name string) (string, int) {
+	match := partSuffix.FindStringSubmatchIndex(name)
+	if match == nil {
+		return name, 0
+	}
+	part, err := strconv.Atoi(name[match[2]:match[3]])
+	if err != nil {
+		return name, 0
+	}
+	return name[:match[0]], part
+}
+
+// ErrPartOutOfOrder a part of a file was not immediately preceded in the archive by the part
+// before it, as happens when several files are written to a StreamWriter at once
+var ErrPartOutOfOrder = errors.New("file part out of order")
+
+// StreamReader reads the files in a tar archive one after another, directly from the stream,
+// joining back together the parts of each file that was split by a StreamWriter. This requires
+// that the parts of each file follow one another in the archive; if they do not, Untar must
+// be used instead.
+type StreamReader struct {
+	tr      *tar.Reader
+	pending *tar.Header
+	name    string
+	part    int
+	done    bool
+}
+
+// NewStreamReader creates a StreamReader reading the archive from r
+func NewStreamReader(r io.Reader) *StreamReader {
+	return &StreamReader{tr: tar.NewReader(r), done: true}
+}
+
+// Next advances to the next file in the archive, returning its name, or io.EOF at the end of
+// the archive. Whatever remains unread of the current file is skipped.
+func (s *StreamReader) Next() (string, error) {
+	if !s.done {
+		if _, err := io.Copy(io.Discard, s); err != nil {
+			return "", err
+		}
+	}
+	for {
+		header := s.pending
+		s.pending = nil
+		if header == nil {
+			var err error
+			if header, err = s.tr.Next(); err != nil {
+				return "", err
+			}
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, part := partName(header.Name)
+		if part != 0 {
+			return "", fmt.Errorf("%w: part %d of %s is not preceded by part %d", ErrPartOutOfOrder, part, name, part-1)
+		}
+		s.name, s.part, s.done = name, 0, false
+		return name, nil
+	}
+}
+
+// Read reads from the current file, continuing through each of its parts
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for !s.done {
+		n, err := s.tr.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		// the end of this entry; is the next one the next part of the same file?
+		header, err := s.tr.Next()
+		switch {
+		case err == io.EOF:
+			s.done = true
+		case err != nil:
+			return n, err
+		default:
+			if name, part := partName(header.Name); header.Typeflag == tar.TypeReg && name == s.name && part == s.part+1 {
+				s.part = part
+			} else {
+				s.pending = header
+				s.done = true
+			}
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,186 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	sw := NewStreamWriter(&buf, 10)
+
+	small := sw.Create("small.sql")
+	large := sw.Create("dir/large.sql")
+	exact := sw.Create("exact.sql")
+	empty := sw.Create("empty.sql")
+	// interleave the writes, as concurrent dumps would
+	for _, w := range []struct {
+		w    io.Writer
+		data string
+	}{
+		{large, "0123456"},
+		{small, "abc"},
+		{large, "789abcdef"},
+		{exact, "0123456789"},
+		{large, "ghij"},
+		{large, "k"},
+	} {
+		if _, err := w.w.Write([]byte(w.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []io.Closer{small, large, exact, empty} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check the entries in the archive itself; a file is only written once it fills a part, or is closed
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	expectedNames := []string{
+		"dir/large.sql.part000000",
+		"exact.sql.part000000",
+		"small.sql",
+		"dir/large.sql.part000001",
+		"empty.sql",
+	}
+	if diff := deep.Equal(names, expectedNames); diff != nil {
+		t.Errorf("mismatched entries: %v", diff)
+	}
+
+	// and that untar joins the parts back together
+	dir := t.TempDir()
+	if err := Untar(bytes.NewReader(buf.Bytes()), dir); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"small.sql":     "abc",
+		"dir/large.sql": "0123456789abcdefghijk",
+		"exact.sql":     "0123456789",
+		"empty.sql":     "",
+	}
+	for name, content := range expected {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("reading %s: %v", name, err)
+			continue
+		}
+		if string(b) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, string(b))
+		}
+	}
+}
+
+func TestStreamReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		writes   []int
+		expected []string
+		err      error
+	}{
+		{"sequential", []string{"a.sql", "dir/b.sql", "c.sql"}, []int{0, 1, 1, 1, 2}, []string{"a.sql", "dir/b.sql", "c.sql"}, nil},
+		{"interleaved", []string{"a.sql", "b.sql"}, []int{0, 1, 0, 0}, []string{"a.sql", "b.sql"}, ErrPartOutOfOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			sw := NewStreamWriter(&buf, 10)
+			writers := make([]io.WriteCloser, 0, len(tt.files))
+			for _, f := range tt.files {
+				writers = append(writers, sw.Create(f))
+			}
+			// each write fills a whole part, so the file after it is written in several
+			contents := make(map[string]string)
+			for i, w := range tt.writes {
+				data := fmt.Sprintf("%s-%08d", tt.files[w][:1], i)
+				if _, err := writers[w].Write([]byte(data)); err != nil {
+					t.Fatal(err)
+				}
+				contents[tt.files[w]] += data
+			}
+			for _, w := range writers {
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				names   []string
+				nexterr error
+			)
+			sr := NewStreamReader(bytes.NewReader(buf.Bytes()))
+			for {
+				var name string
+				name, nexterr = sr.Next()
+				if nexterr == io.EOF {
+					nexterr = nil
+					break
+				}
+				if nexterr != nil {
+					break
+				}
+				b, err := io.ReadAll(sr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// a file whose parts are out of order is cut short at the first of them
+				if tt.err == nil && string(b) != contents[name] {
+					t.Errorf("%s: expected %q, got %q", name, contents[name], string(b))
+				}
+				names = append(names, name)
+			}
+			if !errors.Is(nexterr, tt.err) {
+				t.Errorf("mismatched error, expected %v, got %v", tt.err, nexterr)
+			}
+			if diff := deep.Equal(names, tt.expected); diff != nil {
+				t.Errorf("mismatched files: %v", diff)
+			}
+		})
+	}
+}
+
+func TestPartName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		part     int
+	}{
+		{"a.sql", "a.sql", 0},
+		{"a.sql.part000000", "a.sql", 0},
+		{"dir/a.sql.part000012", "dir/a.sql", 12},
+		{"a.sql.part12", "a.sql.part12", 0},
+		{"a.part000001.sql", "a.part000001.sql", 0},
+	}
+	for _, tt := range tests {
+		name, part := partName(tt.name)
+		if name != tt.expected || part != tt.part {
+			t.Errorf("%s: expected %s part %d, got %s part %d", tt.name, tt.expected, tt.part, name, part)
+		}
+	}
+}
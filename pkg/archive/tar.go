@@ -9,7 +9,10 @@ import (
 	"strings"
 )
 
-func Tar(src string, writer io.WriteCloser) error {
+// Tar writes the files in src to an archive in writer, and closes it. The files named in
+// first, relative to src, are written at the start of the archive, so that they can be read
+// without reading the rest of it; the others follow in order of name.
+func Tar(src string, writer io.WriteCloser, first ...string) error {
 
 	// ensure the src actually exists before trying to tar it
 	if _, err := os.Stat(src); err != nil {
@@ -17,10 +20,33 @@ func Tar(src string, writer io.WriteCloser) error {
 	}
 
 	tw := tar.NewWriter(writer)
-	// defers are executed via a stack, so LIFO
-	// important we close the tw before the underlying writer
-	defer writer.Close()
-	defer tw.Close()
+	if err := tarFiles(tw, src, first); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	// the tar writer is closed before the underlying writer, and the errors of both returned,
+	// as closing the underlying writer may write the end of a compressed or encrypted stream
+	if err := tw.Close(); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// tarFiles writes the files in src to the archive, those named in first before the others
+func tarFiles(tw *tar.Writer, src string, first []string) error {
+	written := make(map[string]bool, len(first))
+	for _, name := range first {
+		file := filepath.Join(src, name)
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if err := tarFile(tw, src, file, fi); err != nil {
+			return err
+		}
+		written[file] = true
+	}
 
 	// walk path
 	return filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
@@ -31,41 +57,45 @@ func Tar(src string, writer io.WriteCloser) error {
 		}
 
 		// return on non-regular files (thanks to [kumo](https://medium.com/@komuw/just-like-you-did-fbdd7df829d3) for this suggested update)
-		if !fi.Mode().IsRegular() {
+		if !fi.Mode().IsRegular() || written[file] {
 			return nil
 		}
+		return tarFile(tw, src, file, fi)
+	})
+}
 
-		// create a new dir/file header
-		header, err := tar.FileInfoHeader(fi, fi.Name())
-		if err != nil {
-			return err
-		}
+// tarFile writes a single file, within src, to the archive
+func tarFile(tw *tar.Writer, src, file string, fi os.FileInfo) error {
+	// create a new dir/file header
+	header, err := tar.FileInfoHeader(fi, fi.Name())
+	if err != nil {
+		return err
+	}
 
-		// update the name to correctly reflect the desired destination when untaring
-		header.Name = strings.TrimPrefix(strings.Replace(file, src, "", -1), string(filepath.Separator))
+	// update the name to correctly reflect the desired destination when untaring
+	header.Name = strings.TrimPrefix(strings.Replace(file, src, "", -1), string(filepath.Separator))
 
-		// write the header
-		if err := tw.WriteHeader(header); err != nil {
-			return err
-		}
+	// write the header
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
 
-		// open files for taring
-		f, err := os.Open(file)
-		if err != nil {
-			return err
-		}
+	// open files for taring
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
 
-		// copy file data into tar writer
-		if _, err := io.Copy(tw, f); err != nil {
-			return err
-		}
+	// copy file data into tar writer
+	if _, err := io.Copy(tw, f); err != nil {
+		return err
+	}
 
-		// manually close here after each file operation; defering would cause each file close
-		// to wait until all operations have completed.
-		f.Close()
+	// manually close here after each file operation; defering would cause each file close
+	// to wait until all operations have completed.
+	f.Close()
 
-		return nil
-	})
+	return nil
 }
 
 func Untar(r io.Reader, dst string) error {
@@ -89,8 +119,10 @@ func Untar(r io.Reader, dst string) error {
 			continue
 		}
 
-		// the target location where the dir/file should be created
-		target := filepath.Join(dst, header.Name)
+		// the target location where the dir/file should be created; the parts of a
+		// file written by a StreamWriter are joined back together
+		name, part := partName(header.Name)
+		target := filepath.Join(dst, name)
 
 		// the following switch could also be done using fi.Mode(), not sure if there
 		// a benefit of using one vs. the other.
@@ -109,7 +141,15 @@ func Untar(r io.Reader, dst string) error {
 
 		// if it's a file create it
 		case tar.TypeReg:
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
+			// the archive does not necessarily include entries for the directories
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+			if part > 0 {
+				flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			}
+			f, err := os.OpenFile(target, flags, os.FileMode(header.Mode))
 			if err != nil {
 				return err
 			}
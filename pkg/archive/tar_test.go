@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// failingCloser a writer whose Close fails, as that of an encryptor does if it cannot write its end
+type failingCloser struct {
+	io.Writer
+	closed bool
+}
+
+func (f *failingCloser) Close() error {
+	f.closed = true
+	return errors.New("failed to close")
+}
+
+func TestTarFirst(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.sql", "b/t.sql", "manifest.json"} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := Tar(dir, nopWriteCloser{&buf}, "manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if diff := deep.Equal(names, []string{"manifest.json", "a.sql", "b/t.sql"}); diff != nil {
+		t.Errorf("mismatched entries: %v", diff)
+	}
+}
+
+func TestTarCloseError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.sql"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := &failingCloser{Writer: &buf}
+	if err := Tar(dir, w); err == nil {
+		t.Error("missing error from closing the writer")
+	}
+	if !w.closed {
+		t.Error("writer was not closed")
+	}
+}
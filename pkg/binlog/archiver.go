@@ -0,0 +1,199 @@
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Archiver splits the events of a binary log, as they are read from the server, into segments.
+// Each segment is written to a file in Dir, and handed to Complete once it is complete, after
+// which the file is removed. A segment is complete at the end of each binary log file, and,
+// before the next transaction starts, once it reaches MaxSize bytes or MaxAge old, if they are
+// set; at any of its Boundaries; or when the Archiver is flushed.
+type Archiver struct {
+	Dir     string
+	MaxSize int64
+	MaxAge  time.Duration
+	// Checksum whether the events end in a checksum
+	Checksum bool
+	// Boundaries positions at which a segment is completed, once an event ends at one of them, such
+	// as where the segments already archived to some targets, but not others, end, so that the
+	// segments of each target follow on from one another
+	Boundaries []Position
+	Complete   func(seg Segment, path string) error
+
+	pos     Position
+	fde     []byte
+	current *openSegment
+	// now the current time, replaced in tests
+	now func() time.Time
+}
+
+// openSegment a segment that is being written
+type openSegment struct {
+	Segment
+	f      *os.File
+	size   int64
+	events int
+	opened time.Time
+}
+
+// Start sets the position of the first event that will be added, which is where the dump of
+// the binary log was started
+func (a *Archiver) Start(pos Position) {
+	a.pos = pos
+}
+
+// Position the position in the binary log after the last event added
+func (a *Archiver) Position() Position {
+	return a.pos
+}
+
+// Add adds the next event of the binary log
+func (a *Archiver) Add(ev *Event) error {
+	h := ev.Header
+	switch h.Type {
+	case HeartbeatEvent, HeartbeatEventV2:
+		// the server is idle, so there is no transaction in progress, and the segment can be completed
+		if a.current != nil && a.MaxAge > 0 && a.clock().Sub(a.current.opened) >= a.MaxAge {
+			return a.Flush()
+		}
+		return nil
+	case FormatDescriptionEvent:
+		a.fde = ev.Raw
+		// one that is in the binary log starts a new file; otherwise, it is sent at the start of
+		// a dump from the middle of a file, and starts the segment
+		if h.LogPos == 0 {
+			return nil
+		}
+		if err := a.Flush(); err != nil {
+			return err
+		}
+		a.pos.Pos = uint64(h.LogPos) - uint64(h.Size)
+		if err := a.open(); err != nil {
+			return err
+		}
+		a.current.End = uint64(h.LogPos)
+		a.pos.Pos = uint64(h.LogPos)
+		return nil
+	case RotateEvent:
+		next, err := ev.Rotate(a.Checksum)
+		if err != nil {
+			return err
+		}
+		if h.Artificial() {
+			if a.current != nil && next.File != a.pos.File {
+				if err := a.Flush(); err != nil {
+					return err
+				}
+			}
+			a.pos = next
+			return nil
+		}
+		// the last event of the file
+		if err := a.write(ev); err != nil {
+			return err
+		}
+		a.current.EndOfFile = true
+		if err := a.Flush(); err != nil {
+			return err
+		}
+		a.pos = next
+		return nil
+	}
+	if h.Artificial() {
+		return nil
+	}
+	if ev.Transaction() && a.current != nil && a.current.events > 0 &&
+		((a.MaxSize > 0 && a.current.size >= a.MaxSize) || (a.MaxAge > 0 && a.clock().Sub(a.current.opened) >= a.MaxAge)) {
+		if err := a.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := a.write(ev); err != nil {
+		return err
+	}
+	// the server was shut down, and starts the next file when it is started again
+	if h.Type == stopEvent {
+		a.current.EndOfFile = true
+		return a.Flush()
+	}
+	if slices.Contains(a.Boundaries, a.pos) {
+		return a.Flush()
+	}
+	return nil
+}
+
+// Flush completes the segment being written, if it has any events
+func (a *Archiver) Flush() error {
+	seg := a.current
+	if seg == nil {
+		return nil
+	}
+	a.current = nil
+	defer os.Remove(seg.f.Name())
+	if err := seg.f.Close(); err != nil {
+		return fmt.Errorf("failed to write segment of binary log: %w", err)
+	}
+	if seg.events == 0 {
+		return nil
+	}
+	log.Debugf("completed segment of binary log %s from %d to %d", seg.File, seg.Start, seg.End)
+	return a.Complete(seg.Segment, seg.f.Name())
+}
+
+// write writes an event to the segment, starting one if there is none
+func (a *Archiver) write(ev *Event) error {
+	if a.current == nil {
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+	seg := a.current
+	if _, err := seg.f.Write(ev.Raw); err != nil {
+		return fmt.Errorf("failed to write segment of binary log: %w", err)
+	}
+	seg.size += int64(len(ev.Raw))
+	seg.events++
+	if seg.Time.IsZero() {
+		seg.Time = time.Unix(int64(ev.Header.Timestamp), 0).UTC()
+	}
+	a.pos.Pos = uint64(ev.Header.LogPos)
+	seg.End = a.pos.Pos
+	return nil
+}
+
+// open starts a segment at the current position, with the header of a binary log file
+func (a *Archiver) open() error {
+	if a.fde == nil {
+		return errors.New("no format description event before the first event of the binary log")
+	}
+	f, err := os.CreateTemp(a.Dir, "binlog-")
+	if err != nil {
+		return fmt.Errorf("failed to create segment of binary log: %w", err)
+	}
+	a.current = &openSegment{
+		Segment: Segment{File: a.pos.File, Start: a.pos.Pos, End: a.pos.Pos},
+		f:       f,
+		opened:  a.clock(),
+	}
+	for _, b := range [][]byte{Magic, a.fde} {
+		if _, err := f.Write(b); err != nil {
+			return fmt.Errorf("failed to write segment of binary log: %w", err)
+		}
+	}
+	a.current.size = int64(len(Magic) + len(a.fde))
+	return nil
+}
+
+func (a *Archiver) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
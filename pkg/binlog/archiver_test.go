@@ -0,0 +1,200 @@
+package binlog
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// binlogWriter makes the events of a binary log file, each ending where the next starts
+type binlogWriter struct {
+	pos uint32
+}
+
+func (w *binlogWriter) event(t *testing.T, typ EventType, timestamp uint32, body []byte) *Event {
+	t.Helper()
+	w.pos += uint32(HeaderSize + len(body))
+	ev, err := ParseEvent(makeEvent(typ, timestamp, w.pos, 0, body, false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func artificialRotate(t *testing.T, pos Position) *Event {
+	t.Helper()
+	ev, err := ParseEvent(makeEvent(RotateEvent, 0, 0, artificialFlag, rotateBody(pos), false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestArchiver(t *testing.T) {
+	const queryEvent EventType = 2
+	var (
+		segments []Segment
+		now      = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		fde      []byte
+	)
+	a := &Archiver{
+		Dir:     t.TempDir(),
+		MaxSize: 300,
+		MaxAge:  time.Minute,
+		Complete: func(seg Segment, path string) error {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			// every segment is a binary log file in its own right
+			if !bytes.HasPrefix(data, append(append([]byte{}, Magic...), fde...)) {
+				t.Errorf("segment %v does not start with the header of a binary log file", seg)
+			}
+			segments = append(segments, seg)
+			return nil
+		},
+		now: func() time.Time { return now },
+	}
+	add := func(ev *Event) {
+		t.Helper()
+		if err := a.Add(ev); err != nil {
+			t.Fatalf("failed to add event: %v", err)
+		}
+	}
+	transaction := func(w *binlogWriter, timestamp uint32) {
+		add(w.event(t, MariaDBGTIDEvent, timestamp, make([]byte, 20)))
+		add(w.event(t, queryEvent, timestamp, make([]byte, 100)))
+	}
+
+	a.Start(Position{File: "binlog.000001", Pos: 4})
+	w := &binlogWriter{pos: 4}
+	add(artificialRotate(t, Position{File: "binlog.000001", Pos: 4}))
+	fdeEvent := w.event(t, FormatDescriptionEvent, 1000, make([]byte, 50))
+	fde = fdeEvent.Raw
+	add(fdeEvent)
+	// the first segment reaches its maximum size after two transactions, so the third starts another
+	transaction(w, 1001)
+	transaction(w, 1002)
+	splitAt := w.pos
+	transaction(w, 1003)
+	if len(segments) != 1 {
+		t.Fatalf("%d segments after the maximum size, expected 1", len(segments))
+	}
+	// a heartbeat completes the segment once it is older than the maximum age
+	add(&Event{Header: EventHeader{Type: HeartbeatEvent}})
+	if len(segments) != 1 {
+		t.Fatalf("%d segments after a heartbeat, expected 1", len(segments))
+	}
+	now = now.Add(2 * time.Minute)
+	add(&Event{Header: EventHeader{Type: HeartbeatEvent}})
+	if len(segments) != 2 {
+		t.Fatalf("%d segments after the maximum age, expected 2", len(segments))
+	}
+	// the end of a file completes the segment, and the next file starts another
+	transaction(w, 1004)
+	add(w.event(t, RotateEvent, 1005, rotateBody(Position{File: "binlog.000002", Pos: 4})))
+	endOfFile := w.pos
+	w = &binlogWriter{pos: 4}
+	add(artificialRotate(t, Position{File: "binlog.000002", Pos: 4}))
+	fdeEvent = w.event(t, FormatDescriptionEvent, 1006, make([]byte, 50))
+	fde = fdeEvent.Raw
+	add(fdeEvent)
+	transaction(w, 1007)
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the size of each transaction
+	const txSize = 2*HeaderSize + 120
+	expected := []Segment{
+		{File: "binlog.000001", Start: 4, End: uint64(splitAt), Time: time.Unix(1001, 0).UTC()},
+		{File: "binlog.000001", Start: uint64(splitAt), End: uint64(splitAt) + txSize, Time: time.Unix(1003, 0).UTC()},
+		{File: "binlog.000001", Start: uint64(splitAt) + txSize, End: uint64(endOfFile), Time: time.Unix(1004, 0).UTC(), EndOfFile: true},
+		{File: "binlog.000002", Start: 4, End: uint64(w.pos), Time: time.Unix(1007, 0).UTC()},
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("%d segments, expected %d: %v", len(segments), len(expected), segments)
+	}
+	for i := range expected {
+		if segments[i] != expected[i] {
+			t.Errorf("segment %d is %v, expected %v", i, segments[i], expected[i])
+		}
+	}
+	if pos := a.Position(); pos != (Position{File: "binlog.000002", Pos: uint64(w.pos)}) {
+		t.Errorf("position %s after the last event", pos)
+	}
+}
+
+func TestArchiverBoundaries(t *testing.T) {
+	const queryEvent EventType = 2
+	var segments []Segment
+	a := &Archiver{
+		Dir: t.TempDir(),
+		Complete: func(seg Segment, path string) error {
+			segments = append(segments, seg)
+			return nil
+		},
+	}
+	add := func(ev *Event) {
+		t.Helper()
+		if err := a.Add(ev); err != nil {
+			t.Fatalf("failed to add event: %v", err)
+		}
+	}
+	a.Start(Position{File: "binlog.000001", Pos: 4})
+	w := &binlogWriter{pos: 4}
+	add(artificialRotate(t, Position{File: "binlog.000001", Pos: 4}))
+	add(w.event(t, FormatDescriptionEvent, 1000, make([]byte, 50)))
+	// where another target's segments end, the segment is completed, though it has no maximum size or age
+	boundary := w.pos + HeaderSize + 100
+	a.Boundaries = []Position{{File: "binlog.000001", Pos: uint64(boundary)}, {File: "binlog.000002", Pos: uint64(boundary)}}
+	add(w.event(t, queryEvent, 1001, make([]byte, 100)))
+	add(w.event(t, queryEvent, 1002, make([]byte, 100)))
+	add(w.event(t, queryEvent, 1003, make([]byte, 100)))
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Segment{
+		{File: "binlog.000001", Start: 4, End: uint64(boundary), Time: time.Unix(1001, 0).UTC()},
+		{File: "binlog.000001", Start: uint64(boundary), End: uint64(w.pos), Time: time.Unix(1002, 0).UTC()},
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("%d segments, expected %d: %v", len(segments), len(expected), segments)
+	}
+	for i := range expected {
+		if segments[i] != expected[i] {
+			t.Errorf("segment %d is %v, expected %v", i, segments[i], expected[i])
+		}
+	}
+}
+
+func TestArchiverStop(t *testing.T) {
+	const queryEvent EventType = 2
+	var segments []Segment
+	a := &Archiver{
+		Dir: t.TempDir(),
+		Complete: func(seg Segment, path string) error {
+			segments = append(segments, seg)
+			return nil
+		},
+	}
+	a.Start(Position{File: "binlog.000001", Pos: 4})
+	w := &binlogWriter{pos: 4}
+	// the Stop event of a server that was shut down ends its file, as a Rotate event does
+	for _, ev := range []*Event{
+		artificialRotate(t, Position{File: "binlog.000001", Pos: 4}),
+		w.event(t, FormatDescriptionEvent, 1000, make([]byte, 50)),
+		w.event(t, queryEvent, 1001, make([]byte, 100)),
+		w.event(t, stopEvent, 1002, nil),
+	} {
+		if err := a.Add(ev); err != nil {
+			t.Fatalf("failed to add event: %v", err)
+		}
+	}
+	expected := Segment{File: "binlog.000001", Start: 4, End: uint64(w.pos), Time: time.Unix(1001, 0).UTC(), EndOfFile: true}
+	if len(segments) != 1 || segments[0] != expected {
+		t.Errorf("segments %v, expected %v", segments, expected)
+	}
+}
@@ -0,0 +1,92 @@
+package binlog
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// authentication plugins that are supported
+const (
+	nativePassword      = "mysql_native_password"
+	cachingSHA2Password = "caching_sha2_password"
+)
+
+// states of caching_sha2_password, and the request for the public key of the server
+const (
+	cachingSHA2RequestPublicKey = 0x02
+	cachingSHA2FastAuthOK       = 0x03
+	cachingSHA2FullAuth         = 0x04
+)
+
+// scramble the response to the challenge of the server, salt, for the password with the plugin
+func scramble(plugin string, salt []byte, pass string) ([]byte, error) {
+	switch plugin {
+	case nativePassword:
+		return scrambleNative(salt, pass), nil
+	case cachingSHA2Password:
+		return scrambleSHA256(salt, pass), nil
+	}
+	return nil, fmt.Errorf("unsupported authentication plugin %s", plugin)
+}
+
+// scrambleNative SHA1(password) XOR SHA1(salt + SHA1(SHA1(password)))
+func scrambleNative(salt []byte, pass string) []byte {
+	if pass == "" {
+		return nil
+	}
+	stage1 := sha1.Sum([]byte(pass))
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(stage2[:])
+	return xor(stage1[:], h.Sum(nil))
+}
+
+// scrambleSHA256 SHA256(password) XOR SHA256(SHA256(SHA256(password)) + salt)
+func scrambleSHA256(salt []byte, pass string) []byte {
+	if pass == "" {
+		return nil
+	}
+	stage1 := sha256.Sum256([]byte(pass))
+	stage2 := sha256.Sum256(stage1[:])
+	h := sha256.New()
+	h.Write(stage2[:])
+	h.Write(salt)
+	return xor(stage1[:], h.Sum(nil))
+}
+
+// encryptPassword encrypts the password, terminated with a NUL and XORed with the salt, with
+// the RSA public key of the server, in PEM
+func encryptPassword(pass string, salt, key []byte) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("invalid public key from server")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key from server: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key from server is not an RSA key")
+	}
+	plain := append([]byte(pass), 0)
+	for i := range plain {
+		plain[i] ^= salt[i%len(salt)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaPub, plain, nil)
+}
+
+func xor(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
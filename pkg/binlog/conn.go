@@ -0,0 +1,368 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+)
+
+// capabilities of the client, from the client/server protocol
+const (
+	clientLongPassword     = 0x00000001
+	clientLongFlag         = 0x00000004
+	clientProtocol41       = 0x00000200
+	clientTransactions     = 0x00002000
+	clientSecureConnection = 0x00008000
+	clientPluginAuth       = 0x00080000
+)
+
+// commands, and the first byte of the packets of the responses to them
+const (
+	comQuery      = 0x03
+	comBinlogDump = 0x12
+
+	okPacket         = 0x00
+	authMoreData     = 0x01
+	eofPacket        = 0xfe
+	authSwitchPacket = 0xfe
+	errPacket        = 0xff
+
+	maxPacketSize = 1<<24 - 1
+	// binlogDumpNonBlock tells the server to end the dump once it reaches the end of the binary
+	// log, rather than waiting for more events
+	binlogDumpNonBlock = 0x01
+	// mariadbSlaveCapabilityGTID tells MariaDB that the client understands its GTID events
+	mariadbSlaveCapabilityGTID = 4
+	// utf8mb4GeneralCI the character set of the connection
+	utf8mb4GeneralCI = 45
+)
+
+// Conn a connection to a server as a replica, which reads its binary log with the binlog dump
+// protocol. The protocol is implemented here, rather than with database/sql, which has no way
+// to send the commands of a replica, or to read the events it returns.
+type Conn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	seq      byte
+	checksum bool
+}
+
+// Dial connects to the server of dbconn, and authenticates as its user, with either the
+// mysql_native_password or caching_sha2_password authentication. TLS is not supported.
+func Dial(ctx context.Context, dbconn database.Connection) (*Conn, error) {
+	network, addr := "tcp", fmt.Sprintf("%s:%d", dbconn.Host, dbconn.Port)
+	if strings.HasPrefix(dbconn.Host, "/") {
+		network, addr = "unix", dbconn.Host
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	c := &Conn{conn: nc, r: bufio.NewReaderSize(nc, 64*1024)}
+	if err := c.handshake(dbconn.User, dbconn.Pass); err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection. It may be called while the connection is being read, to stop it.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Exec runs a query that returns no rows
+func (c *Conn) Exec(query string) error {
+	c.seq = 0
+	if err := c.writePacket(append([]byte{comQuery}, query...)); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch data[0] {
+	case okPacket:
+		return nil
+	case errPacket:
+		return parseError(data)
+	}
+	return fmt.Errorf("unexpected response to query %q", query)
+}
+
+// Dump starts to read the binary log from pos, after which ReadEvent returns each event in turn.
+// Unless heartbeat is 0, the server sends a heartbeat event when there has been no other for that
+// long. If nonBlock is true, the dump ends at the end of the binary log; otherwise, it waits for
+// more events until the connection is closed. serverID identifies the connection as a replica,
+// so must be different from that of the server and any other replica of it.
+func (c *Conn) Dump(pos Position, serverID uint32, heartbeat time.Duration, checksum, nonBlock bool) error {
+	if pos.Pos > math.MaxUint32 {
+		return fmt.Errorf("position %s is beyond the 4GB that can be read", pos)
+	}
+	// the server only sends checksums to a replica that says that it can check them
+	c.checksum = checksum
+	if checksum {
+		if err := c.Exec("SET @master_binlog_checksum = 'CRC32'"); err != nil {
+			return fmt.Errorf("failed to enable checksums: %w", err)
+		}
+	}
+	if heartbeat > 0 {
+		if err := c.Exec(fmt.Sprintf("SET @master_heartbeat_period = %d", heartbeat.Nanoseconds())); err != nil {
+			return fmt.Errorf("failed to set heartbeat: %w", err)
+		}
+	}
+	// just a variable to MySQL, so harmless there
+	if err := c.Exec(fmt.Sprintf("SET @mariadb_slave_capability = %d", mariadbSlaveCapabilityGTID)); err != nil {
+		return fmt.Errorf("failed to set replica capability: %w", err)
+	}
+
+	var flags uint16
+	if nonBlock {
+		flags |= binlogDumpNonBlock
+	}
+	data := make([]byte, 11, 11+len(pos.File))
+	data[0] = comBinlogDump
+	binary.LittleEndian.PutUint32(data[1:], uint32(pos.Pos))
+	binary.LittleEndian.PutUint16(data[5:], flags)
+	binary.LittleEndian.PutUint32(data[7:], serverID)
+	data = append(data, pos.File...)
+	c.seq = 0
+	return c.writePacket(data)
+}
+
+// ReadEvent reads the next event of the dump. Returns io.EOF when a dump that does not block
+// reaches the end of the binary log.
+func (c *Conn) ReadEvent() (*Event, error) {
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case data[0] == okPacket:
+		return ParseEvent(data[1:], c.checksum)
+	case data[0] == errPacket:
+		return nil, parseError(data)
+	case data[0] == eofPacket && len(data) < 9:
+		return nil, io.EOF
+	}
+	return nil, fmt.Errorf("unexpected packet of type %d in binary log", data[0])
+}
+
+// handshake reads the greeting of the server, and authenticates
+func (c *Conn) handshake(user, pass string) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("failed to read greeting of server: %w", err)
+	}
+	if data[0] == errPacket {
+		return parseError(data)
+	}
+	g, err := parseGreeting(data)
+	if err != nil {
+		return err
+	}
+	if g.capabilities&clientProtocol41 == 0 {
+		return errors.New("server does not support protocol 4.1")
+	}
+	plugin := g.plugin
+	if plugin == "" {
+		plugin = nativePassword
+	}
+	authData, err := scramble(plugin, g.scramble, pass)
+	if err != nil {
+		return err
+	}
+
+	// HandshakeResponse41
+	resp := make([]byte, 32, 64+len(user)+len(authData)+len(plugin))
+	binary.LittleEndian.PutUint32(resp, clientLongPassword|clientLongFlag|clientProtocol41|clientTransactions|clientSecureConnection|clientPluginAuth)
+	binary.LittleEndian.PutUint32(resp[4:], maxPacketSize)
+	resp[8] = utf8mb4GeneralCI
+	resp = append(resp, user...)
+	resp = append(resp, 0, byte(len(authData)))
+	resp = append(resp, authData...)
+	resp = append(resp, plugin...)
+	resp = append(resp, 0)
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+	return c.authResult(plugin, g.scramble, pass)
+}
+
+// authResult reads the result of authentication, switching to another method or completing
+// that in use as the server asks
+func (c *Conn) authResult(plugin string, salt []byte, pass string) error {
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+		switch data[0] {
+		case okPacket:
+			return nil
+		case errPacket:
+			return parseError(data)
+		case authSwitchPacket:
+			name, rest, _ := bytes.Cut(data[1:], []byte{0})
+			plugin, salt = string(name), bytes.TrimSuffix(rest, []byte{0})
+			authData, err := scramble(plugin, salt, pass)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(authData); err != nil {
+				return err
+			}
+		case authMoreData:
+			if plugin != cachingSHA2Password || len(data) < 2 {
+				return fmt.Errorf("unexpected authentication data for %s", plugin)
+			}
+			switch data[1] {
+			case cachingSHA2FastAuthOK:
+				// the OK packet follows
+			case cachingSHA2FullAuth:
+				// without TLS, the password must be encrypted with the public key of the server
+				if err := c.writePacket([]byte{cachingSHA2RequestPublicKey}); err != nil {
+					return err
+				}
+				key, err := c.readPacket()
+				if err != nil {
+					return fmt.Errorf("failed to read public key of server: %w", err)
+				}
+				if key[0] != authMoreData {
+					return errors.New("server did not send its public key")
+				}
+				encrypted, err := encryptPassword(pass, salt, key[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(encrypted); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unexpected authentication state %d for %s", data[1], plugin)
+			}
+		default:
+			return fmt.Errorf("unexpected packet of type %d while authenticating", data[0])
+		}
+	}
+}
+
+// greeting the initial handshake packet from the server
+type greeting struct {
+	capabilities uint32
+	scramble     []byte
+	plugin       string
+}
+
+func parseGreeting(data []byte) (*greeting, error) {
+	if data[0] != 10 {
+		return nil, fmt.Errorf("unsupported protocol version %d", data[0])
+	}
+	// server version
+	_, rest, ok := bytes.Cut(data[1:], []byte{0})
+	// connection id, the first 8 bytes of the scramble, a filler, and the lower capabilities
+	if !ok || len(rest) < 4+8+1+2 {
+		return nil, errors.New("greeting of server is too short")
+	}
+	g := &greeting{scramble: append([]byte{}, rest[4:12]...)}
+	g.capabilities = uint32(binary.LittleEndian.Uint16(rest[13:]))
+	rest = rest[15:]
+	// character set, status, upper capabilities, length of the scramble, and 10 reserved bytes
+	if len(rest) < 1+2+2+1+10 {
+		return g, nil
+	}
+	g.capabilities |= uint32(binary.LittleEndian.Uint16(rest[3:])) << 16
+	scrambleLen := int(rest[5])
+	rest = rest[16:]
+	if g.capabilities&clientSecureConnection != 0 {
+		n := max(13, scrambleLen-8)
+		if len(rest) < n {
+			return nil, errors.New("greeting of server is too short for its scramble")
+		}
+		// the rest of the scramble ends with a NUL, which is not part of it
+		g.scramble = append(g.scramble, bytes.TrimSuffix(rest[:n], []byte{0})...)
+		rest = rest[n:]
+	}
+	if g.capabilities&clientPluginAuth != 0 {
+		name, _, _ := bytes.Cut(rest, []byte{0})
+		g.plugin = string(name)
+	}
+	return g, nil
+}
+
+// parseError the error in an ERR packet
+func parseError(data []byte) error {
+	if len(data) < 3 {
+		return errors.New("malformed error from server")
+	}
+	code := binary.LittleEndian.Uint16(data[1:])
+	msg := data[3:]
+	// the # marker and SQL state of protocol 4.1
+	if len(msg) >= 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	return &ServerError{Code: code, Message: string(msg)}
+}
+
+// ServerError an error returned by the server
+type ServerError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("error %d: %s", e.Code, e.Message)
+}
+
+// readPacket reads a whole packet, joining those that are split for being too large
+func (c *Conn) readPacket() ([]byte, error) {
+	var data []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+		size := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+		start := len(data)
+		data = append(data, make([]byte, size)...)
+		if _, err := io.ReadFull(c.r, data[start:]); err != nil {
+			return nil, err
+		}
+		if size < maxPacketSize {
+			break
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty packet from server")
+	}
+	return data, nil
+}
+
+// writePacket writes data as one or more packets
+func (c *Conn) writePacket(data []byte) error {
+	for {
+		size := min(len(data), maxPacketSize)
+		header := []byte{byte(size), byte(size >> 8), byte(size >> 16), c.seq}
+		c.seq++
+		if _, err := c.conn.Write(append(header, data[:size]...)); err != nil {
+			return err
+		}
+		data = data[size:]
+		// a packet of exactly the maximum size is followed by another, even if empty
+		if size < maxPacketSize {
+			return nil
+		}
+	}
+}
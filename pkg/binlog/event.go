@@ -0,0 +1,149 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// EventType the type of an event in the binary log
+type EventType byte
+
+// the types of event that need handling when archiving; all others are archived as they are
+const (
+	RotateEvent            EventType = 4
+	FormatDescriptionEvent EventType = 15
+	HeartbeatEvent         EventType = 27
+	// MySQLGTIDEvent and MySQLAnonymousGTIDEvent start each transaction on MySQL, with and without GTIDs
+	MySQLGTIDEvent          EventType = 33
+	MySQLAnonymousGTIDEvent EventType = 34
+	HeartbeatEventV2        EventType = 41
+	// MariaDBGTIDEvent starts each transaction on MariaDB
+	MariaDBGTIDEvent EventType = 162
+)
+
+const (
+	// HeaderSize the size of the header of every event, in version 4 of the binary log
+	HeaderSize = 19
+	// ChecksumSize the size of the CRC32 checksum at the end of each event, if the server has them
+	ChecksumSize = 4
+	// artificialFlag marks an event that is sent by the server, but is not in the binary log
+	artificialFlag = 0x20
+	// checksumCRC32 the checksum algorithm of a format description event for CRC32
+	checksumCRC32 = 1
+)
+
+// Magic the bytes at the start of every binary log file
+var Magic = []byte{0xfe, 'b', 'i', 'n'}
+
+// Position a position in the binary log of a server
+type Position struct {
+	File string
+	Pos  uint64
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+// Before whether the position comes before other in the binary log
+func (p Position) Before(other Position) bool {
+	if p.File != other.File {
+		return CompareFiles(p.File, other.File) < 0
+	}
+	return p.Pos < other.Pos
+}
+
+// EventHeader the header at the start of every event
+type EventHeader struct {
+	Timestamp uint32
+	Type      EventType
+	ServerID  uint32
+	Size      uint32
+	// LogPos the position in the binary log of the end of the event, or 0 for an event the server
+	// makes up, rather than reads from the binary log
+	LogPos uint32
+	Flags  uint16
+}
+
+// Artificial whether the event is not in the binary log, but made up by the server, such as
+// the rotate event with which it starts to send a binary log that is not read from its start
+func (h EventHeader) Artificial() bool {
+	return h.Flags&artificialFlag != 0 || h.LogPos == 0
+}
+
+// Event a single event of the binary log
+type Event struct {
+	Header EventHeader
+	// Raw the whole event, as it is in the binary log, including its header and any checksum
+	Raw []byte
+}
+
+// ParseEvent parses an event, as it is in the binary log. If checksum is true, the event ends in
+// a CRC32 checksum, which is verified.
+func ParseEvent(raw []byte, checksum bool) (*Event, error) {
+	if len(raw) < HeaderSize {
+		return nil, fmt.Errorf("event of %d bytes is shorter than its header", len(raw))
+	}
+	h := EventHeader{
+		Timestamp: binary.LittleEndian.Uint32(raw[0:]),
+		Type:      EventType(raw[4]),
+		ServerID:  binary.LittleEndian.Uint32(raw[5:]),
+		Size:      binary.LittleEndian.Uint32(raw[9:]),
+		LogPos:    binary.LittleEndian.Uint32(raw[13:]),
+		Flags:     binary.LittleEndian.Uint16(raw[17:]),
+	}
+	if int(h.Size) != len(raw) {
+		return nil, fmt.Errorf("event of type %d has size %d, but is %d bytes", h.Type, h.Size, len(raw))
+	}
+	if checksum {
+		if len(raw) < HeaderSize+ChecksumSize {
+			return nil, fmt.Errorf("event of type %d is too short for its checksum", h.Type)
+		}
+		body := raw[:len(raw)-ChecksumSize]
+		// a heartbeat of MariaDB is not checksummed, so a mismatch of one is not an error
+		if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(raw[len(body):]) && h.Type != HeartbeatEvent {
+			return nil, fmt.Errorf("event of type %d at %d has an invalid checksum", h.Type, h.LogPos)
+		}
+	}
+	return &Event{Header: h, Raw: raw}, nil
+}
+
+// Rotate the position in the next binary log, given by a rotate event
+func (e *Event) Rotate(checksum bool) (Position, error) {
+	if e.Header.Type != RotateEvent {
+		return Position{}, fmt.Errorf("event of type %d is not a rotate event", e.Header.Type)
+	}
+	body := e.Raw[HeaderSize:]
+	if checksum {
+		body = body[:len(body)-ChecksumSize]
+	}
+	if len(body) < 8 {
+		return Position{}, errors.New("rotate event is too short")
+	}
+	return Position{File: string(body[8:]), Pos: binary.LittleEndian.Uint64(body)}, nil
+}
+
+// Transaction whether the event starts a transaction
+func (e *Event) Transaction() bool {
+	switch e.Header.Type {
+	case MySQLGTIDEvent, MySQLAnonymousGTIDEvent, MariaDBGTIDEvent:
+		return true
+	}
+	return false
+}
+
+// Checksum whether the events of the binary log that a format description event starts end in a
+// CRC32 checksum, from the checksum algorithm at the end of the event
+func (e *Event) Checksum() (bool, error) {
+	if e.Header.Type != FormatDescriptionEvent {
+		return false, fmt.Errorf("event of type %d is not a format description event", e.Header.Type)
+	}
+	// the algorithm is followed by the checksum of the event itself, which is there even if the
+	// algorithm is none
+	if len(e.Raw) < HeaderSize+1+ChecksumSize {
+		return false, errors.New("format description event is too short")
+	}
+	return e.Raw[len(e.Raw)-ChecksumSize-1] == checksumCRC32, nil
+}
@@ -0,0 +1,88 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// makeEvent an event of the type, with the body, that ends at logPos
+func makeEvent(typ EventType, timestamp, logPos uint32, flags uint16, body []byte, checksum bool) []byte {
+	size := HeaderSize + len(body)
+	if checksum {
+		size += ChecksumSize
+	}
+	raw := make([]byte, HeaderSize, size)
+	binary.LittleEndian.PutUint32(raw[0:], timestamp)
+	raw[4] = byte(typ)
+	binary.LittleEndian.PutUint32(raw[5:], 1)
+	binary.LittleEndian.PutUint32(raw[9:], uint32(size))
+	binary.LittleEndian.PutUint32(raw[13:], logPos)
+	binary.LittleEndian.PutUint16(raw[17:], flags)
+	raw = append(raw, body...)
+	if checksum {
+		raw = binary.LittleEndian.AppendUint32(raw, crc32.ChecksumIEEE(raw))
+	}
+	return raw
+}
+
+// rotateBody the body of a rotate event to the position
+func rotateBody(pos Position) []byte {
+	return append(binary.LittleEndian.AppendUint64(nil, pos.Pos), pos.File...)
+}
+
+func TestParseEvent(t *testing.T) {
+	valid := makeEvent(MariaDBGTIDEvent, 1000, 500, 0, []byte("transaction"), true)
+	corrupt := append([]byte{}, valid...)
+	corrupt[HeaderSize] ^= 0xff
+	heartbeat := makeEvent(HeartbeatEvent, 0, 500, 0, []byte("binlog.000001"), true)
+	// MariaDB does not checksum heartbeats
+	copy(heartbeat[len(heartbeat)-ChecksumSize:], []byte{0, 0, 0, 0})
+	tests := []struct {
+		name     string
+		raw      []byte
+		checksum bool
+		typ      EventType
+		wantErr  bool
+	}{
+		{"valid", valid, true, MariaDBGTIDEvent, false},
+		{"without checksum", makeEvent(MySQLGTIDEvent, 1000, 500, 0, []byte("transaction"), false), false, MySQLGTIDEvent, false},
+		{"invalid checksum", corrupt, true, 0, true},
+		{"heartbeat without checksum", heartbeat, true, HeartbeatEvent, false},
+		{"short", valid[:10], true, 0, true},
+		{"wrong size", valid[:len(valid)-1], true, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := ParseEvent(tt.raw, tt.checksum)
+			switch {
+			case err != nil && !tt.wantErr:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err == nil && ev.Header.Type != tt.typ:
+				t.Errorf("type %d, expected %d", ev.Header.Type, tt.typ)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	want := Position{File: "binlog.000002", Pos: 4}
+	for _, checksum := range []bool{false, true} {
+		ev, err := ParseEvent(makeEvent(RotateEvent, 0, 0, artificialFlag, rotateBody(want), checksum), checksum)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ev.Header.Artificial() {
+			t.Error("rotate event is not artificial")
+		}
+		pos, err := ev.Rotate(checksum)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pos != want {
+			t.Errorf("position %s, expected %s", pos, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reader reads the events of a binary log file, such as an archived segment
+type Reader struct {
+	r        *bufio.Reader
+	checksum bool
+	started  bool
+}
+
+// NewReader a Reader of the binary log file being read by r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next the next event, or io.EOF at the end of the file
+func (r *Reader) Next() (*Event, error) {
+	if !r.started {
+		magic := make([]byte, len(Magic))
+		if _, err := io.ReadFull(r.r, magic); err != nil {
+			return nil, fmt.Errorf("failed to read binary log: %w", err)
+		}
+		if !bytes.Equal(magic, Magic) {
+			return nil, errors.New("not a binary log file")
+		}
+		r.started = true
+	}
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read event: %w", err)
+	}
+	size := binary.LittleEndian.Uint32(header[9:])
+	if size < HeaderSize {
+		return nil, fmt.Errorf("event has invalid size %d", size)
+	}
+	raw := make([]byte, size)
+	copy(raw, header)
+	if _, err := io.ReadFull(r.r, raw[HeaderSize:]); err != nil {
+		return nil, fmt.Errorf("failed to read event: %w", err)
+	}
+	// the format description event says whether the events that follow, and it, have checksums
+	if EventType(raw[4]) == FormatDescriptionEvent {
+		fde := &Event{Header: EventHeader{Type: FormatDescriptionEvent}, Raw: raw}
+		checksum, err := fde.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		r.checksum = checksum
+	}
+	return ParseEvent(raw, r.checksum)
+}
@@ -0,0 +1,597 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the types of event that are replayed, or skipped, other than those that are archived specially
+const (
+	startEventV3           EventType = 1
+	queryEvent             EventType = 2
+	stopEvent              EventType = 3
+	intvarEvent            EventType = 5
+	randEvent              EventType = 13
+	userVarEvent           EventType = 14
+	xidEvent               EventType = 16
+	tableMapEvent          EventType = 19
+	writeRowsEventV1       EventType = 23
+	updateRowsEventV1      EventType = 24
+	deleteRowsEventV1      EventType = 25
+	incidentEvent          EventType = 26
+	ignorableEvent         EventType = 28
+	rowsQueryEvent         EventType = 29
+	writeRowsEventV2       EventType = 30
+	updateRowsEventV2      EventType = 31
+	deleteRowsEventV2      EventType = 32
+	previousGTIDsEvent     EventType = 35
+	partialUpdateRowsEvent EventType = 39
+	annotateRowsEvent      EventType = 160
+	binlogCheckpointEvent  EventType = 161
+	gtidListEvent          EventType = 163
+)
+
+const (
+	// ignorableFlag marks an event that can be ignored if it is not understood
+	ignorableFlag = 0x80
+	// mariadbGTIDStandalone flags a MariaDB GTID event that is followed by a single statement,
+	// rather than a transaction that starts with BEGIN
+	mariadbGTIDStandalone = 0x01
+	// the options of the session in the flags2 of a query event
+	optionNoForeignKeyChecks  = 1 << 26
+	optionRelaxedUniqueChecks = 1 << 27
+	// the status variables of a query event; those with higher codes are not read
+	statusFlags2             = 0
+	statusSQLMode            = 1
+	statusCatalog            = 2
+	statusAutoIncrement      = 3
+	statusCharset            = 4
+	statusTimeZone           = 5
+	statusCatalogNZ          = 6
+	statusLCTimeNames        = 7
+	statusCharsetDatabase    = 8
+	statusTableMapForUpdate  = 9
+	statusMasterDataWritten  = 10
+	statusInvoker            = 11
+	statusUpdatedDBNames     = 12
+	statusMicroseconds       = 13
+	updatedDBNamesOverMaxDBs = 254
+	// the types of the value of a user variable event
+	userVarString = 0
+	userVarReal   = 1
+	userVarInt    = 2
+	// the types of an intvar event
+	intvarLastInsertID = 1
+	intvarInsertID     = 2
+)
+
+// Replayer turns the events of a binary log, from one or more of its segments in order, into the
+// statements that replay them on another server, much as mysqlbinlog does. Statements are replayed
+// as they were run; row events are replayed with BINLOG statements, which the server applies as a
+// replica would. The transactions are replayed as new ones, without their GTIDs.
+type Replayer struct {
+	// Start where to start: the events in its File that end at or before it are skipped
+	Start Position
+	// Until if set, stop before the first transaction that was started after it
+	Until time.Time
+	// UntilGTID if set, stop after the transaction with the GTID
+	UntilGTID string
+	// Skip the GTIDs of transactions to skip
+	Skip map[string]bool
+	// Exec runs each statement, in turn, on a single session
+	Exec func(stmt string) error
+
+	fde      []byte
+	fdeSent  bool
+	checksum bool
+	rows     [][]byte
+	// the transaction being replayed
+	tx *replayTx
+	// session the last value set of each session variable, so it is only set when it changes
+	session map[string]string
+	// position the position of the end of the last event read
+	position Position
+	// last the time of the last transaction replayed
+	last         time.Time
+	transactions int
+	done         bool
+}
+
+// replayTx a transaction in the binary log
+type replayTx struct {
+	gtid string
+	// explicit whether it started with BEGIN, so ends with COMMIT, rather than being a single statement
+	explicit bool
+	skip     bool
+}
+
+// Replay replays the segment of the binary log file, file, being read by r. Returns true once the
+// point at which to stop has been reached, after which no more segments need be replayed.
+func (p *Replayer) Replay(file string, r io.Reader) (bool, error) {
+	if p.done {
+		return true, nil
+	}
+	if p.session == nil {
+		p.session = map[string]string{}
+	}
+	reader := NewReader(r)
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			return false, p.flushRows()
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if ev.Header.Type == FormatDescriptionEvent {
+			if err := p.formatDescription(ev); err != nil {
+				return false, err
+			}
+			continue
+		}
+		// events before the start are already in the backup
+		if !p.Start.Before(Position{File: file, Pos: uint64(ev.Header.LogPos)}) {
+			continue
+		}
+		if err := p.event(ev); err != nil {
+			return false, fmt.Errorf("failed to replay event of type %d at %s:%d: %w", ev.Header.Type, file, ev.Header.LogPos, err)
+		}
+		p.position = Position{File: file, Pos: uint64(ev.Header.LogPos)}
+		if p.done {
+			return true, nil
+		}
+	}
+}
+
+// Finish ends the replay, after the last segment. A transaction that is incomplete, as the binary
+// log was archived only up to part of it, is rolled back.
+func (p *Replayer) Finish() error {
+	if err := p.flushRows(); err != nil {
+		return err
+	}
+	if p.tx != nil && p.tx.explicit && !p.tx.skip {
+		log.Warnf("transaction %s is incomplete at the end of the archived binary log, rolling it back", p.tx.gtid)
+		if err := p.Exec("ROLLBACK"); err != nil {
+			return err
+		}
+	}
+	p.tx = nil
+	return nil
+}
+
+// Position the position in the binary log of the end of the last event read
+func (p *Replayer) Position() Position {
+	return p.position
+}
+
+// Transactions the number of transactions replayed, and the time at which the last of them was started
+func (p *Replayer) Transactions() (int, time.Time) {
+	return p.transactions, p.last
+}
+
+// Done whether the point at which to stop has been reached
+func (p *Replayer) Done() bool {
+	return p.done
+}
+
+func (p *Replayer) formatDescription(ev *Event) error {
+	checksum, err := ev.Checksum()
+	if err != nil {
+		return err
+	}
+	p.checksum = checksum
+	if !bytes.Equal(p.fde, ev.Raw) {
+		p.fde, p.fdeSent = ev.Raw, false
+	}
+	return nil
+}
+
+// event replays a single event
+func (p *Replayer) event(ev *Event) error {
+	t := ev.Header.Type
+	if t != tableMapEvent && !rowsEvent(t) {
+		if err := p.flushRows(); err != nil {
+			return err
+		}
+	}
+	body := ev.Raw[HeaderSize:]
+	if p.checksum {
+		body = body[:len(body)-ChecksumSize]
+	}
+	switch t {
+	case MySQLGTIDEvent, MySQLAnonymousGTIDEvent, MariaDBGTIDEvent:
+		return p.begin(ev, body)
+	case queryEvent:
+		return p.query(ev, body)
+	case xidEvent:
+		return p.commit("COMMIT")
+	case tableMapEvent, writeRowsEventV1, updateRowsEventV1, deleteRowsEventV1, writeRowsEventV2, updateRowsEventV2, deleteRowsEventV2, partialUpdateRowsEvent:
+		if p.tx == nil || !p.tx.skip {
+			p.rows = append(p.rows, ev.Raw)
+		}
+		return nil
+	case intvarEvent:
+		return p.intvar(body)
+	case randEvent:
+		if len(body) < 16 {
+			return errors.New("rand event is too short")
+		}
+		return p.exec(fmt.Sprintf("SET @@RAND_SEED1=%d, @@RAND_SEED2=%d", binary.LittleEndian.Uint64(body), binary.LittleEndian.Uint64(body[8:])))
+	case userVarEvent:
+		return p.userVar(body)
+	case RotateEvent, HeartbeatEvent, HeartbeatEventV2, startEventV3, stopEvent, ignorableEvent, rowsQueryEvent,
+		previousGTIDsEvent, annotateRowsEvent, binlogCheckpointEvent, gtidListEvent:
+		return nil
+	case incidentEvent:
+		return errors.New("the binary log has an incident, so events may be missing from it")
+	}
+	if ev.Header.Flags&ignorableFlag != 0 {
+		return nil
+	}
+	return fmt.Errorf("unsupported event of type %d", t)
+}
+
+func rowsEvent(t EventType) bool {
+	switch t {
+	case writeRowsEventV1, updateRowsEventV1, deleteRowsEventV1, writeRowsEventV2, updateRowsEventV2, deleteRowsEventV2, partialUpdateRowsEvent:
+		return true
+	}
+	return false
+}
+
+// begin starts a transaction, from the GTID event that starts it
+func (p *Replayer) begin(ev *Event, body []byte) error {
+	if p.tx != nil && p.tx.explicit && !p.tx.skip {
+		log.Warnf("transaction %s has no end in the binary log, rolling it back", p.tx.gtid)
+		if err := p.Exec("ROLLBACK"); err != nil {
+			return err
+		}
+	}
+	started := time.Unix(int64(ev.Header.Timestamp), 0).UTC()
+	if !p.Until.IsZero() && started.After(p.Until) {
+		p.tx, p.done = nil, true
+		return nil
+	}
+	gtid, standalone, err := parseGTID(ev, body)
+	if err != nil {
+		return err
+	}
+	p.tx = &replayTx{gtid: gtid, skip: gtid != "" && p.Skip[gtid]}
+	if p.tx.skip {
+		log.Infof("skipping transaction %s", gtid)
+	}
+	p.last = started
+	// a transaction on MariaDB has no BEGIN of its own, the GTID event being in its place
+	if ev.Header.Type == MariaDBGTIDEvent && !standalone {
+		p.tx.explicit = true
+		return p.exec("BEGIN")
+	}
+	return nil
+}
+
+// commit ends the transaction with stmt, which commits or rolls it back
+func (p *Replayer) commit(stmt string) error {
+	if err := p.exec(stmt); err != nil {
+		return err
+	}
+	tx := p.tx
+	p.tx = nil
+	p.end(tx)
+	return nil
+}
+
+// end records the end of a transaction, and whether it is the last one to replay
+func (p *Replayer) end(tx *replayTx) {
+	if tx == nil {
+		return
+	}
+	if !tx.skip {
+		p.transactions++
+	}
+	if p.UntilGTID != "" && tx.gtid == p.UntilGTID {
+		p.done = true
+	}
+}
+
+// exec runs a statement, unless the transaction is being skipped
+func (p *Replayer) exec(stmt string) error {
+	if p.tx != nil && p.tx.skip {
+		return nil
+	}
+	return p.Exec(stmt)
+}
+
+// flushRows replays the row events read since the last statement, along with the format
+// description event that describes them, if it has not been yet
+func (p *Replayer) flushRows() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	if !p.fdeSent {
+		if p.fde == nil {
+			return errors.New("no format description event before the row events")
+		}
+		if err := p.Exec(binlogStatement([][]byte{p.fde})); err != nil {
+			return err
+		}
+		p.fdeSent = true
+	}
+	rows := p.rows
+	p.rows = nil
+	return p.Exec(binlogStatement(rows))
+}
+
+// binlogStatement the BINLOG statement that applies the events
+func binlogStatement(events [][]byte) string {
+	var b strings.Builder
+	b.WriteString("BINLOG '\n")
+	for _, ev := range events {
+		b.WriteString(base64.StdEncoding.EncodeToString(ev))
+		b.WriteString("\n")
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// query replays a query event, in the session in which it was run
+func (p *Replayer) query(ev *Event, body []byte) error {
+	// thread ID, execution time, length of the schema, error code and length of the status variables
+	if len(body) < 13 {
+		return errors.New("query event is too short")
+	}
+	dbLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:]))
+	if len(body) < 13+statusLen+dbLen+1 {
+		return errors.New("query event is too short")
+	}
+	status := body[13 : 13+statusLen]
+	db := string(body[13+statusLen : 13+statusLen+dbLen])
+	query := string(body[13+statusLen+dbLen+1:])
+
+	switch strings.ToUpper(strings.TrimSpace(query)) {
+	case "BEGIN":
+		if p.tx == nil {
+			p.tx = &replayTx{}
+		}
+		if p.tx.explicit {
+			return nil
+		}
+		p.tx.explicit = true
+		return p.exec("BEGIN")
+	case "COMMIT", "ROLLBACK":
+		return p.commit(query)
+	}
+
+	if p.tx == nil || !p.tx.skip {
+		stmts := []string{fmt.Sprintf("SET TIMESTAMP=%d", ev.Header.Timestamp)}
+		if db != "" && p.session["db"] != db {
+			p.session["db"] = db
+			stmts = append(stmts, "USE `"+strings.ReplaceAll(db, "`", "``")+"`")
+		}
+		stmts = append(stmts, p.sessionStatements(status)...)
+		for _, stmt := range append(stmts, query) {
+			if err := p.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	// a statement that is not in an explicit transaction, such as DDL, is one on its own
+	if p.tx == nil || !p.tx.explicit {
+		tx := p.tx
+		p.tx = nil
+		p.end(tx)
+	}
+	return nil
+}
+
+// sessionStatements the statements that set the session as it was when a query was run, from
+// the status variables of its event, for those that have changed. Status variables that are not
+// known end the reading of the rest.
+func (p *Replayer) sessionStatements(status []byte) []string {
+	vars := map[string]string{}
+	var order []string
+	set := func(name, value string) {
+		if _, ok := vars[name]; !ok {
+			order = append(order, name)
+		}
+		vars[name] = value
+	}
+	for len(status) > 0 {
+		code := status[0]
+		status = status[1:]
+		var n int
+		switch code {
+		case statusFlags2:
+			if len(status) < 4 {
+				break
+			}
+			flags := binary.LittleEndian.Uint32(status)
+			set("foreign_key_checks", boolVar(flags&optionNoForeignKeyChecks == 0))
+			set("unique_checks", boolVar(flags&optionRelaxedUniqueChecks == 0))
+			n = 4
+		case statusSQLMode:
+			if len(status) < 8 {
+				break
+			}
+			set("sql_mode", strconv.FormatUint(binary.LittleEndian.Uint64(status), 10))
+			n = 8
+		case statusAutoIncrement:
+			if len(status) < 4 {
+				break
+			}
+			set("auto_increment_increment", strconv.Itoa(int(binary.LittleEndian.Uint16(status))))
+			set("auto_increment_offset", strconv.Itoa(int(binary.LittleEndian.Uint16(status[2:]))))
+			n = 4
+		case statusCharset:
+			if len(status) < 6 {
+				break
+			}
+			set("character_set_client", strconv.Itoa(int(binary.LittleEndian.Uint16(status))))
+			set("collation_connection", strconv.Itoa(int(binary.LittleEndian.Uint16(status[2:]))))
+			n = 6
+		case statusTimeZone:
+			if len(status) < 1 || len(status) < 1+int(status[0]) {
+				break
+			}
+			set("time_zone", "'"+strings.ReplaceAll(string(status[1:1+status[0]]), "'", "''")+"'")
+			n = 1 + int(status[0])
+		case statusCatalog:
+			if len(status) > 0 {
+				n = 1 + int(status[0]) + 1
+			}
+		case statusCatalogNZ:
+			if len(status) > 0 {
+				n = 1 + int(status[0])
+			}
+		case statusLCTimeNames, statusCharsetDatabase:
+			n = 2
+		case statusMicroseconds:
+			n = 3
+		case statusMasterDataWritten:
+			n = 4
+		case statusTableMapForUpdate:
+			n = 8
+		case statusInvoker:
+			if len(status) > 0 {
+				n = 1 + int(status[0])
+				if len(status) > n {
+					n += 1 + int(status[n])
+				}
+			}
+		case statusUpdatedDBNames:
+			if len(status) > 0 {
+				n = 1
+				if count := int(status[0]); count != updatedDBNamesOverMaxDBs {
+					for i := 0; i < count && n < len(status); i++ {
+						end := bytes.IndexByte(status[n:], 0)
+						if end < 0 {
+							n = len(status)
+							break
+						}
+						n += end + 1
+					}
+				}
+			}
+		}
+		if n == 0 || n > len(status) {
+			break
+		}
+		status = status[n:]
+	}
+	var changed []string
+	for _, name := range order {
+		if p.session[name] != vars[name] {
+			p.session[name] = vars[name]
+			changed = append(changed, fmt.Sprintf("@@session.%s=%s", name, vars[name]))
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return []string{"SET " + strings.Join(changed, ", ")}
+}
+
+func boolVar(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// intvar sets the value of LAST_INSERT_ID() or the next auto-increment for the next statement
+func (p *Replayer) intvar(body []byte) error {
+	if len(body) < 9 {
+		return errors.New("intvar event is too short")
+	}
+	value := binary.LittleEndian.Uint64(body[1:])
+	switch body[0] {
+	case intvarLastInsertID:
+		return p.exec(fmt.Sprintf("SET LAST_INSERT_ID=%d", value))
+	case intvarInsertID:
+		return p.exec(fmt.Sprintf("SET INSERT_ID=%d", value))
+	}
+	return fmt.Errorf("unknown intvar of type %d", body[0])
+}
+
+// userVar sets a user variable used by the next statement
+func (p *Replayer) userVar(body []byte) error {
+	if len(body) < 4 {
+		return errors.New("user variable event is too short")
+	}
+	nameLen := int(binary.LittleEndian.Uint32(body))
+	if len(body) < 4+nameLen+1 {
+		return errors.New("user variable event is too short")
+	}
+	name := "@`" + strings.ReplaceAll(string(body[4:4+nameLen]), "`", "``") + "`"
+	body = body[4+nameLen:]
+	if body[0] != 0 {
+		return p.exec(fmt.Sprintf("SET %s := NULL", name))
+	}
+	// type, character set and length of the value
+	if len(body) < 1+1+4+4 {
+		return errors.New("user variable event is too short")
+	}
+	typ := body[1]
+	valueLen := int(binary.LittleEndian.Uint32(body[6:]))
+	if len(body) < 10+valueLen {
+		return errors.New("user variable event is too short")
+	}
+	value := body[10 : 10+valueLen]
+	var flags byte
+	if len(body) > 10+valueLen {
+		flags = body[10+valueLen]
+	}
+	switch {
+	case typ == userVarString:
+		// the character set of the value is not kept, so it is set as a binary string
+		return p.exec(fmt.Sprintf("SET %s := X'%s'", name, hex.EncodeToString(value)))
+	case typ == userVarReal && len(value) == 8:
+		return p.exec(fmt.Sprintf("SET %s := %s", name, strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(value)), 'g', -1, 64)))
+	case typ == userVarInt && len(value) == 8:
+		v := binary.LittleEndian.Uint64(value)
+		if flags&0x01 != 0 {
+			return p.exec(fmt.Sprintf("SET %s := %d", name, v))
+		}
+		return p.exec(fmt.Sprintf("SET %s := %d", name, int64(v)))
+	}
+	return fmt.Errorf("unsupported user variable %s of type %d", name, typ)
+}
+
+// parseGTID the GTID of the transaction started by a GTID event, blank if it has none, and
+// whether it is a single statement without BEGIN, as MariaDB flags them
+func parseGTID(ev *Event, body []byte) (string, bool, error) {
+	switch ev.Header.Type {
+	case MariaDBGTIDEvent:
+		// sequence number, domain and flags
+		if len(body) < 13 {
+			return "", false, errors.New("GTID event is too short")
+		}
+		seq := binary.LittleEndian.Uint64(body)
+		domain := binary.LittleEndian.Uint32(body[8:])
+		return fmt.Sprintf("%d-%d-%d", domain, ev.Header.ServerID, seq), body[12]&mariadbGTIDStandalone != 0, nil
+	case MySQLGTIDEvent:
+		// flags, UUID of the source and number of the transaction
+		if len(body) < 25 {
+			return "", false, errors.New("GTID event is too short")
+		}
+		u := hex.EncodeToString(body[1:17])
+		return fmt.Sprintf("%s-%s-%s-%s-%s:%d", u[0:8], u[8:12], u[12:16], u[16:20], u[20:], binary.LittleEndian.Uint64(body[17:])), false, nil
+	}
+	return "", false, nil
+}
+
+// NormalizeGTID a GTID as the Replayer names it, from how it is given by a user
+func NormalizeGTID(gtid string) string {
+	return strings.ToLower(strings.TrimSpace(gtid))
+}
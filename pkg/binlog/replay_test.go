@@ -0,0 +1,139 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+// testBinlog builds a binary log file of a MariaDB server, with checksums
+type testBinlog struct {
+	buf bytes.Buffer
+	pos uint32
+	fde []byte
+}
+
+func newTestBinlog(t *testing.T) *testBinlog {
+	b := &testBinlog{pos: 4}
+	b.buf.Write(Magic)
+	// binlog version, server version, create time and header length, then the checksum algorithm
+	body := make([]byte, 2+50+4+1)
+	b.fde = b.add(FormatDescriptionEvent, 0, append(body, checksumCRC32))
+	return b
+}
+
+func (b *testBinlog) add(typ EventType, timestamp uint32, body []byte) []byte {
+	b.pos += uint32(HeaderSize + len(body) + ChecksumSize)
+	raw := makeEvent(typ, timestamp, b.pos, 0, body, true)
+	b.buf.Write(raw)
+	return raw
+}
+
+func (b *testBinlog) gtid(timestamp uint32, seq uint64, standalone bool) {
+	body := binary.LittleEndian.AppendUint64(nil, seq)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	var flags byte
+	if standalone {
+		flags = mariadbGTIDStandalone
+	}
+	b.add(MariaDBGTIDEvent, timestamp, append(body, flags))
+}
+
+func (b *testBinlog) query(timestamp uint32, db, query string, status []byte) {
+	body := make([]byte, 13)
+	body[8] = byte(len(db))
+	binary.LittleEndian.PutUint16(body[11:], uint16(len(status)))
+	body = append(body, status...)
+	body = append(body, db...)
+	body = append(body, 0)
+	b.add(queryEvent, timestamp, append(body, query...))
+}
+
+func (b *testBinlog) xid(timestamp uint32) {
+	b.add(xidEvent, timestamp, make([]byte, 8))
+}
+
+func TestReplayer(t *testing.T) {
+	b := newTestBinlog(t)
+	// a transaction of row events
+	b.gtid(1000, 10, false)
+	tableMap := b.add(tableMapEvent, 1000, []byte("table map"))
+	writeRows := b.add(writeRowsEventV2, 1000, []byte("rows"))
+	b.xid(1000)
+	afterFirst := b.pos
+	// DDL, on its own
+	sqlMode := append([]byte{statusSQLMode}, binary.LittleEndian.AppendUint64(nil, 1436549152)...)
+	b.gtid(1001, 11, true)
+	b.query(1001, "shop", "CREATE TABLE t2 (id int)", sqlMode)
+	// statements
+	b.gtid(1002, 12, false)
+	b.query(1002, "shop", "INSERT INTO t2 VALUES (1)", sqlMode)
+	b.xid(1002)
+	b.gtid(2000, 13, false)
+	b.query(2000, "shop", "INSERT INTO t2 VALUES (2)", sqlMode)
+	b.xid(2000)
+
+	binlogStmt := func(events ...[]byte) string {
+		s := "BINLOG '\n"
+		for _, ev := range events {
+			s += base64.StdEncoding.EncodeToString(ev) + "\n"
+		}
+		return s + "'"
+	}
+	first := []string{"BEGIN", binlogStmt(b.fde), binlogStmt(tableMap, writeRows), "COMMIT"}
+	ddl := []string{"SET TIMESTAMP=1001", "USE `shop`", "SET @@session.sql_mode=1436549152", "CREATE TABLE t2 (id int)"}
+	third := []string{"BEGIN", "SET TIMESTAMP=1002", "INSERT INTO t2 VALUES (1)", "COMMIT"}
+	fourth := []string{"BEGIN", "SET TIMESTAMP=2000", "INSERT INTO t2 VALUES (2)", "COMMIT"}
+	join := func(parts ...[]string) []string {
+		var all []string
+		for _, p := range parts {
+			all = append(all, p...)
+		}
+		return all
+	}
+
+	tests := []struct {
+		name         string
+		replayer     Replayer
+		expected     []string
+		done         bool
+		transactions int
+	}{
+		{"all", Replayer{}, join(first, ddl, third, fourth), false, 4},
+		{"from start", Replayer{Start: Position{File: "binlog.000001", Pos: uint64(afterFirst)}}, join(ddl, third, fourth), false, 3},
+		{"until time", Replayer{Until: time.Unix(1500, 0)}, join(first, ddl, third), true, 3},
+		{"until gtid", Replayer{UntilGTID: "0-1-11"}, join(first, ddl), true, 2},
+		{"skip gtid", Replayer{Skip: map[string]bool{"0-1-12": true}}, join(first, ddl, fourth), false, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stmts []string
+			p := tt.replayer
+			p.Exec = func(stmt string) error {
+				stmts = append(stmts, stmt)
+				return nil
+			}
+			done, err := p.Replay("binlog.000001", bytes.NewReader(b.buf.Bytes()))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := p.Finish(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if done != tt.done {
+				t.Errorf("done %v, expected %v", done, tt.done)
+			}
+			if n, _ := p.Transactions(); n != tt.transactions {
+				t.Errorf("%d transactions, expected %d", n, tt.transactions)
+			}
+			if diff := deep.Equal(stmts, tt.expected); diff != nil {
+				t.Errorf("statements:\n%s\ndiff: %v", strings.Join(stmts, "\n"), diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package binlog
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// segmentRE matches the name of an archived segment, binlog_<time>_<file>_<start>-<end>, followed by
+// endOfFileMarker if it is the last of its file, with or without safechars, and with the extensions
+// of its compression and encryption
+var segmentRE = regexp.MustCompile(`^binlog_(\d{4}-\d{2}-\d{2}T\d{2}[:-]\d{2}[:-]\d{2}Z)_(.+)_(\d+)-(\d+)(` + endOfFileMarker + `)?(?:\.\w+)+$`)
+
+// endOfFileMarker marks the name of a segment that ends at the end of its file
+const endOfFileMarker = "_eof"
+
+// Segment a part of a binary log of the server, from Start to End, which is archived as a file
+// of its own. It is a binary log file in its own right, that starts with the format description
+// event of the binary log of which it is part, so it can be read by mysqlbinlog.
+type Segment struct {
+	// File the name of the binary log on the server
+	File  string
+	Start uint64
+	End   uint64
+	// Time the time of the first event in the segment
+	Time time.Time
+	// EndOfFile whether the segment ends with the last event of its file: the Rotate event to the
+	// next file, or the Stop event of a server that was shut down, after which it starts the next
+	EndOfFile bool
+}
+
+// Name the name of the archive of the segment, without any extensions. If safechars is true,
+// the `:` of the time are replaced with `-`, as with the names of dumps.
+func (s Segment) Name(safechars bool) string {
+	timepart := s.Time.UTC().Format(time.RFC3339)
+	if safechars {
+		timepart = strings.ReplaceAll(timepart, ":", "-")
+	}
+	name := fmt.Sprintf("binlog_%s_%s_%d-%d", timepart, s.File, s.Start, s.End)
+	if s.EndOfFile {
+		name += endOfFileMarker
+	}
+	return name
+}
+
+// ParseSegmentName the segment archived as the named file, and false if it is not the name of a segment
+func ParseSegmentName(name string) (Segment, bool) {
+	matches := segmentRE.FindStringSubmatch(name)
+	if matches == nil {
+		return Segment{}, false
+	}
+	t, err := time.Parse(time.RFC3339, matches[1][:13]+":"+matches[1][14:16]+":"+matches[1][17:])
+	if err != nil {
+		return Segment{}, false
+	}
+	start, err1 := strconv.ParseUint(matches[3], 10, 64)
+	end, err2 := strconv.ParseUint(matches[4], 10, 64)
+	if err1 != nil || err2 != nil {
+		return Segment{}, false
+	}
+	return Segment{File: matches[2], Start: start, End: end, Time: t, EndOfFile: matches[5] != ""}, true
+}
+
+// Before whether the segment comes before other in the binary log
+func (s Segment) Before(other Segment) bool {
+	if s.File != other.File {
+		return CompareFiles(s.File, other.File) < 0
+	}
+	return s.Start < other.Start
+}
+
+// CompareFiles compares the names of two binary log files in the order in which they were written,
+// returning -1, 0 or +1. The files are numbered, with at least six digits, but more once there are
+// enough of them, so the numbers are compared as numbers: mysql-bin.1000000 follows mysql-bin.999999.
+func CompareFiles(a, b string) int {
+	baseA, numA := splitFile(a)
+	baseB, numB := splitFile(b)
+	if baseA != baseB || numA == "" || numB == "" {
+		return strings.Compare(a, b)
+	}
+	numA, numB = strings.TrimLeft(numA, "0"), strings.TrimLeft(numB, "0")
+	if len(numA) != len(numB) {
+		return cmp.Compare(len(numA), len(numB))
+	}
+	return strings.Compare(numA, numB)
+}
+
+// NextFile the name of the binary log file that follows name, or blank if it is not numbered.
+// The number keeps its digits, and gains one once it needs it: mysql-bin.999999 is followed by
+// mysql-bin.1000000.
+func NextFile(name string) string {
+	base, num := splitFile(name)
+	if num == "" {
+		return ""
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s.%0*d", base, len(num), n+1)
+}
+
+// splitFile splits the name of a binary log file into its base name and its number, which is
+// blank if it does not have one
+func splitFile(name string) (string, string) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 || i == len(name)-1 {
+		return name, ""
+	}
+	for _, r := range name[i+1:] {
+		if r < '0' || r > '9' {
+			return name, ""
+		}
+	}
+	return name[:i], name[i+1:]
+}
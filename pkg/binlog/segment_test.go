@@ -0,0 +1,93 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSegmentName(t *testing.T) {
+	seg := Segment{File: "mysql-bin.000012", Start: 4, End: 123456, Time: time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)}
+	tests := []struct {
+		name      string
+		safechars bool
+		endOfFile bool
+		ext       string
+		expected  string
+	}{
+		{"plain", false, false, ".tgz", "binlog_2024-03-01T10:20:30Z_mysql-bin.000012_4-123456"},
+		{"safechars", true, false, ".tar.zst", "binlog_2024-03-01T10-20-30Z_mysql-bin.000012_4-123456"},
+		{"encrypted", false, false, ".tgz.age", "binlog_2024-03-01T10:20:30Z_mysql-bin.000012_4-123456"},
+		{"end of file", false, true, ".tgz", "binlog_2024-03-01T10:20:30Z_mysql-bin.000012_4-123456_eof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := seg
+			seg.EndOfFile = tt.endOfFile
+			name := seg.Name(tt.safechars)
+			if name != tt.expected {
+				t.Fatalf("name %s, expected %s", name, tt.expected)
+			}
+			parsed, ok := ParseSegmentName(name + tt.ext)
+			if !ok {
+				t.Fatalf("failed to parse %s", name+tt.ext)
+			}
+			if parsed != seg {
+				t.Errorf("parsed %v, expected %v", parsed, seg)
+			}
+		})
+	}
+	for _, name := range []string{"db_backup_2024-03-01T10:20:30Z.tgz", "binlog_2024-03-01T10:20:30Z_mysql-bin.000012_4-123456", "binlog_garbage_4-5.tgz"} {
+		if _, ok := ParseSegmentName(name); ok {
+			t.Errorf("parsed %s, which is not a segment", name)
+		}
+	}
+}
+
+func TestSegmentBefore(t *testing.T) {
+	a := Segment{File: "binlog.000001", Start: 1000}
+	b := Segment{File: "binlog.000002", Start: 4}
+	c := Segment{File: "binlog.000002", Start: 500}
+	if !a.Before(b) || !b.Before(c) || c.Before(a) || b.Before(b) {
+		t.Error("segments are not in the order of the binary log")
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"mysql-bin.000001", "mysql-bin.000002", -1},
+		{"mysql-bin.000002", "mysql-bin.000002", 0},
+		{"mysql-bin.999999", "mysql-bin.1000000", -1},
+		{"mysql-bin.1000000", "mysql-bin.999999", 1},
+		{"mysql-bin.0999999", "mysql-bin.1000000", -1},
+		{"binlog.000001", "mysql-bin.000001", -1},
+		{"binlog", "binlog.000001", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareFiles(tt.a, tt.b); got != tt.expected {
+			t.Errorf("CompareFiles(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+	for name, expected := range map[string]string{
+		"mysql-bin.000001":  "mysql-bin.000002",
+		"mysql-bin.000009":  "mysql-bin.000010",
+		"mysql-bin.999999":  "mysql-bin.1000000",
+		"mysql-bin.1000000": "mysql-bin.1000001",
+		"mysql-bin":         "",
+	} {
+		if next := NextFile(name); next != expected {
+			t.Errorf("NextFile(%s) = %s, expected %s", name, next, expected)
+		}
+	}
+	// files numbered past 999999 follow on from those before
+	a := Segment{File: "mysql-bin.999999", Start: 4}
+	b := Segment{File: "mysql-bin.1000000", Start: 4}
+	if !a.Before(b) || b.Before(a) {
+		t.Error("segment of mysql-bin.1000000 is not after that of mysql-bin.999999")
+	}
+	if !(Position{File: "mysql-bin.999999", Pos: 1000}).Before(Position{File: "mysql-bin.1000000", Pos: 4}) {
+		t.Error("position in mysql-bin.1000000 is not after that in mysql-bin.999999")
+	}
+}
@@ -7,6 +7,8 @@ import (
 )
 
 type Bzip2Compressor struct {
+	// Level the compression level, 1-9, or 0 for the default
+	Level int
 }
 
 func (b *Bzip2Compressor) Uncompress(in io.Reader) (io.Reader, error) {
@@ -14,7 +16,7 @@ func (b *Bzip2Compressor) Uncompress(in io.Reader) (io.Reader, error) {
 }
 
 func (b *Bzip2Compressor) Compress(out io.Writer) (io.WriteCloser, error) {
-	return bzip2.NewWriter(out, nil)
+	return bzip2.NewWriter(out, &bzip2.WriterConfig{Level: b.Level})
 }
 func (b *Bzip2Compressor) Extension() string {
 	return "tbz2"
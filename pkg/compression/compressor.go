@@ -6,18 +6,61 @@ import (
 )
 
 type Compressor interface {
+	// Uncompress a reader of the uncompressed contents of in. If it also is an io.Closer, it
+	// must be closed once done with, to release what it holds.
 	Uncompress(in io.Reader) (io.Reader, error)
 	Compress(out io.Writer) (io.WriteCloser, error)
 	Extension() string
 }
 
-func GetCompressor(name string) (Compressor, error) {
+// Name the name of the format of the compressor, as given to GetCompressor
+func Name(c Compressor) string {
+	switch c.(type) {
+	case *GzipCompressor:
+		return "gzip"
+	case *Bzip2Compressor:
+		return "bzip2"
+	case *ZstdCompressor:
+		return "zstd"
+	case *XzCompressor:
+		return "xz"
+	case *Lz4Compressor:
+		return "lz4"
+	case *NoneCompressor:
+		return "none"
+	default:
+		return ""
+	}
+}
+
+// GetCompressor get the compressor for the named format. A level of 0 uses the default
+// level for the format; otherwise it must be within the range the format supports.
+func GetCompressor(name string, level int) (Compressor, error) {
+	var (
+		c        Compressor
+		min, max int
+	)
 	switch name {
 	case "gzip":
-		return &GzipCompressor{}, nil
+		c, min, max = &GzipCompressor{Level: level}, 1, 9
 	case "bzip2":
-		return &Bzip2Compressor{}, nil
+		c, min, max = &Bzip2Compressor{Level: level}, 1, 9
+	case "zstd":
+		c, min, max = &ZstdCompressor{Level: level}, 1, 22
+	case "xz":
+		c, min, max = &XzCompressor{Level: level}, 1, 9
+	case "lz4":
+		c, min, max = &Lz4Compressor{Level: level}, 1, 9
+	case "none":
+		c = &NoneCompressor{}
 	default:
 		return nil, fmt.Errorf("unknown compression format: %s", name)
 	}
+	if level != 0 && (level < min || level > max) {
+		if max == 0 {
+			return nil, fmt.Errorf("compression format %s does not support a compression level", name)
+		}
+		return nil, fmt.Errorf("compression level for %s must be between %d and %d, not %d", name, min, max, level)
+	}
+	return c, nil
 }
@@ -0,0 +1,73 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressors(t *testing.T) {
+	data := strings.Repeat("INSERT INTO `t` VALUES (1,'abc'),(2,'def');\n", 1000)
+	tests := []struct {
+		name      string
+		level     int
+		extension string
+		err       bool
+	}{
+		{"gzip", 0, "tgz", false},
+		{"gzip", 9, "tgz", false},
+		{"gzip", 10, "", true},
+		{"bzip2", 1, "tbz2", false},
+		{"zstd", 0, "tar.zst", false},
+		{"zstd", 22, "tar.zst", false},
+		{"zstd", 23, "", true},
+		{"xz", 0, "txz", false},
+		{"xz", 9, "txz", false},
+		{"lz4", 0, "tar.lz4", false},
+		{"lz4", 9, "tar.lz4", false},
+		{"none", 0, "tar", false},
+		{"none", 1, "", true},
+		{"rar", 0, "", true},
+	}
+	for _, tt := range tests {
+		c, err := GetCompressor(tt.name, tt.level)
+		if (err != nil) != tt.err {
+			t.Errorf("%s level %d: expected error %v, got %v", tt.name, tt.level, tt.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c.Extension() != tt.extension {
+			t.Errorf("%s: expected extension %s, got %s", tt.name, tt.extension, c.Extension())
+		}
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatalf("%s level %d: compress: %v", tt.name, tt.level, err)
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			t.Fatalf("%s level %d: write: %v", tt.name, tt.level, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s level %d: close: %v", tt.name, tt.level, err)
+		}
+		r, err := c.Uncompress(&buf)
+		if err != nil {
+			t.Fatalf("%s level %d: uncompress: %v", tt.name, tt.level, err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s level %d: read: %v", tt.name, tt.level, err)
+		}
+		if string(b) != data {
+			t.Errorf("%s level %d: mismatched data after round trip", tt.name, tt.level)
+		}
+		if closer, ok := r.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				t.Errorf("%s level %d: close uncompressor: %v", tt.name, tt.level, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package compression
+
+import (
+	"bytes"
+	"strings"
+)
+
+// DetectLength how many bytes from the start of a file Detect needs to recognise all of the
+// formats; the tar header magic, for an uncompressed archive, is the furthest in
+const DetectLength = tarMagicOffset + len(tarMagic)
+
+const (
+	tarMagicOffset = 257
+	tarMagic       = "ustar"
+)
+
+// magics the bytes with which a file in each format begins
+var magics = []struct {
+	name  string
+	magic []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"bzip2", []byte("BZh")},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"lz4", []byte{0x04, 0x22, 0x4d, 0x18}},
+}
+
+// extensions the filename extensions of each format, longest first, so that the
+// extension of a compressed tar file is matched before that of a plain one
+var extensions = []struct {
+	ext  string
+	name string
+}{
+	{".tar.gz", "gzip"},
+	{".tar.bz2", "bzip2"},
+	{".tar.zst", "zstd"},
+	{".tar.xz", "xz"},
+	{".tar.lz4", "lz4"},
+	{".tgz", "gzip"},
+	{".tbz2", "bzip2"},
+	{".txz", "xz"},
+	{".gz", "gzip"},
+	{".bz2", "bzip2"},
+	{".zst", "zstd"},
+	{".xz", "xz"},
+	{".lz4", "lz4"},
+	{".tar", "none"},
+}
+
+// Detect get the compressor for a file from the bytes with which it begins, which should be
+// at least DetectLength long, unless the file is shorter than that. Returns nil if the format
+// is not recognised.
+func Detect(header []byte) Compressor {
+	for _, m := range magics {
+		if bytes.HasPrefix(header, m.magic) {
+			c, _ := GetCompressor(m.name, 0)
+			return c
+		}
+	}
+	if len(header) >= DetectLength && string(header[tarMagicOffset:DetectLength]) == tarMagic {
+		return &NoneCompressor{}
+	}
+	return nil
+}
+
+// ForFilename get the compressor for a file from the extension of its name. Returns nil if
+// the extension is not recognised.
+func ForFilename(filename string) Compressor {
+	lower := strings.ToLower(filename)
+	for _, e := range extensions {
+		if strings.HasSuffix(lower, e.ext) {
+			c, _ := GetCompressor(e.name, 0)
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package compression
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	// a small tar archive, as the contents of each compressed file
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	data := []byte("CREATE TABLE `t` (`id` int);\n")
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "db.sql", Mode: 0o644, Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"gzip", "bzip2", "zstd", "xz", "lz4", "none"} {
+		c, err := GetCompressor(name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(archive.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		header := buf.Bytes()
+		if len(header) > DetectLength {
+			header = header[:DetectLength]
+		}
+		detected := Detect(header)
+		if fmt.Sprintf("%T", detected) != fmt.Sprintf("%T", c) {
+			t.Errorf("%s: detected %T", name, detected)
+		}
+	}
+	if c := Detect([]byte("CREATE TABLE")); c != nil {
+		t.Errorf("unknown format: detected %T", c)
+	}
+}
+
+func TestForFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected Compressor
+	}{
+		{"db_backup_2024-01-01T00:00:00Z.tgz", &GzipCompressor{}},
+		{"db_backup.tar.gz", &GzipCompressor{}},
+		{"db_backup.TBZ2", &Bzip2Compressor{}},
+		{"db_backup.tar.zst", &ZstdCompressor{}},
+		{"db_backup.txz", &XzCompressor{}},
+		{"db_backup.tar.lz4", &Lz4Compressor{}},
+		{"db_backup.tar", &NoneCompressor{}},
+		{"db_backup.sql", nil},
+	}
+	for _, tt := range tests {
+		c := ForFilename(tt.filename)
+		if fmt.Sprintf("%T", c) != fmt.Sprintf("%T", tt.expected) {
+			t.Errorf("%s: expected %T, got %T", tt.filename, tt.expected, c)
+		}
+	}
+}
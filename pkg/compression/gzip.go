@@ -6,6 +6,8 @@ import (
 )
 
 type GzipCompressor struct {
+	// Level the compression level, 1-9, or 0 for the default
+	Level int
 }
 
 func (g *GzipCompressor) Uncompress(in io.Reader) (io.Reader, error) {
@@ -13,7 +15,10 @@ func (g *GzipCompressor) Uncompress(in io.Reader) (io.Reader, error) {
 }
 
 func (g *GzipCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
-	return gzip.NewWriter(out), nil
+	if g.Level == 0 {
+		return gzip.NewWriter(out), nil
+	}
+	return gzip.NewWriterLevel(out, g.Level)
 }
 func (g *GzipCompressor) Extension() string {
 	return "tgz"
@@ -0,0 +1,41 @@
+package compression
+
+import (
+	"io"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// lz4Levels the encoder level for each compression level
+var lz4Levels = []lz4.CompressionLevel{
+	0: lz4.Fast,
+	1: lz4.Level1,
+	2: lz4.Level2,
+	3: lz4.Level3,
+	4: lz4.Level4,
+	5: lz4.Level5,
+	6: lz4.Level6,
+	7: lz4.Level7,
+	8: lz4.Level8,
+	9: lz4.Level9,
+}
+
+type Lz4Compressor struct {
+	// Level the compression level, 1-9, or 0 for the default, which is the fastest
+	Level int
+}
+
+func (l *Lz4Compressor) Uncompress(in io.Reader) (io.Reader, error) {
+	return lz4.NewReader(in), nil
+}
+
+func (l *Lz4Compressor) Compress(out io.Writer) (io.WriteCloser, error) {
+	w := lz4.NewWriter(out)
+	if err := w.Apply(lz4.CompressionLevelOption(lz4Levels[l.Level])); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+func (l *Lz4Compressor) Extension() string {
+	return "tar.lz4"
+}
@@ -0,0 +1,30 @@
+package compression
+
+import (
+	"io"
+)
+
+// NoneCompressor leaves the archive uncompressed
+type NoneCompressor struct {
+}
+
+func (n *NoneCompressor) Uncompress(in io.Reader) (io.Reader, error) {
+	return in, nil
+}
+
+func (n *NoneCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{out}, nil
+}
+func (n *NoneCompressor) Extension() string {
+	return "tar"
+}
+
+// nopWriteCloser a writer whose Close does nothing, as closing the compressor must not
+// close the underlying writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package compression
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// xzDictCaps the dictionary size for each level, as used by the presets of the xz command
+var xzDictCaps = []int{
+	1: 1 << 20,
+	2: 2 << 20,
+	3: 4 << 20,
+	4: 4 << 20,
+	5: 8 << 20,
+	6: 8 << 20,
+	7: 16 << 20,
+	8: 32 << 20,
+	9: 64 << 20,
+}
+
+type XzCompressor struct {
+	// Level the compression level, 1-9, or 0 for the default. The encoder does not implement
+	// the presets of the xz command, so this only sets the dictionary size to that of the preset.
+	Level int
+}
+
+func (x *XzCompressor) Uncompress(in io.Reader) (io.Reader, error) {
+	return xz.NewReader(in)
+}
+
+func (x *XzCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
+	config := xz.WriterConfig{}
+	if x.Level != 0 {
+		config.DictCap = xzDictCaps[x.Level]
+	}
+	return config.NewWriter(out)
+}
+func (x *XzCompressor) Extension() string {
+	return "txz"
+}
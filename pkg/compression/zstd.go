@@ -0,0 +1,32 @@
+package compression
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type ZstdCompressor struct {
+	// Level the compression level, 1-22 as for the zstd command, or 0 for the default.
+	// The levels are mapped onto the smaller number of levels the encoder implements.
+	Level int
+}
+
+func (z *ZstdCompressor) Uncompress(in io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func (z *ZstdCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
+	var opts []zstd.EOption
+	if z.Level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(z.Level)))
+	}
+	return zstd.NewWriter(out, opts...)
+}
+func (z *ZstdCompressor) Extension() string {
+	return "tar.zst"
+}
@@ -19,25 +19,81 @@ type ConfigSpec struct {
 	Database  Database  `yaml:"database"`
 	Targets   Targets   `yaml:"targets"`
 	Prune     Prune     `yaml:"prune"`
+	Binlog    Binlog    `yaml:"binlog"`
 	Telemetry Telemetry `yaml:"telemetry"`
 }
 
 type Dump struct {
-	Include          []string      `yaml:"include"`
-	Exclude          []string      `yaml:"exclude"`
-	Safechars        bool          `yaml:"safechars"`
-	NoDatabaseName   bool          `yaml:"no-database-name"`
-	Schedule         Schedule      `yaml:"schedule"`
-	Compression      string        `yaml:"compression"`
-	Compact          bool          `yaml:"compact"`
-	MaxAllowedPacket int           `yaml:"max-allowed-packet"`
-	FilenamePattern  string        `yaml:"filename-pattern"`
-	Scripts          BackupScripts `yaml:"scripts"`
-	Targets          []string      `yaml:"targets"`
+	Include          []string               `yaml:"include"`
+	Exclude          []string               `yaml:"exclude"`
+	IncludeTables    []string               `yaml:"include-tables"`
+	ExcludeTables    []string               `yaml:"exclude-tables"`
+	TableFilters     map[string]TableFilter `yaml:"table-filters"`
+	Masking          Masking                `yaml:"masking"`
+	NoData           bool                   `yaml:"no-data"`
+	NoCreateInfo     bool                   `yaml:"no-create-info"`
+	NoDataTables     []string               `yaml:"no-data-tables"`
+	SourceData       int                    `yaml:"source-data"`
+	Safechars        bool                   `yaml:"safechars"`
+	NoDatabaseName   bool                   `yaml:"no-database-name"`
+	Schedule         Schedule               `yaml:"schedule"`
+	Compression      string                 `yaml:"compression"`
+	CompressionLevel int                    `yaml:"compression-level"`
+	Encryption       Encryption             `yaml:"encryption"`
+	Compact          bool                   `yaml:"compact"`
+	MaxAllowedPacket int                    `yaml:"max-allowed-packet"`
+	Triggers         *bool                  `yaml:"triggers"`
+	Routines         bool                   `yaml:"routines"`
+	Events           bool                   `yaml:"events"`
+	Parallelism      int                    `yaml:"parallelism"`
+	Streaming        bool                   `yaml:"streaming"`
+	FilenamePattern  string                 `yaml:"filename-pattern"`
+	Scripts          BackupScripts          `yaml:"scripts"`
+	Targets          []string               `yaml:"targets"`
+}
+
+// TableFilter the rows of a table to dump
+type TableFilter struct {
+	Where string `yaml:"where"`
+	Limit int    `yaml:"limit"`
+}
+
+// Masking how to mask the values of columns as they are dumped
+type Masking struct {
+	Salt  string              `yaml:"salt"`
+	Rules map[string]MaskRule `yaml:"rules"`
+}
+
+// MaskRule how to mask a column
+type MaskRule struct {
+	Type      string `yaml:"type"`
+	Value     string `yaml:"value"`
+	KeepStart int    `yaml:"keep-start"`
+	KeepEnd   int    `yaml:"keep-end"`
+	Length    int    `yaml:"length"`
 }
 
 type Prune struct {
 	Retention string `yaml:"retention"`
+	// KeepLast and the others are the grandfather-father-son retention policy: how many of the most
+	// recent backups, and of the most recent backup of each day, week, month and year, to keep
+	KeepLast    int `yaml:"keep-last"`
+	KeepDaily   int `yaml:"keep-daily"`
+	KeepWeekly  int `yaml:"keep-weekly"`
+	KeepMonthly int `yaml:"keep-monthly"`
+	KeepYearly  int `yaml:"keep-yearly"`
+	// MinKeep, MaxBackupAge and MaxDeleteFraction guard against removing too much
+	MinKeep           int     `yaml:"min-keep"`
+	MaxBackupAge      string  `yaml:"max-backup-age"`
+	MaxDeleteFraction float64 `yaml:"max-delete-fraction"`
+}
+
+// Binlog archiving of the binary log; it is archived to the targets of the dump, with its
+// compression and encryption
+type Binlog struct {
+	ServerID    uint32 `yaml:"server-id"`
+	SegmentSize int64  `yaml:"segment-size"`
+	SegmentAge  string `yaml:"segment-age"`
 }
 
 type Schedule struct {
@@ -53,7 +109,28 @@ type BackupScripts struct {
 }
 
 type Restore struct {
-	Scripts RestoreScripts `yaml:"scripts"`
+	Scripts     RestoreScripts `yaml:"scripts"`
+	Parallelism int            `yaml:"parallelism"`
+	Encryption  Encryption     `yaml:"encryption"`
+	Drill       Drill          `yaml:"drill"`
+}
+
+type Drill struct {
+	Schedule Schedule     `yaml:"schedule"`
+	Queries  []DrillQuery `yaml:"queries"`
+	Report   string       `yaml:"report"`
+}
+
+type DrillQuery struct {
+	Name   string `yaml:"name"`
+	Schema string `yaml:"schema"`
+	Query  string `yaml:"query"`
+	Expect string `yaml:"expect"`
+}
+
+type Encryption struct {
+	Type string `yaml:"type"`
+	Key  string `yaml:"key"`
 }
 
 type RestoreScripts struct {
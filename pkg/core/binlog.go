@@ -0,0 +1,257 @@
+package core
+
+import (
+	"archive/tar"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+// maxHeartbeat the longest the server is left to be idle before it sends a heartbeat
+const maxHeartbeat = 30 * time.Second
+
+// Binlog archives the binary log of the server to the targets, as segments, each of which is a
+// compressed, and optionally encrypted, archive of a binary log file of its own. It reads the binary
+// log as a replica does, until ctx is done, or, with Once, until it reaches the end of it. A
+// segment that is incomplete when it stops is archived as it is.
+func Binlog(ctx context.Context, opts BinlogOptions) error {
+	if len(opts.Targets) == 0 {
+		return errors.New("no targets")
+	}
+	if opts.ServerID == 0 {
+		return errors.New("server ID must not be 0")
+	}
+
+	db, err := sql.Open("mysql", opts.DBConn.MySQL())
+	if err != nil {
+		return fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+	// the events are read with their checksums, so they are archived exactly as they are on the server
+	var checksum string
+	if err := db.QueryRowContext(ctx, "SELECT @@GLOBAL.binlog_checksum").Scan(&checksum); err != nil {
+		return fmt.Errorf("failed to get checksum of binary log: %v", err)
+	}
+	// unless told where to start, each target carries on from where its archive ends
+	var (
+		start = opts.Start
+		ends  []binlog.Position
+	)
+	if start.File == "" {
+		if ends, err = archivedEnds(opts.Targets); err != nil {
+			return err
+		}
+		if start, err = binlogStart(ctx, db, ends); err != nil {
+			return err
+		}
+	}
+
+	tmpdir, err := os.MkdirTemp("", "databacker_binlog")
+	if err != nil {
+		return fmt.Errorf("failed to make temporary working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	conn, err := binlog.Dial(ctx, opts.DBConn)
+	if err != nil {
+		return fmt.Errorf("failed to connect as replica: %v", err)
+	}
+	defer conn.Close()
+	// the read of the next event only ends when the connection is closed
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	heartbeat := maxHeartbeat
+	if opts.SegmentAge > 0 && opts.SegmentAge < heartbeat {
+		heartbeat = opts.SegmentAge
+	}
+	useChecksum := strings.EqualFold(checksum, "CRC32")
+	if err := conn.Dump(start, opts.ServerID, heartbeat, useChecksum, opts.Once); err != nil {
+		return fmt.Errorf("failed to start reading binary log: %v", err)
+	}
+	log.Infof("archiving binary log from %s", start)
+
+	archiver := &binlog.Archiver{
+		Dir:      tmpdir,
+		MaxSize:  opts.SegmentSize,
+		MaxAge:   opts.SegmentAge,
+		Checksum: useChecksum,
+		// the segments up to the end of the archive of each target are pushed only to those
+		// that do not have them, so end them there
+		Boundaries: ends,
+		Complete: func(seg binlog.Segment, path string) error {
+			return archiveSegment(opts, seg, path, tmpdir, ends)
+		},
+	}
+	archiver.Start(start)
+	var readErr error
+	for {
+		ev, err := conn.ReadEvent()
+		if err != nil {
+			readErr = err
+			break
+		}
+		if err := archiver.Add(ev); err != nil {
+			return err
+		}
+	}
+	// the events read so far are complete, so archive them, however the read ended
+	if err := archiver.Flush(); err != nil {
+		return err
+	}
+	switch {
+	case errors.Is(readErr, io.EOF):
+		log.Infof("archived binary log up to %s", archiver.Position())
+	case ctx.Err() != nil:
+		log.Infof("stopped archiving binary log at %s", archiver.Position())
+	default:
+		return fmt.Errorf("failed to read binary log at %s: %v", archiver.Position(), readErr)
+	}
+	return nil
+}
+
+// binlogStart where to start reading the binary log: the earliest of the ends of the segments
+// archived to each of the targets, so that none of them is left with a gap, such as after a
+// segment was pushed to some of them but not others; or, if none has any, the current position
+// of the server. A target without any segments starts from where the others are.
+func binlogStart(ctx context.Context, db *sql.DB, ends []binlog.Position) (binlog.Position, error) {
+	var start binlog.Position
+	for _, end := range ends {
+		if end.File != "" && (start.File == "" || end.Before(start)) {
+			start = end
+		}
+	}
+	if start.File != "" {
+		return start, nil
+	}
+	pos, err := mysql.QueryBinlogPosition(ctx, db)
+	if err != nil {
+		return binlog.Position{}, fmt.Errorf("failed to get position in binary log: %v", err)
+	}
+	if pos == nil {
+		return binlog.Position{}, errors.New("binary logging is not enabled on the server")
+	}
+	return binlog.Position{File: pos.File, Pos: pos.Position}, nil
+}
+
+// archivedEnds the end of the last segment archived to each of the targets, or the zero Position
+// for a target that has none
+func archivedEnds(targets []storage.Storage) ([]binlog.Position, error) {
+	ends := make([]binlog.Position, len(targets))
+	for i, target := range targets {
+		segments, err := listSegments(target)
+		if err != nil {
+			return nil, err
+		}
+		if len(segments) > 0 {
+			last := segments[len(segments)-1]
+			ends[i] = binlog.Position{File: last.File, Pos: last.End}
+		}
+	}
+	return ends, nil
+}
+
+// archivedSegment a segment archived to a target, by the name of its file
+type archivedSegment struct {
+	binlog.Segment
+	filename string
+}
+
+// listSegments the segments of the binary log archived to the target, in the order of the binary log
+func listSegments(target storage.Storage) ([]archivedSegment, error) {
+	files, err := target.ReadDir(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory of %s: %v", target.URL(), err)
+	}
+	var segments []archivedSegment
+	for _, fileInfo := range files {
+		if seg, ok := binlog.ParseSegmentName(fileInfo.Name()); ok {
+			segments = append(segments, archivedSegment{Segment: seg, filename: fileInfo.Name()})
+		}
+	}
+	slices.SortFunc(segments, func(a, b archivedSegment) int {
+		if c := binlog.CompareFiles(a.File, b.File); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Start, b.Start)
+	})
+	return segments, nil
+}
+
+// archiveSegment archives the segment, in the file at path, and pushes it to each of the targets
+// that does not have it already, as its archive, which ends at ends[i], if ends is set, is after it
+func archiveSegment(opts BinlogOptions, seg binlog.Segment, path, tmpdir string, ends []binlog.Position) error {
+	name := seg.Name(opts.Safechars)
+	filename := name + "." + opts.Compressor.Extension()
+	if opts.Encryptor != nil {
+		filename += "." + opts.Encryptor.Extension()
+	}
+	archivePath := filepath.Join(tmpdir, filename)
+	if err := writeSegmentArchive(opts, path, name+".bin", archivePath); err != nil {
+		return err
+	}
+	defer os.Remove(archivePath)
+	for i, t := range opts.Targets {
+		if ends != nil && !ends[i].Before(binlog.Position{File: seg.File, Pos: seg.End}) {
+			log.Debugf("%s already has binary log %s up to %d", t.URL(), seg.File, seg.End)
+			continue
+		}
+		copied, err := pushFile(t, filename, archivePath)
+		if err != nil {
+			return fmt.Errorf("failed to push segment of binary log %s to %s: %v", filename, t.URL(), err)
+		}
+		log.Debugf("completed copying %d bytes of %s to %s", copied, filename, t.URL())
+	}
+	log.Infof("archived binary log %s from %d to %d", seg.File, seg.Start, seg.End)
+	return nil
+}
+
+// writeSegmentArchive writes the file at path, as entry, to an archive at archivePath
+func writeSegmentArchive(opts BinlogOptions, path, entry, archivePath string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive of segment: %v", err)
+	}
+	defer out.Close()
+	cw, err := archiveWriter(out, opts.Compressor, opts.Encryptor)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	if err := tw.WriteHeader(&tar.Header{Name: entry, Mode: 0o644, Size: fi.Size(), ModTime: fi.ModTime()}); err != nil {
+		return fmt.Errorf("failed to archive segment: %v", err)
+	}
+	if _, err := io.Copy(tw, in); err != nil {
+		return fmt.Errorf("failed to archive segment: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to archive segment: %v", err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("failed to archive segment: %v", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+)
+
+func TestBinlogResume(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	segment := func(file string, start, end int) string {
+		return fmt.Sprintf("binlog_%s_%s_%d-%d.tgz", now.Format(time.RFC3339), file, start, end)
+	}
+	// the last segment was pushed to the first target, but not the second; the third is new
+	archives := [][]string{
+		{segment("binlog.000001", 4, 500), segment("binlog.000001", 500, 1000)},
+		{segment("binlog.000001", 4, 500)},
+		nil,
+	}
+	var (
+		targets []storage.Storage
+		dirs    []string
+	)
+	for _, files := range archives {
+		dir := t.TempDir()
+		for _, name := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, store)
+		dirs = append(dirs, dir)
+	}
+
+	ends, err := archivedEnds(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEnds := []binlog.Position{{File: "binlog.000001", Pos: 1000}, {File: "binlog.000001", Pos: 500}, {}}
+	if fmt.Sprint(ends) != fmt.Sprint(expectedEnds) {
+		t.Fatalf("expected ends %v, got %v", expectedEnds, ends)
+	}
+	// from the earliest end, so the second target gets what it is missing
+	start, err := binlogStart(context.Background(), nil, ends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != (binlog.Position{File: "binlog.000001", Pos: 500}) {
+		t.Errorf("expected to start at binlog.000001:500, got %s", start)
+	}
+
+	// each segment is pushed only to the targets that do not have it already
+	opts := BinlogOptions{Targets: targets, Compressor: &compression.GzipCompressor{}}
+	tmpdir := t.TempDir()
+	for _, seg := range []binlog.Segment{
+		{File: "binlog.000001", Start: 500, End: 1000, Time: now},
+		{File: "binlog.000001", Start: 1000, End: 1500, Time: now},
+	} {
+		path := filepath.Join(tmpdir, "segment")
+		if err := os.WriteFile(path, binlog.Magic, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := archiveSegment(opts, seg, path, tmpdir, ends); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := [][]string{
+		{segment("binlog.000001", 4, 500), segment("binlog.000001", 500, 1000), segment("binlog.000001", 1000, 1500)},
+		{segment("binlog.000001", 4, 500), segment("binlog.000001", 500, 1000), segment("binlog.000001", 1000, 1500)},
+		{segment("binlog.000001", 500, 1000), segment("binlog.000001", 1000, 1500)},
+	}
+	for i, target := range targets {
+		segments, err := listSegments(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, seg := range segments {
+			names = append(names, seg.filename)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(expected[i]) {
+			t.Errorf("target %s: expected %v, got %v", dirs[i], expected[i], names)
+		}
+	}
+}
+
+func TestListSegments(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	// in order of the binary log, which is not the order of their names
+	expected := []string{
+		binlog.Segment{File: "binlog.999999", Start: 4, End: 1000, Time: now}.Name(false) + ".tgz",
+		binlog.Segment{File: "binlog.999999", Start: 1000, End: 2000, Time: now, EndOfFile: true}.Name(false) + ".tgz",
+		binlog.Segment{File: "binlog.1000000", Start: 4, End: 500, Time: now}.Name(false) + ".tgz",
+		binlog.Segment{File: "binlog.1000000", Start: 500, End: 900, Time: now}.Name(false) + ".tgz",
+	}
+	dir := t.TempDir()
+	for _, name := range append([]string{"db_backup_2026-10-01T00:00:00Z.tgz"}, expected...) {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := listSegments(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, seg := range segments {
+		names = append(names, seg.filename)
+	}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+type BinlogOptions struct {
+	Targets    []storage.Storage
+	Safechars  bool
+	DBConn     database.Connection
+	Compressor compression.Compressor
+	Encryptor  encrypt.Encryptor
+	// ServerID the server ID with which to read the binary log as a replica; it must differ from
+	// that of the server and of any other replica of it
+	ServerID uint32
+	// Start where to start reading the binary log. If its File is blank, it is the end of the last
+	// segment archived to any of the targets, or, if there are none, the current position of the server.
+	Start binlog.Position
+	// SegmentSize and SegmentAge when to complete a segment and archive it; 0 for no limit
+	SegmentSize int64
+	SegmentAge  time.Duration
+	// Once archive up to the current end of the binary log and stop, rather than waiting for more
+	Once bool
+}
@@ -0,0 +1,253 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+)
+
+// maxSchemaName the longest name of a schema the server accepts
+const maxSchemaName = 64
+
+// ErrDrillFailed the backup was restored, but failed one or more of the checks of a drill
+var ErrDrillFailed = errors.New("restore drill failed")
+
+// DrillReport the result of a restore drill
+type DrillReport struct {
+	Target string    `json:"target"`
+	File   string    `json:"file"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Passed whether the backup was restored, and passed all of the checks
+	Passed bool `json:"passed"`
+	// Error why the drill could not be completed, if it could not
+	Error string `json:"error,omitempty"`
+	// Schemas the scratch schema to which each schema in the backup was restored
+	Schemas map[string]string  `json:"schemas"`
+	Tables  []DrillTableResult `json:"tables"`
+	Queries []DrillQueryResult `json:"queries"`
+}
+
+// DrillTableResult the rows restored to a table, compared to those in the manifest
+type DrillTableResult struct {
+	Schema   string `json:"schema"`
+	Table    string `json:"table"`
+	Expected int64  `json:"expected"`
+	Actual   int64  `json:"actual"`
+	Passed   bool   `json:"passed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DrillQueryResult the result of a sanity query
+type DrillQueryResult struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema,omitempty"`
+	Query  string `json:"query"`
+	Expect string `json:"expect,omitempty"`
+	Result string `json:"result"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Drill restores a backup into scratch schemas, named for the drill, rather than the schemas
+// from which it was dumped. It then compares the rows in each table with those recorded in the
+// manifest, if there is one, runs the sanity queries, and finally drops the scratch schemas.
+// The report always is returned, with ErrDrillFailed if any check failed, or another error if
+// the drill could not be completed.
+func Drill(opts DrillOptions) (*DrillReport, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	report := &DrillReport{
+		Target:  opts.Restore.Target.URL(),
+		File:    opts.Restore.TargetFile,
+		Start:   now.UTC(),
+		Schemas: map[string]string{},
+	}
+	targetFile, err := resolveTargetFile(opts.Restore)
+	if err == nil {
+		// each scheduled drill of the latest backup drills the one that is latest at the time
+		opts.Restore.TargetFile = targetFile
+		report.File = targetFile
+		err = drill(opts, now, report)
+	}
+	report.End = time.Now().UTC()
+	if err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+	report.Passed = true
+	for _, t := range report.Tables {
+		report.Passed = report.Passed && t.Passed
+	}
+	for _, q := range report.Queries {
+		report.Passed = report.Passed && q.Passed
+	}
+	if !report.Passed {
+		return report, ErrDrillFailed
+	}
+	return report, nil
+}
+
+// drill runs a drill, adding the results to the report
+func drill(opts DrillOptions, now time.Time, report *DrillReport) (err error) {
+	restoreOpts := opts.Restore
+	log.Infof("beginning restore drill of %s", restoreOpts.TargetFile)
+	cr, err := pullArchive(restoreOpts.Target, restoreOpts.TargetFile, restoreOpts.Compressor, restoreOpts.Decryptor)
+	if err != nil {
+		return err
+	}
+	defer cr.Close()
+
+	tmpdir, err := os.MkdirTemp("", "drill")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	if err := archive.Untar(cr, tmpdir); err != nil {
+		return fmt.Errorf("error extracting the file: %v", err)
+	}
+	groups, err := restoreFiles(tmpdir)
+	if err != nil {
+		return fmt.Errorf("failed to find extracted files to restore: %v", err)
+	}
+	var m *manifest.Manifest
+	if f, err := os.Open(filepath.Join(tmpdir, manifest.Filename)); err == nil {
+		m, err = manifest.Read(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// each schema in the backup is restored to a scratch schema of its own
+	schemas := map[string]bool{}
+	if m != nil {
+		for _, s := range m.Schemas {
+			schemas[s.Name] = true
+		}
+	}
+	for _, files := range groups {
+		for _, f := range files {
+			name, err := filepath.Rel(tmpdir, f)
+			if err != nil {
+				return err
+			}
+			schemas[dumpFileSchema(filepath.ToSlash(name))] = true
+		}
+	}
+	var scratch []string
+	for schema := range schemas {
+		report.Schemas[schema] = drillSchemaName(schema, now)
+		scratch = append(scratch, report.Schemas[schema])
+	}
+	sort.Strings(scratch)
+	// the scratch schemas always are dropped, even if the restore fails part way
+	defer func() {
+		log.Debugf("dropping scratch schemas %v", scratch)
+		if dropErr := database.DropDatabases(restoreOpts.DBConn, scratch); dropErr != nil && err == nil {
+			err = dropErr
+		}
+	}()
+
+	readers := make([][]io.ReadSeeker, 0, len(groups))
+	for _, files := range groups {
+		group := make([]io.ReadSeeker, 0, len(files))
+		for _, f := range files {
+			file, err := os.Open(f)
+			if err != nil {
+				return fmt.Errorf("failed to open extracted file: %v", err)
+			}
+			defer file.Close()
+			group = append(group, file)
+		}
+		readers = append(readers, group)
+	}
+	if err := database.Restore(restoreOpts.DBConn, report.Schemas, drillRestoreOpts(restoreOpts), readers); err != nil {
+		return fmt.Errorf("failed to restore database: %v", err)
+	}
+
+	// compare the rows restored to each table with those that were dumped
+	if m != nil {
+		for _, s := range m.Schemas {
+			tables := make([]string, 0, len(s.Tables))
+			for _, t := range s.Tables {
+				tables = append(tables, t.Name)
+			}
+			counts, countErr := database.CountRows(restoreOpts.DBConn, report.Schemas[s.Name], tables)
+			for _, t := range s.Tables {
+				result := DrillTableResult{Schema: s.Name, Table: t.Name, Expected: t.Rows}
+				if actual, ok := counts[t.Name]; ok {
+					result.Actual = actual
+					result.Passed = actual == t.Rows
+				} else if countErr != nil {
+					result.Error = countErr.Error()
+				}
+				report.Tables = append(report.Tables, result)
+			}
+		}
+	} else {
+		log.Warnf("%s has no manifest, so restored rows cannot be checked", restoreOpts.TargetFile)
+	}
+
+	for _, q := range opts.Queries {
+		result := DrillQueryResult{Name: q.Name, Schema: q.Schema, Query: q.Query, Expect: q.Expect}
+		if result.Name == "" {
+			result.Name = q.Query
+		}
+		schema := q.Schema
+		if schema != "" {
+			var ok bool
+			if schema, ok = report.Schemas[q.Schema]; !ok {
+				result.Error = fmt.Sprintf("schema %s is not in the backup", q.Schema)
+				report.Queries = append(report.Queries, result)
+				continue
+			}
+		}
+		value, err := database.QueryValue(restoreOpts.DBConn, schema, q.Query)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Result = value
+			result.Passed = q.Expect == "" || value == q.Expect
+		}
+		report.Queries = append(report.Queries, result)
+	}
+	return nil
+}
+
+// drillRestoreOpts how a drill restores the backup. Its events are left out, as the server would
+// run them on its schedule, and they may act on other schemas than the scratch ones, such as those
+// from which the backup was made, on what often is the server in production.
+func drillRestoreOpts(restoreOpts RestoreOptions) database.RestoreOpts {
+	return database.RestoreOpts{
+		Parallelism: restoreOpts.Parallelism,
+		NoEvents:    true,
+	}
+}
+
+// drillSchemaName the name of the scratch schema to which schema is restored in a drill at now.
+// A name that would be too long is shortened, ending with a hash of the schema so that it
+// remains unique.
+func drillSchemaName(schema string, now time.Time) string {
+	name := fmt.Sprintf("drill_%s_%s", now.UTC().Format("20060102150405"), schema)
+	if len(name) > maxSchemaName {
+		h := fnv.New32a()
+		h.Write([]byte(schema))
+		suffix := fmt.Sprintf("_%08x", h.Sum32())
+		name = name[:maxSchemaName-len(suffix)] + suffix
+	}
+	return name
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrillSchemaName(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		schema   string
+		expected string
+	}{
+		{"shop", "drill_20240102030405_shop"},
+		{long + "1", "drill_20240102030405_" + long[:34] + "_1a9d6560"},
+		{long + "2", "drill_20240102030405_" + long[:34] + "_1d9d6a19"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			name := drillSchemaName(tt.schema, now)
+			if name != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, name)
+			}
+			if len(name) > maxSchemaName {
+				t.Errorf("name %s is longer than %d", name, maxSchemaName)
+			}
+		})
+	}
+}
+
+func TestDrillRestoreOpts(t *testing.T) {
+	opts := drillRestoreOpts(RestoreOptions{Parallelism: 4})
+	if !opts.NoEvents {
+		t.Error("drill restores events, which the server would run")
+	}
+	if opts.Parallelism != 4 {
+		t.Errorf("expected parallelism 4, got %d", opts.Parallelism)
+	}
+}
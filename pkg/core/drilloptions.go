@@ -0,0 +1,26 @@
+package core
+
+import "time"
+
+type DrillOptions struct {
+	// Restore the backup to restore, and the database to restore it into. Its DatabasesMap
+	// is replaced by the scratch schemas.
+	Restore RestoreOptions
+	// Queries sanity queries to run against the restored backup
+	Queries []DrillQuery
+	// Now the time of the drill, used to name the scratch schemas; if zero, the current time
+	Now time.Time
+}
+
+// DrillQuery a sanity query to run against a restored backup
+type DrillQuery struct {
+	// Name a name for the query in the report; if blank, the query itself is used
+	Name string
+	// Schema the schema in the backup in which to run the query; it is run in the scratch
+	// schema to which it is restored. If blank, it is run without a default database.
+	Schema string
+	Query  string
+	// Expect the expected value of the first column of the first row of the result. If
+	// blank, the query passes as long as it succeeds.
+	Expect string
+}
@@ -1,17 +1,26 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 )
 
 const (
@@ -23,12 +32,8 @@ const (
 func Dump(opts DumpOptions) error {
 	targets := opts.Targets
 	safechars := opts.Safechars
-	dbnames := opts.DBNames
 	dbconn := opts.DBConn
 	compressor := opts.Compressor
-	compact := opts.Compact
-	suppressUseDatabase := opts.SuppressUseDatabase
-	maxAllowedPacket := opts.MaxAllowedPacket
 
 	now := time.Now()
 	timepart := now.Format(time.RFC3339)
@@ -40,8 +45,15 @@ func Dump(opts DumpOptions) error {
 	// sourceFilename: file that the uploader looks for when performing the upload
 	// targetFilename: the remote file that is actually uploaded
 	sourceFilename := fmt.Sprintf("db_backup_%s.%s", timepart, compressor.Extension())
+	if opts.Encryptor != nil {
+		sourceFilename += "." + opts.Encryptor.Extension()
+	}
 	targetFilename := sourceFilename
 
+	if opts.Streaming {
+		return dumpStream(opts, now, timepart, targetFilename)
+	}
+
 	// create a temporary working directory
 	tmpdir, err := os.MkdirTemp("", "databacker_backup")
 	if err != nil {
@@ -60,32 +72,24 @@ func Dump(opts DumpOptions) error {
 	}
 	defer os.RemoveAll(workdir)
 
-	dw := make([]database.DumpWriter, 0)
-
 	// do we split the output by schema, or one big dump file?
-	if len(dbnames) == 0 {
-		if dbnames, err = database.GetSchemas(dbconn); err != nil {
-			return fmt.Errorf("failed to list database schemas: %v", err)
-		}
+	dbnames, err := dumpSchemas(opts)
+	if err != nil {
+		return err
 	}
-	for _, s := range dbnames {
-		outFile := path.Join(workdir, fmt.Sprintf("%s_%s.sql", s, timepart))
-		f, err := os.Create(outFile)
-		if err != nil {
-			return fmt.Errorf("failed to create dump file '%s': %v", outFile, err)
-		}
-		dw = append(dw, database.DumpWriter{
-			Schemas: []string{s},
-			Writer:  f,
-		})
+	m := manifest.New(now)
+	dw, err := dumpWriters(dbnames, timepart, opts.Parallelism > 1, m.TrackFiles(createIn(workdir)))
+	if err != nil {
+		return err
 	}
-	if err := database.Dump(dbconn, database.DumpOpts{
-		Compact:             compact,
-		SuppressUseDatabase: suppressUseDatabase,
-		MaxAllowedPacket:    maxAllowedPacket,
-	}, dw); err != nil {
+	result, err := database.Dump(dbconn, databaseDumpOpts(opts), dw)
+	if err != nil {
 		return fmt.Errorf("failed to dump database: %v", err)
 	}
+	completeManifest(m, opts, result)
+	if err := writeManifest(m, workdir); err != nil {
+		return err
+	}
 
 	// create my tar writer to archive it all together
 	// WRONG: THIS WILL CAUSE IT TO TRY TO LOOP BACK ON ITSELF
@@ -95,11 +99,11 @@ func Dump(opts DumpOptions) error {
 		return fmt.Errorf("failed to open output file '%s': %v", outFile, err)
 	}
 	defer f.Close()
-	cw, err := compressor.Compress(f)
+	cw, err := archiveWriter(f, compressor, opts.Encryptor)
 	if err != nil {
-		return fmt.Errorf("failed to create compressor: %v", err)
+		return err
 	}
-	if err := archive.Tar(workdir, cw); err != nil {
+	if err := archive.Tar(workdir, cw, manifest.Filename); err != nil {
 		return fmt.Errorf("error creating the compressed archive: %v", err)
 	}
 	// we need to close it explicitly before moving ahead
@@ -131,7 +135,7 @@ func Dump(opts DumpOptions) error {
 	// upload to each destination
 	for _, t := range targets {
 		log.Debugf("uploading via protocol %s from %s", t.Protocol(), targetFilename)
-		copied, err := t.Push(targetFilename, filepath.Join(tmpdir, sourceFilename))
+		copied, err := pushFile(t, targetFilename, filepath.Join(tmpdir, sourceFilename))
 		if err != nil {
 			return fmt.Errorf("failed to push file: %v", err)
 		}
@@ -141,6 +145,137 @@ func Dump(opts DumpOptions) error {
 	return nil
 }
 
+// pushFile uploads the local file source to the target as target
+func pushFile(t storage.Storage, target, source string) (int64, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return t.PushStream(context.Background(), target, f)
+}
+
+// archiveWriter wraps out in the compression of the backup, and then its encryption, if any.
+// Closing the returned writer completes both, but does not close out.
+func archiveWriter(out io.Writer, compressor compression.Compressor, encryptor encrypt.Encryptor) (io.WriteCloser, error) {
+	if encryptor == nil {
+		cw, err := compressor.Compress(out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create compressor: %v", err)
+		}
+		return cw, nil
+	}
+	ew, err := encryptor.Encrypt(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryptor: %v", err)
+	}
+	cw, err := compressor.Compress(ew)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compressor: %v", err)
+	}
+	return &chainedWriteCloser{WriteCloser: cw, next: ew}, nil
+}
+
+// chainedWriteCloser closes next after closing the writer itself
+type chainedWriteCloser struct {
+	io.WriteCloser
+	next io.Closer
+}
+
+func (c *chainedWriteCloser) Close() error {
+	if err := c.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return c.next.Close()
+}
+
+// databaseDumpOpts the options for the database dump itself
+func databaseDumpOpts(opts DumpOptions) database.DumpOpts {
+	return database.DumpOpts{
+		Compact:             opts.Compact,
+		SuppressUseDatabase: opts.SuppressUseDatabase,
+		MaxAllowedPacket:    opts.MaxAllowedPacket,
+		Triggers:            opts.Triggers,
+		Routines:            opts.Routines,
+		Events:              opts.Events,
+		Parallelism:         opts.Parallelism,
+		IncludeTables:       opts.IncludeTables,
+		ExcludeTables:       opts.ExcludeTables,
+		RowFilters:          opts.RowFilters,
+		Masks:               opts.Masks,
+		MaskSalt:            opts.MaskSalt,
+		NoData:              opts.NoData,
+		NoCreateInfo:        opts.NoCreateInfo,
+		NoDataTables:        opts.NoDataTables,
+		SourceData:          opts.SourceData,
+	}
+}
+
+// dumpSchemas the schemas to dump: those named in the options, or else all of them, less
+// any that are excluded
+func dumpSchemas(opts DumpOptions) ([]string, error) {
+	dbnames := opts.DBNames
+	if len(dbnames) == 0 {
+		var err error
+		if dbnames, err = database.GetSchemas(opts.DBConn); err != nil {
+			return nil, fmt.Errorf("failed to list database schemas: %v", err)
+		}
+	}
+	schemas := make([]string, 0, len(dbnames))
+	for _, s := range dbnames {
+		if slices.Contains(opts.Exclude, s) {
+			log.Debugf("excluding schema %s", s)
+			continue
+		}
+		schemas = append(schemas, s)
+	}
+	if len(schemas) == 0 {
+		return nil, errors.New("no schemas to dump, all are excluded")
+	}
+	return schemas, nil
+}
+
+// dumpWriters creates the writers for the dump of each schema, with create making each
+// file of the dump. Each schema gets its own file; when dumping in parallel, each table
+// goes to a file of its own, in a directory alongside the file for the schema. The table
+// name is escaped, as it may contain characters that are not valid in a filename.
+func dumpWriters(dbnames []string, timepart string, parallel bool, create func(name string) (io.WriteCloser, error)) ([]database.DumpWriter, error) {
+	dw := make([]database.DumpWriter, 0, len(dbnames))
+	for _, s := range dbnames {
+		f, err := create(fmt.Sprintf("%s_%s.sql", s, timepart))
+		if err != nil {
+			return nil, err
+		}
+		writer := database.DumpWriter{
+			Schemas: []string{s},
+			Writer:  f,
+		}
+		if parallel {
+			dir := fmt.Sprintf("%s_%s", s, timepart)
+			writer.TableWriter = func(schema, table string) (io.WriteCloser, error) {
+				return create(path.Join(dir, url.PathEscape(table)+".sql"))
+			}
+		}
+		dw = append(dw, writer)
+	}
+	return dw, nil
+}
+
+// createIn returns a function that creates each file of the dump in dir
+func createIn(dir string) func(name string) (io.WriteCloser, error) {
+	return func(name string) (io.WriteCloser, error) {
+		outFile := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(outFile), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create dump directory '%s': %v", path.Dir(outFile), err)
+		}
+		f, err := os.Create(outFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dump file '%s': %v", outFile, err)
+		}
+		return f, nil
+	}
+}
+
 // run pre-backup scripts, if they exist
 func preBackup(timestamp, dumpfile, dumpdir, preBackupDir string, debug bool) error {
 	// construct any additional environment
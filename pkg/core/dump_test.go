@@ -0,0 +1,31 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestDumpSchemas(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     DumpOptions
+		expected []string
+		wantErr  bool
+	}{
+		{"named", DumpOptions{DBNames: []string{"shop", "crm"}}, []string{"shop", "crm"}, false},
+		{"excluded", DumpOptions{DBNames: []string{"shop", "crm", "logs"}, Exclude: []string{"logs"}}, []string{"shop", "crm"}, false},
+		{"all excluded", DumpOptions{DBNames: []string{"logs"}, Exclude: []string{"logs"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemas, err := dumpSchemas(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if diff := deep.Equal(schemas, tt.expected); diff != nil {
+				t.Errorf("mismatched schemas: %v", diff)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package core
 import (
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 )
 
@@ -12,10 +15,25 @@ type DumpOptions struct {
 	DBNames             []string
 	DBConn              database.Connection
 	Compressor          compression.Compressor
+	Encryptor           encrypt.Encryptor
 	Exclude             []string
+	IncludeTables       []string
+	ExcludeTables       []string
+	RowFilters          map[string]mysql.RowFilter
+	Masks               map[string]mask.Rule
+	MaskSalt            string
+	NoData              bool
+	NoCreateInfo        bool
+	NoDataTables        []string
+	SourceData          int
 	PreBackupScripts    string
 	PostBackupScripts   string
 	Compact             bool
 	SuppressUseDatabase bool
 	MaxAllowedPacket    int
+	Triggers            bool
+	Routines            bool
+	Events              bool
+	Parallelism         int
+	Streaming           bool
 }
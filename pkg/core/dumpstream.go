@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+// dumpStream runs the dump as a single pipeline, from the database, through the archive and
+// compression and encryption, directly to each of the targets, without writing anything to local disk. The
+// memory used is bounded by the size of a part of the archive for each file being written
+// at once, and by the buffers of the uploads, no matter how large the database.
+//
+// As there is no local file, the backup scripts cannot be run.
+func dumpStream(opts DumpOptions, start time.Time, timepart, targetFilename string) error {
+	if opts.PreBackupScripts != "" || opts.PostBackupScripts != "" {
+		return errors.New("pre- and post-backup scripts are not supported when streaming")
+	}
+	for _, cmd := range []string{sourceRenameCmd, targetRenameCmd} {
+		if _, err := os.Stat(cmd); err == nil {
+			log.Warnf("rename script %s is ignored when streaming", cmd)
+		}
+	}
+
+	dbnames, err := dumpSchemas(opts)
+	if err != nil {
+		return err
+	}
+	serverVersion, err := database.ServerVersion(opts.DBConn)
+	if err != nil {
+		return err
+	}
+
+	return streamToTargets(opts.Targets, targetFilename, func(w io.Writer) error {
+		cw, err := archiveWriter(w, opts.Compressor, opts.Encryptor)
+		if err != nil {
+			return err
+		}
+		sw := archive.NewStreamWriter(cw, 0)
+		// the complete manifest only can be written once everything else is, at the end, so what
+		// is known already goes first, where it can be read without reading the whole backup
+		if err := writeStreamManifest(sw, preliminaryManifest(start, opts, serverVersion, dbnames)); err != nil {
+			return err
+		}
+		create := func(name string) (io.WriteCloser, error) {
+			return sw.Create(name), nil
+		}
+		m := manifest.New(start)
+		dw, err := dumpWriters(dbnames, timepart, opts.Parallelism > 1, m.TrackFiles(create))
+		if err != nil {
+			return err
+		}
+		result, err := database.Dump(opts.DBConn, databaseDumpOpts(opts), dw)
+		if err != nil {
+			return fmt.Errorf("failed to dump database: %v", err)
+		}
+		completeManifest(m, opts, result)
+		if err := writeStreamManifest(sw, m); err != nil {
+			return err
+		}
+		if err := sw.Close(); err != nil {
+			return fmt.Errorf("error creating the archive: %v", err)
+		}
+		if err := cw.Close(); err != nil {
+			return fmt.Errorf("error compressing the archive: %v", err)
+		}
+		return nil
+	})
+}
+
+// streamToTargets streams what write writes to the file targetFilename in each of the targets.
+// Each target reads from a pipe of its own, all of which are written at once. If an upload fails,
+// the write fails, and if either fails, the partial file is removed from every target.
+func streamToTargets(targets []storage.Storage, targetFilename string, write func(w io.Writer) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		wg         sync.WaitGroup
+		pipes      = make([]*io.PipeWriter, 0, len(targets))
+		writers    = make([]io.Writer, 0, len(targets))
+		uploadErrs = make([]error, len(targets))
+	)
+	for i, t := range targets {
+		pr, pw := io.Pipe()
+		pipes = append(pipes, pw)
+		writers = append(writers, pw)
+		wg.Add(1)
+		go func(i int, t storage.Storage, pr *io.PipeReader) {
+			defer wg.Done()
+			log.Debugf("streaming via protocol %s to %s", t.Protocol(), targetFilename)
+			copied, err := t.PushStream(ctx, targetFilename, pr)
+			if err != nil {
+				err = fmt.Errorf("failed to push file to %s: %v", t.URL(), err)
+				uploadErrs[i] = err
+				// stop the dump, rather than leaving it blocked on an upload that has ended
+				_ = pr.CloseWithError(err)
+				return
+			}
+			_ = pr.Close()
+			log.Debugf("completed streaming %d bytes to %s", copied, t.URL())
+		}(i, t, pr)
+	}
+
+	dumpErr := write(io.MultiWriter(writers...))
+
+	// a nil error closes the pipes normally, completing the uploads; anything else aborts them
+	for _, pw := range pipes {
+		_ = pw.CloseWithError(dumpErr)
+	}
+	wg.Wait()
+
+	// an upload that fails aborts the dump with its error, whereas a dump that fails aborts every
+	// upload with its own, so it is the error of the dump, if any, that says what went wrong
+	err := dumpErr
+	if err == nil {
+		err = errors.Join(uploadErrs...)
+	}
+	if err != nil {
+		// do not leave a partial backup behind
+		for _, t := range targets {
+			if rmErr := t.Remove(targetFilename); rmErr != nil {
+				log.Debugf("unable to remove partial backup %s from %s: %v", targetFilename, t.URL(), rmErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// writeStreamManifest writes the manifest to the archive being streamed
+func writeStreamManifest(sw *archive.StreamWriter, m *manifest.Manifest) error {
+	mw := sw.Create(manifest.Filename)
+	if err := m.Write(mw); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return nil
+}
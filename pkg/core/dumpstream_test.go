@@ -0,0 +1,149 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+)
+
+// failingStorage a target whose upload fails after part of the file has been written to it
+type failingStorage struct {
+	storage.Storage
+}
+
+func (f failingStorage) PushStream(ctx context.Context, target string, r io.Reader) (int64, error) {
+	n, err := f.Storage.PushStream(ctx, target, io.LimitReader(r, 1024))
+	if err != nil {
+		return n, err
+	}
+	return n, errors.New("connection reset")
+}
+
+func TestStreamToTargets(t *testing.T) {
+	const filename = "db_backup_2026-10-01T00:00:00Z.tgz"
+	// more than fits in the buffers of the pipeline, so the upload of each target must keep up
+	files := map[string]string{
+		"app_2026-10-01T00:00:00Z.sql":       strings.Repeat("INSERT INTO `t` VALUES (1);\n", 1<<16),
+		"app_2026-10-01T00:00:00Z/users.sql": strings.Repeat("INSERT INTO `users` VALUES (2);\n", 1<<15),
+	}
+	names := []string{"app_2026-10-01T00:00:00Z.sql", "app_2026-10-01T00:00:00Z/users.sql"}
+	writeArchive := func(w io.Writer) error {
+		cw, err := archiveWriter(w, &compression.GzipCompressor{}, nil)
+		if err != nil {
+			return err
+		}
+		sw := archive.NewStreamWriter(cw, 0)
+		for _, name := range names {
+			fw := sw.Create(name)
+			if _, err := io.WriteString(fw, files[name]); err != nil {
+				return err
+			}
+			if err := fw.Close(); err != nil {
+				return err
+			}
+		}
+		if err := sw.Close(); err != nil {
+			return err
+		}
+		return cw.Close()
+	}
+	newTarget := func() (storage.Storage, string) {
+		dir := t.TempDir()
+		store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store, dir
+	}
+
+	t.Run("complete", func(t *testing.T) {
+		first, _ := newTarget()
+		second, _ := newTarget()
+		if err := streamToTargets([]storage.Storage{first, second}, filename, writeArchive); err != nil {
+			t.Fatal(err)
+		}
+		// each target has the whole of the archive
+		for _, target := range []storage.Storage{first, second} {
+			r, err := pullArchive(target, filename, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sr := archive.NewStreamReader(r)
+			for _, name := range names {
+				read, err := sr.Next()
+				if err != nil {
+					t.Fatalf("%s: %v", target.URL(), err)
+				}
+				var b bytes.Buffer
+				if _, err := io.Copy(&b, sr); err != nil {
+					t.Fatalf("%s: %v", target.URL(), err)
+				}
+				if read != name || b.String() != files[name] {
+					t.Errorf("%s: mismatched file %s, expected %s, %d bytes of %d", target.URL(), read, name, b.Len(), len(files[name]))
+				}
+			}
+			if _, err := sr.Next(); err != io.EOF {
+				t.Errorf("%s: expected end of archive, got %v", target.URL(), err)
+			}
+			r.Close()
+		}
+	})
+
+	t.Run("failed upload", func(t *testing.T) {
+		healthy, healthyDir := newTarget()
+		failing, failingDir := newTarget()
+		var writeErr error
+		err := streamToTargets([]storage.Storage{healthy, failingStorage{failing}}, filename, func(w io.Writer) error {
+			writeErr = writeArchive(w)
+			return writeErr
+		})
+		if err == nil || !strings.Contains(err.Error(), "connection reset") {
+			t.Fatalf("unexpected error %v", err)
+		}
+		// the failed upload aborts the dump, rather than leaving it blocked
+		if writeErr == nil {
+			t.Error("dump was not aborted by the failed upload")
+		}
+		for _, dir := range []string{healthyDir, failingDir} {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("partial backup left in %s: %v", dir, entries)
+			}
+		}
+	})
+
+	t.Run("failed dump", func(t *testing.T) {
+		first, firstDir := newTarget()
+		second, secondDir := newTarget()
+		err := streamToTargets([]storage.Storage{first, second}, filename, func(w io.Writer) error {
+			if _, err := io.WriteString(w, "part of an archive"); err != nil {
+				return err
+			}
+			return errors.New("failed to dump database")
+		})
+		if err == nil || err.Error() != "failed to dump database" {
+			t.Fatalf("unexpected error %v", err)
+		}
+		for _, dir := range []string{firstDir, secondDir} {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("partial backup left in %s: %v", dir, entries)
+			}
+		}
+	})
+}
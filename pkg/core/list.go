@@ -0,0 +1,151 @@
+package core
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+// Backup a backup in a target
+type Backup struct {
+	Target      string    `json:"target"`
+	Name        string    `json:"name"`
+	Time        time.Time `json:"time"`
+	Size        int64     `json:"size"`
+	Compression string    `json:"compression,omitempty"`
+	Encryption  string    `json:"encryption,omitempty"`
+	// Manifest a summary of the manifest of the backup, if it was read
+	Manifest *ManifestSummary `json:"manifest,omitempty"`
+}
+
+// ManifestSummary the main details of the manifest of a backup
+type ManifestSummary struct {
+	ServerHost    string        `json:"server-host"`
+	ServerVersion string        `json:"server-version"`
+	Duration      time.Duration `json:"duration"`
+	Schemas       int           `json:"schemas"`
+	Tables        int           `json:"tables"`
+	Rows          int64         `json:"rows"`
+	Bytes         int64         `json:"bytes"`
+	// Preliminary whether the summary is of the preliminary manifest at the start of a streamed
+	// backup, which does not have the duration, tables, rows or bytes of the backup
+	Preliminary bool `json:"preliminary,omitempty"`
+}
+
+// List lists the backups in each of the targets, oldest first
+func List(opts ListOptions) ([]Backup, error) {
+	if len(opts.Targets) == 0 {
+		return nil, errors.New("no targets")
+	}
+	var backups []Backup
+	for _, target := range opts.Targets {
+		log.Debugf("listing target %s", target.URL())
+		files, err := target.ReadDir(".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory of %s: %v", target.URL(), err)
+		}
+		for _, fileInfo := range files {
+			filename := fileInfo.Name()
+			filetime, ok := backupTime(filename)
+			if !ok {
+				continue
+			}
+			if (!opts.Since.IsZero() && filetime.Before(opts.Since)) || (!opts.Until.IsZero() && !filetime.Before(opts.Until)) {
+				continue
+			}
+			backup := Backup{
+				Target: target.URL(),
+				Name:   filename,
+				Time:   filetime,
+				Size:   fileInfo.Size(),
+			}
+			compressed := filename
+			for _, e := range []string{encrypt.Age, encrypt.PGP} {
+				if ext := "." + encryptionExtension(e); strings.HasSuffix(filename, ext) {
+					backup.Encryption = e
+					compressed = strings.TrimSuffix(filename, ext)
+				}
+			}
+			if c := compression.ForFilename(compressed); c != nil {
+				backup.Compression = compression.Name(c)
+			}
+			if opts.Manifest {
+				summary, err := readManifestSummary(target, filename, opts.Decryptor)
+				if err != nil {
+					log.Debugf("unable to read manifest of %s: %v", filename, err)
+				}
+				backup.Manifest = summary
+			}
+			backups = append(backups, backup)
+		}
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].Time.Equal(backups[j].Time) {
+			return backups[i].Time.Before(backups[j].Time)
+		}
+		return backups[i].Target < backups[j].Target
+	})
+	return backups, nil
+}
+
+// encryptionExtension the extension of files encrypted with the named encryption
+func encryptionExtension(name string) string {
+	switch name {
+	case encrypt.Age:
+		return "age"
+	case encrypt.PGP:
+		return "gpg"
+	}
+	return ""
+}
+
+// readManifestSummary reads the manifest of a backup, if it is the first file in the archive,
+// without reading the rest of the backup. That of a streamed backup is its preliminary manifest,
+// as its complete one is at the end. Returns nil if there is no manifest at the start of the backup.
+func readManifestSummary(target storage.Storage, filename string, decryptor encrypt.Decryptor) (*ManifestSummary, error) {
+	cr, err := pullArchive(target, filename, nil, decryptor)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+	tr := tar.NewReader(cr)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if header.Name != manifest.Filename {
+		return nil, nil
+	}
+	m, err := manifest.Read(tr)
+	if err != nil {
+		return nil, err
+	}
+	summary := &ManifestSummary{
+		ServerHost:    m.Server.Host,
+		ServerVersion: m.Server.Version,
+		Schemas:       len(m.Schemas),
+		Preliminary:   m.Preliminary,
+	}
+	if m.Preliminary {
+		return summary, nil
+	}
+	summary.Duration = m.End.Sub(m.Start)
+	for _, s := range m.Schemas {
+		summary.Tables += len(s.Tables)
+		for _, t := range s.Tables {
+			summary.Rows += t.Rows
+			summary.Bytes += t.Bytes
+		}
+	}
+	return summary, nil
+}
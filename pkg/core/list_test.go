@@ -0,0 +1,203 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+)
+
+func TestList(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	// a backup with a manifest as its first entry, as written by a non-streaming dump
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := manifest.New(start)
+	m.End = start.Add(90 * time.Second)
+	m.Server = manifest.Server{Host: "db", Version: "10.11.6-MariaDB"}
+	m.Schemas = []manifest.Schema{{Name: "app", Tables: []manifest.Table{{Name: "a", Rows: 3, Bytes: 30}, {Name: "b", Rows: 2, Bytes: 20}}}}
+	var manifestBuf bytes.Buffer
+	if err := m.Write(&manifestBuf); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	gz, err := compression.GetCompressor("gzip", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw, err := archiveWriter(&archive, gz, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(cw)
+	if err := tw.WriteHeader(&tar.Header{Name: manifest.Filename, Mode: 0644, Size: int64(manifestBuf.Len())}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(manifestBuf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		filepath.Join(dirA, "db_backup_2024-01-02T03:04:05Z.tgz"):         archive.Bytes(),
+		filepath.Join(dirA, "db_backup_2024-01-01T00:00:00Z.tar.zst.age"): []byte("abc"),
+		filepath.Join(dirA, "not_a_backup.tgz"):                           nil,
+		// safechars filename
+		filepath.Join(dirB, "db_backup_2024-01-03T00-00-00Z.tar.gpg"): []byte("abcdef"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var targets []storage.Storage
+	for _, dir := range []string{dirA, dirB} {
+		store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, store)
+	}
+	urlA, urlB := targets[0].URL(), targets[1].URL()
+
+	older := Backup{Target: urlA, Name: "db_backup_2024-01-01T00:00:00Z.tar.zst.age", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Size: 3, Compression: "zstd", Encryption: "age"}
+	withManifest := Backup{Target: urlA, Name: "db_backup_2024-01-02T03:04:05Z.tgz", Time: start, Size: int64(archive.Len()), Compression: "gzip"}
+	newer := Backup{Target: urlB, Name: "db_backup_2024-01-03T00-00-00Z.tar.gpg", Time: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), Size: 6, Compression: "none", Encryption: "pgp"}
+	summary := withManifest
+	summary.Manifest = &ManifestSummary{ServerHost: "db", ServerVersion: "10.11.6-MariaDB", Duration: 90 * time.Second, Schemas: 1, Tables: 2, Rows: 5, Bytes: 50}
+
+	tests := []struct {
+		name     string
+		opts     ListOptions
+		expected []Backup
+		wantErr  bool
+	}{
+		{"no targets", ListOptions{}, nil, true},
+		{"all", ListOptions{Targets: targets}, []Backup{older, withManifest, newer}, false},
+		{"since", ListOptions{Targets: targets, Since: start}, []Backup{withManifest, newer}, false},
+		{"until", ListOptions{Targets: targets, Until: start}, []Backup{older}, false},
+		{"manifest", ListOptions{Targets: targets[:1], Since: start, Manifest: true}, []Backup{summary}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backups, err := List(tt.opts)
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			}
+			if diff := deep.Equal(backups, tt.expected); diff != nil {
+				t.Errorf("mismatched backups: %v", diff)
+			}
+		})
+	}
+}
+
+func TestListStreamed(t *testing.T) {
+	dir := t.TempDir()
+	// a streamed backup, with its preliminary manifest first, and its complete one last
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	gz, err := compression.GetCompressor("gzip", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DumpOptions{DBConn: database.Connection{Host: "db"}, Compressor: gz, Streaming: true, Parallelism: 2}
+	var buf bytes.Buffer
+	cw, err := archiveWriter(&buf, gz, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw := archive.NewStreamWriter(cw, 0)
+	if err := writeStreamManifest(sw, preliminaryManifest(start, opts, "10.11.6-MariaDB", []string{"app", "other"})); err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New(start)
+	w, err := m.TrackFiles(func(name string) (io.WriteCloser, error) { return sw.Create(name), nil })("app_2024-01-02T03:04:05Z.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("INSERT INTO a VALUES (1);\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	completeManifest(m, opts, &database.DumpResult{ServerVersion: "10.11.6-MariaDB", Schemas: []database.SchemaResult{
+		{Name: "app", Tables: []mysql.TableStats{{Name: "a", Rows: 1, Bytes: 26}}},
+		{Name: "other"},
+	}})
+	if err := writeStreamManifest(sw, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := "db_backup_2024-01-02T03:04:05Z.tgz"
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := List(ListOptions{Targets: []storage.Storage{store}, Manifest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Backup{{
+		Target:      store.URL(),
+		Name:        name,
+		Time:        start,
+		Size:        int64(buf.Len()),
+		Compression: "gzip",
+		Manifest:    &ManifestSummary{ServerHost: "db", ServerVersion: "10.11.6-MariaDB", Schemas: 2, Preliminary: true},
+	}}
+	if diff := deep.Equal(backups, expected); diff != nil {
+		t.Errorf("mismatched backups: %v", diff)
+	}
+
+	// extracting it, as restoring or verifying does, leaves the complete manifest, which comes last
+	cr, err := pullArchive(store, name, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cr.Close()
+	extracted := t.TempDir()
+	if err := archive.Untar(cr, extracted); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(extracted, manifest.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	complete, err := manifest.Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete.Preliminary || len(complete.Files) != 1 || complete.Schemas[0].Tables[0].Rows != 1 {
+		t.Errorf("extracted manifest is not the complete one: %+v", complete)
+	}
+}
@@ -0,0 +1,19 @@
+package core
+
+import (
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+type ListOptions struct {
+	Targets []storage.Storage
+	// Since, Until only list backups made in this range; a zero time is unbounded
+	Since time.Time
+	Until time.Time
+	// Manifest read the manifest of each backup, which requires reading the start of each one
+	Manifest bool
+	// Decryptor decrypts encrypted backups, to read their manifests
+	Decryptor encrypt.Decryptor
+}
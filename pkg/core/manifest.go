@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
+)
+
+// completeManifest fills in the manifest from the options and the result of the dump
+func completeManifest(m *manifest.Manifest, opts DumpOptions, result *database.DumpResult) {
+	describeDump(m, opts, result.ServerVersion)
+	m.End = time.Now().UTC()
+	if pos := result.BinlogPosition; pos != nil {
+		m.Binlog = &manifest.BinlogPosition{File: pos.File, Position: pos.Position, GTID: pos.GTID, Consistent: result.BinlogConsistent}
+	}
+	for _, s := range result.Schemas {
+		schema := manifest.Schema{Name: s.Name, Tables: make([]manifest.Table, 0, len(s.Tables))}
+		for _, t := range s.Tables {
+			filter := opts.RowFilters[s.Name+"."+t.Name]
+			schema.Tables = append(schema.Tables, manifest.Table{
+				Name:   t.Name,
+				NoData: t.NoData,
+				Rows:   t.Rows,
+				Bytes:  t.Bytes,
+				Where:  filter.Where,
+				Limit:  filter.Limit,
+				Masked: maskedColumns(opts.Masks, s.Name, t.Name),
+			})
+		}
+		m.Schemas = append(m.Schemas, schema)
+	}
+}
+
+// preliminaryManifest the manifest of a streamed backup of the schemas, with what is known before
+// anything is dumped, to be written at the start of the archive, where it can be read without
+// reading the whole backup
+func preliminaryManifest(start time.Time, opts DumpOptions, serverVersion string, schemas []string) *manifest.Manifest {
+	m := manifest.New(start)
+	m.Preliminary = true
+	describeDump(m, opts, serverVersion)
+	for _, s := range schemas {
+		m.Schemas = append(m.Schemas, manifest.Schema{Name: s})
+	}
+	return m
+}
+
+// describeDump fills in the manifest with the server and the options of the dump
+func describeDump(m *manifest.Manifest, opts DumpOptions, serverVersion string) {
+	m.Server = manifest.Server{Host: opts.DBConn.Host, Version: serverVersion}
+	m.Options = manifest.Options{
+		Compact:             opts.Compact,
+		SuppressUseDatabase: opts.SuppressUseDatabase,
+		MaxAllowedPacket:    opts.MaxAllowedPacket,
+		Triggers:            opts.Triggers,
+		Routines:            opts.Routines,
+		Events:              opts.Events,
+		Parallelism:         opts.Parallelism,
+		Streaming:           opts.Streaming,
+		NoData:              opts.NoData,
+		NoCreateInfo:        opts.NoCreateInfo,
+		SourceData:          opts.SourceData,
+	}
+	m.Compression = compression.Name(opts.Compressor)
+	if opts.Encryptor != nil {
+		m.Encryption = &manifest.Encryption{Type: opts.Encryptor.Type(), Recipients: opts.Encryptor.Recipients()}
+	}
+}
+
+// maskedColumns the columns of the table that are masked, from the masks by schema.table.column
+func maskedColumns(masks map[string]mask.Rule, schema, table string) []string {
+	var columns []string
+	prefix := schema + "." + table + "."
+	for name := range masks {
+		if column, ok := strings.CutPrefix(name, prefix); ok && !strings.Contains(column, ".") {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// writeManifest writes the manifest to its file in dir
+func writeManifest(m *manifest.Manifest, dir string) error {
+	f, err := os.Create(filepath.Join(dir, manifest.Filename))
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %v", err)
+	}
+	defer f.Close()
+	if err := m.Write(f); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return f.Close()
+}
+
+// logManifest reads the manifest of a backup being restored, and logs what it describes,
+// returning it. As it mostly is informational, a manifest that cannot be read is not an error,
+// and nil is returned.
+func logManifest(r io.Reader) *manifest.Manifest {
+	m, err := manifest.Read(r)
+	if err != nil {
+		log.Warnf("unable to read backup manifest: %v", err)
+		return nil
+	}
+	if m.Preliminary {
+		log.Infof("restoring streamed backup of %s, server version %s, made at %s: %d schemas",
+			m.Server.Host, m.Server.Version, m.Start.Format(time.RFC3339), len(m.Schemas))
+		return m
+	}
+	var tables int
+	for _, s := range m.Schemas {
+		tables += len(s.Tables)
+	}
+	log.Infof("restoring backup of %s, server version %s, made at %s: %d schemas, %d tables",
+		m.Server.Host, m.Server.Version, m.Start.Format(time.RFC3339), len(m.Schemas), tables)
+	if m.Partial() {
+		log.Warn("backup has only some of the rows of its tables; see the no-data, where and limit of its tables in the manifest")
+	}
+	if m.Options.SourceData == mysql.SourceDataStatement && m.Binlog != nil {
+		log.Warnf("backup has statements that set the server to replicate from %s:%d of %s", m.Binlog.File, m.Binlog.Position, m.Server.Host)
+	}
+	return m
+}
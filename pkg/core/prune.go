@@ -6,115 +6,308 @@ import (
 	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+var (
+	// ErrPruneMinKeep a prune would leave fewer backups in a target than the minimum to keep
+	ErrPruneMinKeep = errors.New("prune would leave fewer backups than the minimum to keep")
+	// ErrPruneStale the newest backup in a target is older than the maximum age, so backups may be failing
+	ErrPruneStale = errors.New("newest backup is older than the maximum backup age")
+	// ErrPruneTooMany a prune would remove more than the maximum fraction of the backups in a target
+	ErrPruneTooMany = errors.New("prune would remove more than the maximum fraction of backups")
 )
 
-// filenameRE is a regular expression to match a backup filename
-var filenameRE = regexp.MustCompile(`^db_backup_(\d{4})-(\d{2})-(\d{2})T(\d{2}):(\d{2}):(\d{2})Z\.\w+$`)
+// filenameRE is a regular expression to match a backup filename, with or without safechars
+var filenameRE = regexp.MustCompile(`^db_backup_(\d{4})-(\d{2})-(\d{2})T(\d{2})[:-](\d{2})[:-](\d{2})Z(?:\.\w+)+$`)
 
-// Prune prune older backups
-func Prune(opts PruneOptions) error {
+// Prune prune older backups, returning what was removed from each target, and what was kept.
+// With DryRun, nothing is removed, and the result is what would be.
+func Prune(opts PruneOptions) (*PruneResult, error) {
 	log.Info("beginning prune")
-	var (
-		candidates []string
-		now        = opts.Now
-	)
+	now := opts.Now
 	if now.IsZero() {
 		now = time.Now()
 	}
-	retainHours, err1 := convertToHours(opts.Retention)
-	retainCount, err2 := convertToCount(opts.Retention)
-	if err1 != nil && err2 != nil {
-		return fmt.Errorf("invalid retention string: %s", opts.Retention)
+	var retainHours, retainCount int
+	if opts.Retention != "" {
+		var err1, err2 error
+		retainHours, err1 = convertToHours(opts.Retention)
+		retainCount, err2 = convertToCount(opts.Retention)
+		if (err1 != nil && err2 != nil) || (retainHours == 0 && retainCount == 0) {
+			return nil, fmt.Errorf("invalid retention string: %s", opts.Retention)
+		}
+	}
+	keep := opts.Keep
+	if keep.Last < 0 || keep.Daily < 0 || keep.Weekly < 0 || keep.Monthly < 0 || keep.Yearly < 0 {
+		return nil, fmt.Errorf("invalid retention policy, counts must not be negative: %+v", keep)
+	}
+	if opts.Retention == "" && keep.IsZero() {
+		return nil, errors.New("no retention policy, set a retention or the backups to keep")
+	}
+	var maxBackupAge int
+	if opts.MaxBackupAge != "" {
+		var err error
+		if maxBackupAge, err = convertToHours(opts.MaxBackupAge); err != nil || maxBackupAge == 0 {
+			return nil, fmt.Errorf("invalid max backup age: %s", opts.MaxBackupAge)
+		}
+	}
+	if opts.MinKeep < 0 {
+		return nil, fmt.Errorf("invalid min keep, must not be negative: %d", opts.MinKeep)
+	}
+	if opts.MaxDeleteFraction < 0 || opts.MaxDeleteFraction > 1 {
+		return nil, fmt.Errorf("invalid max delete fraction, must be from 0 to 1: %g", opts.MaxDeleteFraction)
 	}
 	if len(opts.Targets) == 0 {
-		return errors.New("no targets")
+		return nil, errors.New("no targets")
 	}
 
+	// the plan for every target is made before anything is removed
+	result := &PruneResult{DryRun: opts.DryRun}
 	for _, target := range opts.Targets {
+		plan, err := planPrune(target, now, retainHours, retainCount, keep)
+		if err != nil {
+			return nil, err
+		}
+		result.Targets = append(result.Targets, plan)
+	}
+	// nothing is removed from any target if a guard fails for one of them
+	for _, plan := range result.Targets {
+		if err := checkPrune(opts, plan, now, maxBackupAge); err != nil {
+			return result, err
+		}
+	}
+	if opts.DryRun {
+		log.Info("dry run, not removing any files")
+		return result, nil
+	}
+
+	for i, target := range opts.Targets {
 		var pruned int
+		for _, f := range result.Targets[i].Files {
+			if f.Keep {
+				continue
+			}
+			if err := target.Remove(f.Name); err != nil {
+				return result, fmt.Errorf("failed to remove file %s: %v", f.Name, err)
+			}
+			pruned++
+		}
+		log.Debugf("pruned %d files from target %s", pruned, target)
+	}
 
-		log.Debugf("pruning target %s", target)
-		files, err := target.ReadDir(".")
-		if err != nil {
-			return fmt.Errorf("failed to read directory: %v", err)
+	return result, nil
+}
+
+// checkPrune checks the plan for a target against the guards against removing too much: the
+// minimum to keep, which always applies, and, unless forced, the maximum age of the newest backup and
+// the maximum fraction of backups to remove
+func checkPrune(opts PruneOptions, plan PruneTarget, now time.Time, maxBackupAge int) error {
+	var (
+		backups, removed int
+		newest           time.Time
+	)
+	for _, f := range plan.Files {
+		if f.Segment {
+			continue
+		}
+		backups++
+		if !f.Keep {
+			removed++
+		}
+		if f.Time.After(newest) {
+			newest = f.Time
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	if kept := backups - removed; kept < opts.MinKeep {
+		return fmt.Errorf("%w: %s would keep %d of %d backups, fewer than %d", ErrPruneMinKeep, plan.Target, kept, backups, opts.MinKeep)
+	}
+	if opts.Force {
+		log.Warnf("forcing prune of %d of %d backups from %s, ignoring the max backup age and max delete fraction", removed, backups, plan.Target)
+		return nil
+	}
+	if age := now.Sub(newest).Hours(); maxBackupAge > 0 && age > float64(maxBackupAge) {
+		return fmt.Errorf("%w: newest backup in %s, at %s, is %.1f hours old, older than %s, so backups may be failing; keeping all backups, use force to prune anyway", ErrPruneStale, plan.Target, newest.Format(time.RFC3339), age, opts.MaxBackupAge)
+	}
+	if opts.MaxDeleteFraction > 0 && float64(removed) > opts.MaxDeleteFraction*float64(backups) {
+		return fmt.Errorf("%w: %s would remove %d of %d backups, more than %g of them; use force to prune anyway", ErrPruneTooMany, plan.Target, removed, backups, opts.MaxDeleteFraction)
+	}
+	return nil
+}
+
+// planPrune decides which of the backups in the target to keep, newest first, followed by which of
+// the segments of the binary log, oldest first
+func planPrune(target storage.Storage, now time.Time, retainHours, retainCount int, keep RetentionPolicy) (PruneTarget, error) {
+	plan := PruneTarget{Target: target.URL()}
+	log.Debugf("pruning target %s", target)
+	files, err := target.ReadDir(".")
+	if err != nil {
+		return plan, fmt.Errorf("failed to read directory: %v", err)
+	}
+
+	// create a slice with the filenames and their calculated times - these are *not* the timestamp times, but the times calculated from the filenames
+	var filesWithTimes []fileWithTime
+
+	for _, fileInfo := range files {
+		filename := fileInfo.Name()
+		filetime, ok := backupTime(filename)
+		if !ok {
+			continue
+		}
+		filesWithTimes = append(filesWithTimes, fileWithTime{
+			filename: filename,
+			filetime: filetime,
+		})
+	}
+
+	// the binary log is only of use from the oldest backup that is kept
+	var oldest time.Time
+	for _, d := range retain(filesWithTimes, now, retainHours, retainCount, keep) {
+		if d.keep {
+			log.Debugf("keeping file %s: %s", d.filename, d.reason)
+			if oldest.IsZero() || d.filetime.Before(oldest) {
+				oldest = d.filetime
+			}
+		} else {
+			log.Debugf("removing file %s: %s", d.filename, d.reason)
 		}
+		plan.Files = append(plan.Files, PruneFile{Name: d.filename, Time: d.filetime, Keep: d.keep, Reason: d.reason})
+	}
+
+	segments, err := planSegments(target, oldest)
+	if err != nil {
+		return plan, err
+	}
+	plan.Files = append(plan.Files, segments...)
+	return plan, nil
+}
 
-		// create a slice with the filenames and their calculated times - these are *not* the timestamp times, but the times calculated from the filenames
-		var filesWithTimes []fileWithTime
+// retentionDecision whether a backup is kept, and why
+type retentionDecision struct {
+	fileWithTime
+	keep   bool
+	reason string
+}
 
-		for _, fileInfo := range files {
-			filename := fileInfo.Name()
-			matches := filenameRE.FindStringSubmatch(filename)
-			if matches == nil {
-				log.Debugf("ignoring filename that is not standard backup pattern: %s", filename)
+// retain decides which of the backups to keep, newest first: those younger than retainHours,
+// the retainCount most recent, and those that any rule of the policy keeps. Each rule of the
+// policy keeps the most recent backup of each period, going back over as many periods with backups
+// as the rule allows, so the rules overlap; a backup that none of them keeps is removed.
+func retain(files []fileWithTime, now time.Time, retainHours, retainCount int, keep RetentionPolicy) []retentionDecision {
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(i, j fileWithTime) int {
+		return j.filetime.Compare(i.filetime)
+	})
+	reasons := make([][]string, len(sorted))
+	for i, f := range sorted {
+		if age := now.Sub(f.filetime).Hours(); retainHours > 0 && age < float64(retainHours) {
+			reasons[i] = append(reasons[i], fmt.Sprintf("%.1f hours old, within retention of %d hours", age, retainHours))
+		}
+		if i < retainCount {
+			reasons[i] = append(reasons[i], fmt.Sprintf("one of the %d most recent", retainCount))
+		}
+		if i < keep.Last {
+			reasons[i] = append(reasons[i], fmt.Sprintf("one of the last %d", keep.Last))
+		}
+	}
+	periods := []struct {
+		name   string
+		count  int
+		period func(t time.Time) string
+	}{
+		{"day", keep.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"week", keep.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"month", keep.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"year", keep.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, p := range periods {
+		seen := map[string]bool{}
+		for i, f := range sorted {
+			period := p.period(f.filetime.UTC())
+			if seen[period] {
 				continue
 			}
-			log.Debugf("checking filename that is standard backup pattern: %s", filename)
-
-			// Parse the date from the filename
-			year, month, day, hour, minute, second := matches[1], matches[2], matches[3], matches[4], matches[5], matches[6]
-			dateTimeStr := fmt.Sprintf("%s-%s-%sT%s:%s:%sZ", year, month, day, hour, minute, second)
-			filetime, err := time.Parse(time.RFC3339, dateTimeStr)
-			if err != nil {
-				log.Debugf("Error parsing date from filename %s: %v; ignoring", filename, err)
-				continue
+			if len(seen) >= p.count {
+				break
 			}
-			filesWithTimes = append(filesWithTimes, fileWithTime{
-				filename: filename,
-				filetime: filetime,
-			})
+			seen[period] = true
+			reasons[i] = append(reasons[i], fmt.Sprintf("most recent of %s %s, one of the last %d", p.name, period, p.count))
 		}
+	}
+	decisions := make([]retentionDecision, 0, len(sorted))
+	for i, f := range sorted {
+		d := retentionDecision{fileWithTime: f, keep: len(reasons[i]) > 0, reason: strings.Join(reasons[i], "; ")}
+		if !d.keep {
+			d.reason = "not kept by any retention rule"
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
 
+// planSegments decides which of the segments of the binary log archived to the target to remove:
+// those that only have events from before oldest, the time of the oldest backup that is kept. If
+// there is no backup, none are removed, as there is nothing from which to restore the ones that would be.
+func planSegments(target storage.Storage, oldest time.Time) ([]PruneFile, error) {
+	segments, err := listSegments(target)
+	if err != nil {
+		return nil, err
+	}
+	var files []PruneFile
+	for i, seg := range segments {
+		f := PruneFile{Name: seg.filename, Time: seg.Time, Segment: true, Keep: true}
+		// the events of each segment are from its time up to that of the next one
 		switch {
-		case retainHours > 0:
-			// if we had retainHours, we go through all of the files and find any whose timestamp is older than now-retainHours
-			for _, f := range filesWithTimes {
-				// Check if the file is within 'retain' hours from 'now'
-				age := now.Sub(f.filetime).Hours()
-				if age < float64(retainHours) {
-					log.Debugf("file %s is %f hours old", f.filename, age)
-					log.Debugf("keeping file %s", f.filename)
-					continue
-				}
-				log.Debugf("Adding candidate file: %s", f.filename)
-				candidates = append(candidates, f.filename)
-			}
-		case retainCount > 0:
-			// if we had retainCount, we sort all of the files by timestamp, and add to the list all except the retainCount most recent
-			slices.SortFunc(filesWithTimes, func(i, j fileWithTime) int {
-				switch {
-				case i.filetime.Before(j.filetime):
-					return -1
-				case i.filetime.After(j.filetime):
-					return 1
-				}
-				return 0
-			})
-			slices.Reverse(filesWithTimes)
-			if retainCount >= len(filesWithTimes) {
-				for i := 0 + retainCount; i < len(filesWithTimes); i++ {
-					log.Debugf("Adding candidate file %s:", filesWithTimes[i].filename)
-					candidates = append(candidates, filesWithTimes[i].filename)
-				}
-			}
+		case oldest.IsZero():
+			f.Reason = "no backups are kept"
+		case i+1 == len(segments):
+			f.Reason = "the most recent segment"
+		case segments[i+1].Time.After(oldest):
+			f.Reason = fmt.Sprintf("has events from or after the oldest backup kept, at %s", oldest.Format(time.RFC3339))
 		default:
-			return fmt.Errorf("invalid retention string: %s", opts.Retention)
+			f.Keep = false
+			f.Reason = fmt.Sprintf("ends before the oldest backup kept, at %s", oldest.Format(time.RFC3339))
 		}
-
-		// we have the list, remove them all
-		for _, filename := range candidates {
-			if err := target.Remove(filename); err != nil {
-				return fmt.Errorf("failed to remove file %s: %v", filename, err)
-			}
-			pruned++
+		if f.Keep {
+			log.Debugf("keeping segment of binary log %s: %s", f.Name, f.Reason)
+		} else {
+			log.Debugf("removing segment of binary log %s: %s", f.Name, f.Reason)
 		}
-		log.Debugf("pruning %d files from target %s", pruned, target)
+		files = append(files, f)
 	}
+	return files, nil
+}
 
-	return nil
+// backupTime the time of a backup, from its filename. Returns false if the filename is not
+// that of a backup.
+func backupTime(filename string) (time.Time, bool) {
+	matches := filenameRE.FindStringSubmatch(filename)
+	if matches == nil {
+		log.Debugf("ignoring filename that is not standard backup pattern: %s", filename)
+		return time.Time{}, false
+	}
+	log.Debugf("checking filename that is standard backup pattern: %s", filename)
+
+	// Parse the date from the filename
+	year, month, day, hour, minute, second := matches[1], matches[2], matches[3], matches[4], matches[5], matches[6]
+	dateTimeStr := fmt.Sprintf("%s-%s-%sT%s:%s:%sZ", year, month, day, hour, minute, second)
+	filetime, err := time.Parse(time.RFC3339, dateTimeStr)
+	if err != nil {
+		log.Debugf("Error parsing date from filename %s: %v; ignoring", filename, err)
+		return time.Time{}, false
+	}
+	return filetime, true
 }
 
 // convertToHours takes a string with format "<integer><unit>" and converts it to hours.
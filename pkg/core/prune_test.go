@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"slices"
@@ -51,7 +52,7 @@ func TestPrune(t *testing.T) {
 	hoursAgo := []float32{0.25, 1, 2, 3, 24, 36, 48, 60, 72, 167, 168, 240, 336, 504, 576, 744, 720, 1000, 1440, 1800, 2160, 8760, 12000, 17520}
 	// convert to filenames
 	var filenames []string
-	for _, h := range hoursAgo {
+	for i, h := range hoursAgo {
 		// convert the time diff into a duration, do not forget the negative
 		duration, err := time.ParseDuration(fmt.Sprintf("-%fh", h))
 		if err != nil {
@@ -61,7 +62,8 @@ func TestPrune(t *testing.T) {
 		// and add 30 mins to our "now" time.
 		relativeTime := now.Add(duration).Add(-30 * time.Minute)
 		// convert that into the filename
-		filename := fmt.Sprintf("db_backup_%sZ.gz", relativeTime.Format("2006-01-02T15:04:05"))
+		// and alternate between single and multiple part extensions
+		filename := fmt.Sprintf("db_backup_%sZ.%s", relativeTime.Format("2006-01-02T15:04:05"), []string{"tgz", "tar.zst"}[i%2])
 		filenames = append(filenames, filename)
 	}
 	tests := []struct {
@@ -81,6 +83,13 @@ func TestPrune(t *testing.T) {
 		{"2 days", PruneOptions{Retention: "2d", Now: now}, filenames, filenames[0:6], nil},
 		// 3 weeks - file[13] is 504h+30m = 504.5h, so it should be pruned
 		{"3 weeks", PruneOptions{Retention: "3w", Now: now}, filenames, filenames[0:13], nil},
+		{"3 count", PruneOptions{Retention: "3c", Now: now}, filenames, slices.Clone(filenames[0:3]), nil},
+		// last 2, and the newest of each of the last 2 days: 0.75h and 1.5h old, and 36.5h old, the newest of the day before
+		{"keep last and daily", PruneOptions{Keep: RetentionPolicy{Last: 2, Daily: 2}, Now: now}, filenames, append(slices.Clone(filenames[0:2]), filenames[5]), nil},
+		// retention keeps the files 0.75h and 1.5h old, the policy the newest of each of 2020 and 2019
+		{"retention and policy", PruneOptions{Retention: "2h", Keep: RetentionPolicy{Yearly: 3}, Now: now}, filenames, append(slices.Clone(filenames[0:2]), filenames[22]), nil},
+		{"no retention", PruneOptions{Now: now}, nil, nil, fmt.Errorf("no retention policy, set a retention or the backups to keep")},
+		{"dry run", PruneOptions{Retention: "1h", Now: now, DryRun: true}, filenames, filenames, nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -107,7 +116,7 @@ func TestPrune(t *testing.T) {
 			}
 
 			// run Prune
-			err := Prune(tt.opts)
+			_, err := Prune(tt.opts)
 			switch {
 			case (err == nil && tt.err != nil) || (err != nil && tt.err == nil):
 				t.Errorf("expected error %v, got %v", tt.err, err)
@@ -130,3 +139,250 @@ func TestPrune(t *testing.T) {
 		})
 	}
 }
+
+func TestPruneSegments(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	backup := func(ago time.Duration) string {
+		return fmt.Sprintf("db_backup_%sZ.tgz", now.Add(-ago).Format("2006-01-02T15:04:05"))
+	}
+	segment := func(ago time.Duration, file string, start, end int) string {
+		return fmt.Sprintf("binlog_%s_%s_%d-%d.tgz", now.Add(-ago).Format(time.RFC3339), file, start, end)
+	}
+	segments := []string{
+		segment(72*time.Hour, "binlog.000001", 4, 1000),
+		segment(60*time.Hour, "binlog.000001", 1000, 2000),
+		segment(49*time.Hour, "binlog.000002", 4, 500),
+		segment(47*time.Hour, "binlog.000002", 500, 900),
+		segment(time.Hour, "binlog.000003", 4, 100),
+	}
+	tests := []struct {
+		name        string
+		retention   string
+		beforeFiles []string
+		afterFiles  []string
+	}{
+		// the backup from 48h ago is kept, so the segments from before it are removed, but the
+		// one that started before it and goes on past it is kept
+		{"older than backup", "3d", append([]string{backup(3 * time.Hour), backup(48 * time.Hour), backup(96 * time.Hour)}, segments...),
+			append([]string{backup(3 * time.Hour), backup(48 * time.Hour)}, segments[2:]...)},
+		{"no backups", "2d", segments, segments},
+		{"all backups pruned", "1h", append([]string{backup(3 * time.Hour)}, segments...), segments},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			for _, filename := range tt.beforeFiles {
+				if err := os.WriteFile(fmt.Sprintf("%s/%s", workDir, filename), nil, 0644); err != nil {
+					t.Fatalf("failed to create file %s: %v", filename, err)
+				}
+			}
+			store, err := storage.ParseURL(fmt.Sprintf("file://%s", workDir), credentials.Creds{})
+			if err != nil {
+				t.Fatalf("failed to parse url: %v", err)
+			}
+			if _, err := Prune(PruneOptions{Targets: []storage.Storage{store}, Retention: tt.retention, Now: now}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			files, err := os.ReadDir(workDir)
+			if err != nil {
+				t.Fatalf("failed to read directory: %v", err)
+			}
+			var afterFiles []string
+			for _, file := range files {
+				afterFiles = append(afterFiles, file.Name())
+			}
+			assert.ElementsMatch(t, tt.afterFiles, afterFiles)
+		})
+	}
+}
+
+func TestPruneDryRun(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	files := []string{
+		"db_backup_2020-12-29T00:00:00Z.tgz",
+		"db_backup_2020-12-30T00:00:00Z.tgz",
+		"db_backup_2020-12-31T00:00:00Z.tgz",
+		"binlog_2020-12-29T00:00:00Z_binlog.000001_4-1000.tgz",
+		"binlog_2020-12-30T00:00:00Z_binlog.000001_1000-2000.tgz",
+		"binlog_2020-12-31T00:00:00Z_binlog.000002_4-500.tgz",
+		"other.txt",
+	}
+	workDir := t.TempDir()
+	for _, filename := range files {
+		if err := os.WriteFile(fmt.Sprintf("%s/%s", workDir, filename), nil, 0644); err != nil {
+			t.Fatalf("failed to create file %s: %v", filename, err)
+		}
+	}
+	store, err := storage.ParseURL(fmt.Sprintf("file://%s", workDir), credentials.Creds{})
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+	result, err := Prune(PruneOptions{Targets: []storage.Storage{store}, Keep: RetentionPolicy{Last: 2}, Now: now, DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.DryRun || len(result.Targets) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	plan := result.Targets[0]
+	if plan.Target != store.URL() {
+		t.Errorf("expected target %s, got %s", store.URL(), plan.Target)
+	}
+	type decision struct {
+		name    string
+		segment bool
+		keep    bool
+	}
+	var got []decision
+	for _, f := range plan.Files {
+		if f.Reason == "" {
+			t.Errorf("no reason for %s", f.Name)
+		}
+		got = append(got, decision{f.Name, f.Segment, f.Keep})
+	}
+	// the backups newest first, then the segments oldest first; the first segment ends before
+	// the oldest backup kept, on the 30th
+	assert.Equal(t, []decision{
+		{"db_backup_2020-12-31T00:00:00Z.tgz", false, true},
+		{"db_backup_2020-12-30T00:00:00Z.tgz", false, true},
+		{"db_backup_2020-12-29T00:00:00Z.tgz", false, false},
+		{"binlog_2020-12-29T00:00:00Z_binlog.000001_4-1000.tgz", true, false},
+		{"binlog_2020-12-30T00:00:00Z_binlog.000001_1000-2000.tgz", true, true},
+		{"binlog_2020-12-31T00:00:00Z_binlog.000002_4-500.tgz", true, true},
+	}, got)
+	if removed := plan.Removed(); removed != 2 {
+		t.Errorf("expected 2 files to be removed, got %d", removed)
+	}
+
+	// nothing was removed
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != len(files) {
+		t.Errorf("expected %d files, got %d", len(files), len(entries))
+	}
+}
+
+func TestPruneGuards(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	// a backup a day, for the 10 days up to 2 days ago
+	var files []string
+	for i := 2; i < 12; i++ {
+		files = append(files, fmt.Sprintf("db_backup_%sZ.tgz", now.AddDate(0, 0, -i).Format("2006-01-02T15:04:05")))
+	}
+	tests := []struct {
+		name      string
+		opts      PruneOptions
+		remaining int
+		err       error
+	}{
+		{"no guards", PruneOptions{Keep: RetentionPolicy{Last: 2}}, 2, nil},
+		{"min keep", PruneOptions{Keep: RetentionPolicy{Last: 2}, MinKeep: 3}, 10, ErrPruneMinKeep},
+		{"min keep met", PruneOptions{Keep: RetentionPolicy{Last: 3}, MinKeep: 3}, 3, nil},
+		{"min keep forced", PruneOptions{Keep: RetentionPolicy{Last: 2}, MinKeep: 3, Force: true}, 10, ErrPruneMinKeep},
+		{"stale", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxBackupAge: "1d"}, 10, ErrPruneStale},
+		{"not stale", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxBackupAge: "3d"}, 2, nil},
+		{"stale forced", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxBackupAge: "1d", Force: true}, 2, nil},
+		{"too many", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxDeleteFraction: 0.5}, 10, ErrPruneTooMany},
+		{"not too many", PruneOptions{Keep: RetentionPolicy{Last: 5}, MaxDeleteFraction: 0.5}, 5, nil},
+		{"too many forced", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxDeleteFraction: 0.5, Force: true}, 2, nil},
+		{"dry run", PruneOptions{Keep: RetentionPolicy{Last: 2}, MinKeep: 3, DryRun: true}, 10, ErrPruneMinKeep},
+		{"invalid max backup age", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxBackupAge: "3c"}, 10, fmt.Errorf("invalid max backup age: 3c")},
+		{"invalid max delete fraction", PruneOptions{Keep: RetentionPolicy{Last: 2}, MaxDeleteFraction: 1.5}, 10, fmt.Errorf("invalid max delete fraction, must be from 0 to 1: 1.5")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			for _, filename := range files {
+				if err := os.WriteFile(fmt.Sprintf("%s/%s", workDir, filename), nil, 0644); err != nil {
+					t.Fatalf("failed to create file %s: %v", filename, err)
+				}
+			}
+			store, err := storage.ParseURL(fmt.Sprintf("file://%s", workDir), credentials.Creds{})
+			if err != nil {
+				t.Fatalf("failed to parse url: %v", err)
+			}
+			tt.opts.Targets = []storage.Storage{store}
+			tt.opts.Now = now
+			_, err = Prune(tt.opts)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != nil && err == nil:
+				t.Fatalf("expected error %v", tt.err)
+			case tt.err != nil && !errors.Is(err, tt.err) && err.Error() != tt.err.Error():
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			entries, err := os.ReadDir(workDir)
+			if err != nil {
+				t.Fatalf("failed to read directory: %v", err)
+			}
+			if len(entries) != tt.remaining {
+				t.Errorf("expected %d files to remain, got %d", tt.remaining, len(entries))
+			}
+		})
+	}
+}
+
+func TestRetain(t *testing.T) {
+	now := time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+	at := func(s string) fileWithTime {
+		filetime, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fileWithTime{filename: s, filetime: filetime}
+	}
+	files := []fileWithTime{
+		at("2024-06-01T00:00:00Z"),
+		at("2025-12-31T00:00:00Z"),
+		at("2026-08-15T00:00:00Z"),
+		at("2026-09-01T00:00:00Z"),
+		at("2026-09-30T00:00:00Z"),
+		at("2026-10-05T00:00:00Z"),
+		at("2026-10-11T00:00:00Z"),
+		at("2026-10-16T00:00:00Z"),
+		at("2026-10-17T12:00:00Z"),
+		at("2026-10-18T00:00:00Z"),
+		at("2026-10-18T12:00:00Z"),
+	}
+	tests := []struct {
+		name        string
+		retainHours int
+		retainCount int
+		keep        RetentionPolicy
+		kept        []string
+	}{
+		{"last", 0, 0, RetentionPolicy{Last: 3}, []string{"2026-10-18T12:00:00Z", "2026-10-18T00:00:00Z", "2026-10-17T12:00:00Z"}},
+		{"daily", 0, 0, RetentionPolicy{Daily: 3}, []string{"2026-10-18T12:00:00Z", "2026-10-17T12:00:00Z", "2026-10-16T00:00:00Z"}},
+		// weeks start on Monday, so the 11th and 5th are the same week
+		{"weekly", 0, 0, RetentionPolicy{Weekly: 3}, []string{"2026-10-18T12:00:00Z", "2026-10-11T00:00:00Z", "2026-09-30T00:00:00Z"}},
+		{"monthly", 0, 0, RetentionPolicy{Monthly: 3}, []string{"2026-10-18T12:00:00Z", "2026-09-30T00:00:00Z", "2026-08-15T00:00:00Z"}},
+		{"yearly more than there are", 0, 0, RetentionPolicy{Yearly: 5}, []string{"2026-10-18T12:00:00Z", "2025-12-31T00:00:00Z", "2024-06-01T00:00:00Z"}},
+		{"combined", 0, 0, RetentionPolicy{Last: 2, Daily: 2, Weekly: 2, Monthly: 2, Yearly: 2}, []string{"2026-10-18T12:00:00Z", "2026-10-18T00:00:00Z", "2026-10-17T12:00:00Z", "2026-10-11T00:00:00Z", "2026-09-30T00:00:00Z", "2025-12-31T00:00:00Z"}},
+		{"hours and policy", 24, 0, RetentionPolicy{Yearly: 1}, []string{"2026-10-18T12:00:00Z", "2026-10-18T00:00:00Z"}},
+		{"count", 0, 1, RetentionPolicy{}, []string{"2026-10-18T12:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := retain(files, now, tt.retainHours, tt.retainCount, tt.keep)
+			if len(decisions) != len(files) {
+				t.Fatalf("expected %d decisions, got %d", len(files), len(decisions))
+			}
+			var kept []string
+			for i, d := range decisions {
+				if i > 0 && d.filetime.After(decisions[i-1].filetime) {
+					t.Errorf("decisions not newest first: %s after %s", d.filename, decisions[i-1].filename)
+				}
+				if d.reason == "" {
+					t.Errorf("no reason for %s", d.filename)
+				}
+				if d.keep {
+					kept = append(kept, d.filename)
+				}
+			}
+			assert.Equal(t, tt.kept, kept)
+		})
+	}
+}
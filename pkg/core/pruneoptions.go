@@ -9,5 +9,70 @@ import (
 type PruneOptions struct {
 	Targets   []storage.Storage
 	Retention string
-	Now       time.Time
+	// Keep the grandfather-father-son retention policy; a backup is kept if Retention or any
+	// rule of Keep keeps it
+	Keep RetentionPolicy
+	Now  time.Time
+	// DryRun if set, nothing is removed; the result is what would be
+	DryRun bool
+	// MinKeep the fewest backups to leave in each target; a prune that would leave fewer fails with
+	// ErrPruneMinKeep, even with Force
+	MinKeep int
+	// MaxBackupAge if set, in the same format as a time-based Retention, a prune fails with
+	// ErrPruneStale if the newest backup in a target is older, as backups may be failing
+	MaxBackupAge string
+	// MaxDeleteFraction if set, a prune fails with ErrPruneTooMany if it would remove more than this
+	// fraction, from 0 to 1, of the backups in a target
+	MaxDeleteFraction float64
+	// Force prune even if the newest backup is older than MaxBackupAge, or more than MaxDeleteFraction
+	// of the backups would be removed
+	Force bool
+}
+
+// RetentionPolicy how many backups to keep: the Last most recent, and the most recent of each of
+// the Daily most recent days, Weekly weeks, Monthly months and Yearly years that have backups.
+// Days, weeks, months and years are in UTC, and weeks are ISO weeks, starting on Monday.
+type RetentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+// IsZero whether the policy keeps nothing, as none of its rules are set
+func (p RetentionPolicy) IsZero() bool {
+	return p == RetentionPolicy{}
+}
+
+// PruneResult what Prune removed from each target, or with DryRun would remove, and what it kept
+type PruneResult struct {
+	DryRun  bool          `json:"dry-run"`
+	Targets []PruneTarget `json:"targets"`
+}
+
+// PruneTarget the backups and segments of the binary log in a target, and whether each is kept
+type PruneTarget struct {
+	Target string      `json:"target"`
+	Files  []PruneFile `json:"files"`
+}
+
+// PruneFile a backup, or a segment of the binary log, and whether it is kept or removed, and why
+type PruneFile struct {
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Segment bool      `json:"segment,omitempty"`
+	Keep    bool      `json:"keep"`
+	Reason  string    `json:"reason"`
+}
+
+// Removed the number of files removed from the target, or with DryRun that would be
+func (t PruneTarget) Removed() int {
+	var removed int
+	for _, f := range t.Files {
+		if !f.Keep {
+			removed++
+		}
+	}
+	return removed
 }
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"archive/tar"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+// replayBinlog replays the binary log archived to the target on the database, from the position
+// recorded in the manifest of the backup just restored, up to opts.Until or opts.UntilGTID
+func replayBinlog(opts RestoreOptions, m *manifest.Manifest) error {
+	if m == nil || m.Binlog == nil {
+		return errors.New("backup does not record its position in the binary log, so the binary log cannot be replayed from it; make backups with --source-data")
+	}
+	if !m.Binlog.Consistent {
+		log.Warnf("backup position %s:%d in the binary log may not be consistent with its data, which could be restored with changes that are replayed again", m.Binlog.File, m.Binlog.Position)
+	}
+	start := binlog.Position{File: m.Binlog.File, Pos: m.Binlog.Position}
+	segments, err := replaySegments(opts.Target, start)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		log.Warnf("no binary log archived in %s after %s, so there is nothing to replay", opts.Target.URL(), start)
+		return nil
+	}
+
+	db, err := sql.Open("mysql", opts.DBConn.MySQL())
+	if err != nil {
+		return fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+	// the session variables set by each statement apply to those that follow, so all run on one connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer conn.Close()
+
+	skip := map[string]bool{}
+	for _, gtid := range opts.SkipGTIDs {
+		skip[binlog.NormalizeGTID(gtid)] = true
+	}
+	replayer := &binlog.Replayer{
+		Start:     start,
+		Until:     opts.Until,
+		UntilGTID: binlog.NormalizeGTID(opts.UntilGTID),
+		Skip:      skip,
+		Exec: func(stmt string) error {
+			_, err := conn.ExecContext(ctx, stmt)
+			return err
+		},
+	}
+	log.Infof("replaying binary log from %s", start)
+	for _, seg := range segments {
+		log.Debugf("replaying %s", seg.filename)
+		done, err := replaySegment(opts, replayer, seg)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+	if err := replayer.Finish(); err != nil {
+		return fmt.Errorf("failed to finish replay of binary log: %v", err)
+	}
+
+	count, last := replayer.Transactions()
+	switch {
+	case opts.UntilGTID != "" && !replayer.Done():
+		return fmt.Errorf("transaction %s not found in the binary log archived in %s after %s", opts.UntilGTID, opts.Target.URL(), start)
+	case !opts.Until.IsZero() && !replayer.Done():
+		log.Warnf("binary log archived only up to %s, before %s", replayer.Position(), opts.Until.Format(time.RFC3339))
+	}
+	if count > 0 {
+		log.Infof("replayed %d transactions up to %s, the last started at %s", count, replayer.Position(), last.Format(time.RFC3339))
+	} else {
+		log.Infof("no transactions to replay after %s", start)
+	}
+	return nil
+}
+
+// replaySegment replays a single segment, returning whether the point at which to stop has been reached
+func replaySegment(opts RestoreOptions, replayer *binlog.Replayer, seg archivedSegment) (bool, error) {
+	cr, err := pullArchive(opts.Target, seg.filename, nil, opts.Decryptor)
+	if err != nil {
+		return false, err
+	}
+	defer cr.Close()
+	tr := tar.NewReader(cr)
+	if _, err := tr.Next(); err != nil {
+		return false, fmt.Errorf("failed to read segment %s: %v", seg.filename, err)
+	}
+	return replayer.Replay(seg.File, tr)
+}
+
+// replaySegments the segments archived to the target that need to be replayed from start, in order.
+// Segments that end at or before start are left out; those that remain must follow on from start,
+// and from one another, without a gap. A segment only follows on in the next file if the one
+// before it ends at the end of its file.
+func replaySegments(target storage.Storage, start binlog.Position) ([]archivedSegment, error) {
+	segments, err := listSegments(target)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		selected []archivedSegment
+		prev     = start
+		// whether prev is the end of its file
+		endOfFile bool
+	)
+	for _, seg := range segments {
+		if !start.Before(binlog.Position{File: seg.File, Pos: seg.End}) {
+			if seg.File == start.File && seg.End == start.Pos {
+				endOfFile = seg.EndOfFile
+			}
+			continue
+		}
+		// a segment follows on in the same file, or starts the next one; the first may start before start
+		switch {
+		case seg.File == prev.File && seg.Start <= prev.Pos && (len(selected) == 0 || seg.Start == prev.Pos):
+		case endOfFile && seg.File == binlog.NextFile(prev.File) && seg.Start == uint64(len(binlog.Magic)):
+		default:
+			return nil, fmt.Errorf("binary log archived in %s has a gap between %s and %s:%d", target.URL(), prev, seg.File, seg.Start)
+		}
+		selected = append(selected, seg)
+		prev = binlog.Position{File: seg.File, Pos: seg.End}
+		endOfFile = seg.EndOfFile
+	}
+	return selected, nil
+}
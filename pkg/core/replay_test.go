@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+)
+
+func TestReplaySegments(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	segment := func(ago time.Duration, file string, start, end int, endOfFile bool) string {
+		seg := binlog.Segment{File: file, Start: uint64(start), End: uint64(end), Time: now.Add(-ago), EndOfFile: endOfFile}
+		return seg.Name(false) + ".tgz"
+	}
+	complete := []string{
+		segment(5*time.Hour, "binlog.000001", 4, 1000, false),
+		segment(4*time.Hour, "binlog.000001", 1000, 2000, true),
+		segment(3*time.Hour, "binlog.000002", 4, 500, false),
+		segment(2*time.Hour, "binlog.000002", 500, 900, false),
+	}
+	rollover := []string{
+		segment(2*time.Hour, "binlog.999999", 4, 1000, true),
+		segment(time.Hour, "binlog.1000000", 4, 500, false),
+	}
+	tests := []struct {
+		name     string
+		files    []string
+		start    binlog.Position
+		expected []string
+		wantErr  bool
+	}{
+		{"from middle of segment", complete, binlog.Position{File: "binlog.000001", Pos: 1500}, complete[1:], false},
+		{"from end of segment", complete, binlog.Position{File: "binlog.000001", Pos: 2000}, complete[2:], false},
+		{"from start of file", complete, binlog.Position{File: "binlog.000002", Pos: 4}, complete[2:], false},
+		{"after all", complete, binlog.Position{File: "binlog.000002", Pos: 900}, nil, false},
+		{"before all", complete, binlog.Position{File: "binlog.000001", Pos: 4}, complete, false},
+		{"after start", complete[1:], binlog.Position{File: "binlog.000001", Pos: 500}, nil, true},
+		{"gap in file", []string{complete[0], segment(4*time.Hour, "binlog.000001", 1500, 2000, true)}, binlog.Position{File: "binlog.000001", Pos: 500}, nil, true},
+		{"gap between files", []string{complete[0], complete[3]}, binlog.Position{File: "binlog.000001", Pos: 500}, nil, true},
+		{"file not ended", []string{complete[0], complete[2]}, binlog.Position{File: "binlog.000001", Pos: 500}, nil, true},
+		{"file not ended at start", []string{complete[0], complete[2]}, binlog.Position{File: "binlog.000001", Pos: 1000}, nil, true},
+		{"file missing", []string{complete[0], complete[1], segment(time.Hour, "binlog.000003", 4, 500, false)}, binlog.Position{File: "binlog.000001", Pos: 500}, nil, true},
+		{"files numbered past 999999", rollover, binlog.Position{File: "binlog.999999", Pos: 500}, rollover, false},
+		{"start numbered past 999999", rollover, binlog.Position{File: "binlog.1000000", Pos: 200}, rollover[1:], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			segments, err := replaySegments(store, tt.start)
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			}
+			var names []string
+			for _, seg := range segments {
+				names = append(names, seg.filename)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
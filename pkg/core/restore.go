@@ -1,90 +1,382 @@
 package core
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 )
 
 const (
 	preRestoreDir  = "/scripts.d/pre-restore"
 	postRestoreDir = "/scripts.d/post-restore"
-	tmpRestoreFile = "/tmp/restorefile"
+	// LatestBackup the target file to restore the most recent backup in the target
+	LatestBackup = "latest"
 )
 
 // Restore restore a specific backup into the database
-func Restore(target storage.Storage, targetFile string, dbconn database.Connection, databasesMap map[string]string, compressor compression.Compressor) error {
+func Restore(opts RestoreOptions) error {
+	target := opts.Target
 	log.Info("beginning restore")
 	// execute pre-restore scripts if any
 	if err := preRestore(target.URL()); err != nil {
 		return fmt.Errorf("error running pre-restore: %v", err)
 	}
 
-	log.Debugf("restoring via %s protocol, temporary file location %s", target.Protocol(), tmpRestoreFile)
+	log.Debugf("restoring via %s protocol", target.Protocol())
 
-	copied, err := target.Pull(targetFile, tmpRestoreFile)
+	pointInTime := !opts.Until.IsZero() || opts.UntilGTID != ""
+	if pointInTime {
+		if len(opts.DatabasesMap) > 0 || !opts.Filter.IsEmpty() {
+			return errors.New("a point-in-time restore replays the binary log of the whole server, so cannot be used with database mappings or schema and table filters")
+		}
+		// the nearest backup before the point in time
+		if opts.TargetFile == LatestBackup && opts.Before.IsZero() {
+			opts.Before = opts.Until
+		}
+	}
+	targetFile, err := resolveTargetFile(opts)
+	if err != nil {
+		return err
+	}
+	if filetime, ok := backupTime(targetFile); ok && !opts.Until.IsZero() && filetime.After(opts.Until) {
+		return fmt.Errorf("backup %s was made after %s, so cannot be restored to it", targetFile, opts.Until.Format(time.RFC3339))
+	}
+	cr, err := pullArchive(target, targetFile, opts.Compressor, opts.Decryptor)
 	if err != nil {
-		return fmt.Errorf("failed to pull target %s: %v", target, err)
+		return err
 	}
-	log.Debugf("completed copying %d bytes", copied)
+	defer cr.Close()
 
-	// successfully download file, now restore it
-	tmpdir, err := os.MkdirTemp("", "restore")
+	// one file at a time can be restored straight from the stream; restoring several at
+	// once needs them all, so they are extracted first, as does a backup with its files
+	// interleaved, which is found from its manifest before anything is restored
+	first, r := peekManifest(cr)
+	var m *manifest.Manifest
+	switch {
+	case opts.Parallelism <= 1 && !interleaved(first):
+		m, err = restoreStream(opts, r)
+	case opts.Parallelism <= 1:
+		log.Info("backup was streamed in parallel, so the parts of its files may be interleaved; extracting it before restoring")
+		m, err = restoreExtracted(opts, r)
+	default:
+		m, err = restoreExtracted(opts, r)
+	}
 	if err != nil {
-		return fmt.Errorf("unable to create temporary working directory: %v", err)
+		return err
 	}
-	defer os.RemoveAll(tmpdir)
-	f, err := os.Open(tmpRestoreFile)
-	if f == nil {
-		return fmt.Errorf("unable to read the temporary download file: %v", err)
+
+	// then the changes made since the backup, up to the point in time
+	if pointInTime {
+		if err := replayBinlog(opts, m); err != nil {
+			return err
+		}
+	}
+
+	// execute post-restore scripts if any
+	if err := postRestore(target.URL()); err != nil {
+		return fmt.Errorf("error running post-restove: %v", err)
+	}
+	return nil
+}
+
+// resolveTargetFile the backup file to restore: the target file, unless it is LatestBackup,
+// in which case the most recent backup in the target, made before opts.Before if it is set
+func resolveTargetFile(opts RestoreOptions) (string, error) {
+	if opts.TargetFile != LatestBackup {
+		return opts.TargetFile, nil
+	}
+	backups, err := List(ListOptions{Targets: []storage.Storage{opts.Target}, Until: opts.Before})
+	if err != nil {
+		return "", fmt.Errorf("failed to find latest backup: %v", err)
+	}
+	if len(backups) == 0 {
+		if !opts.Before.IsZero() {
+			return "", fmt.Errorf("no backups made before %s found in %s", opts.Before.Format(time.RFC3339), opts.Target.URL())
+		}
+		return "", fmt.Errorf("no backups found in %s", opts.Target.URL())
+	}
+	latest := backups[len(backups)-1]
+	log.Infof("latest backup is %s, made at %s", latest.Name, latest.Time.Format(time.RFC3339))
+	return latest.Name, nil
+}
+
+// pullArchive pulls filename from the target, returning a reader of the archive within it,
+// decrypted and uncompressed. Unless compressor is set, the compression is detected from
+// the file itself, or failing that its name.
+func pullArchive(target storage.Storage, filename string, compressor compression.Compressor, decryptor encrypt.Decryptor) (io.ReadCloser, error) {
+	rc, err := target.PullStream(context.Background(), filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull target %s: %v", target, err)
+	}
+	br := bufio.NewReader(rc)
+	if br, err = decryptStream(br, decryptor, filename); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if compressor == nil {
+		if compressor, err = detectCompressor(br, filename); err != nil {
+			rc.Close()
+			return nil, err
+		}
+	}
+	cr, err := compressor.Uncompress(br)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("unable to create an uncompressor: %v", err)
+	}
+	return archiveReader{Reader: cr, file: rc}, nil
+}
+
+// archiveReader reads the archive in a file pulled from a target. Closing it closes the
+// uncompressor, if it holds anything that needs to be released, such as the decoders of zstd,
+// and then the file.
+type archiveReader struct {
+	io.Reader
+	file io.Closer
+}
+
+func (a archiveReader) Close() error {
+	var err error
+	if c, ok := a.Reader.(io.Closer); ok {
+		err = c.Close()
+	}
+	return errors.Join(err, a.file.Close())
+}
+
+// peekManifest reads the manifest of the backup being read by r, if it is the first file in the
+// archive, returning it along with a reader of the whole archive, from its start. The manifest is
+// nil if there is none at the start, or it cannot be read, leaving it to the restore to log.
+func peekManifest(r io.Reader) (*manifest.Manifest, io.Reader) {
+	var read bytes.Buffer
+	ar := archive.NewStreamReader(io.TeeReader(r, &read))
+	var m *manifest.Manifest
+	if name, err := ar.Next(); err == nil && name == manifest.Filename {
+		if m, err = manifest.Read(ar); err != nil {
+			m = nil
+		}
 	}
-	defer f.Close()
-	os.Remove(tmpRestoreFile)
+	return m, io.MultiReader(&read, r)
+}
+
+// interleaved whether the files of the backup with the manifest m may be in parts interleaved with
+// one another, as a dump streamed in parallel writes them, so they cannot be restored as they are read
+func interleaved(m *manifest.Manifest) bool {
+	return m != nil && m.Options.Streaming && m.Options.Parallelism > 1
+}
 
-	// create my tar reader to put the files in the directory
-	cr, err := compressor.Uncompress(f)
+// decryptStream decrypts the file being read by r, if it is encrypted, returning a reader of the
+// decrypted file. A file with the signature of one of the compressions is not encrypted.
+func decryptStream(r *bufio.Reader, decryptor encrypt.Decryptor, filename string) (*bufio.Reader, error) {
+	header, err := r.Peek(compression.DetectLength)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read restore file: %v", err)
+	}
+	var encryption string
+	if compression.Detect(header) == nil {
+		encryption = encrypt.Detect(header)
+	}
+	switch {
+	case encryption == "" && decryptor != nil:
+		log.Warnf("%s is not encrypted, ignoring the encryption key", filename)
+		return r, nil
+	case encryption == "":
+		return r, nil
+	case decryptor == nil:
+		return nil, fmt.Errorf("%s is encrypted with %s, set the key to decrypt it with --encryption-key", filename, encryption)
+	}
+	log.Debugf("decrypting %s encrypted file", encryption)
+	dr, err := decryptor.Decrypt(r)
 	if err != nil {
-		return fmt.Errorf("unable to create an uncompressor: %v", err)
+		return nil, fmt.Errorf("failed to decrypt %s: %v", filename, err)
+	}
+	return bufio.NewReader(dr), nil
+}
+
+// detectCompressor get the compressor for the file being read by r from its first bytes,
+// without consuming them, or failing that from its filename
+func detectCompressor(r *bufio.Reader, filename string) (compression.Compressor, error) {
+	header, err := r.Peek(compression.DetectLength)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read restore file: %v", err)
+	}
+	if c := compression.Detect(header); c != nil {
+		log.Debugf("detected compression %T from file contents", c)
+		return c, nil
 	}
-	if err := archive.Untar(cr, tmpdir); err != nil {
-		return fmt.Errorf("error extracting the file: %v", err)
+	if c := compression.ForFilename(filename); c != nil {
+		log.Debugf("detected compression %T from filename", c)
+		return c, nil
+	}
+	return nil, fmt.Errorf("unable to detect the compression of %s, set it with --compression", filename)
+}
+
+// restoreStream restores the files in the archive in the order in which they appear in it,
+// as they are read from the target, returning the manifest of the backup, if it has one
+func restoreStream(opts RestoreOptions, r io.Reader) (*manifest.Manifest, error) {
+	var m *manifest.Manifest
+	ar := archive.NewStreamReader(r)
+	next := func() (io.Reader, error) {
+		for {
+			name, err := ar.Next()
+			if err != nil {
+				return nil, err
+			}
+			// the manifest describes the backup, rather than being part of it; a streamed backup
+			// has a preliminary one first, and its complete one last, which replaces it
+			if name == manifest.Filename {
+				if m == nil || !m.Preliminary {
+					m = logManifest(ar)
+				} else if complete, err := manifest.Read(ar); err == nil {
+					m = complete
+				}
+				continue
+			}
+			if !dumpFileIncluded(opts.Filter, name) {
+				log.Debugf("skipping %s", name)
+				continue
+			}
+			log.Debugf("restoring %s", name)
+			return ar, nil
+		}
+	}
+	if err := database.RestoreStream(opts.DBConn, opts.DatabasesMap, database.RestoreOpts{Filter: opts.Filter}, next); err != nil {
+		if errors.Is(err, archive.ErrPartOutOfOrder) {
+			return nil, fmt.Errorf("failed to restore database, restore with parallelism greater than 1 to extract the dump first: %v", err)
+		}
+		return nil, fmt.Errorf("failed to restore database: %v", err)
+	}
+	return m, nil
+}
+
+// restoreExtracted extracts the archive to a temporary directory, and restores the files
+// from there in parallel, returning the manifest of the backup, if it has one
+func restoreExtracted(opts RestoreOptions, r io.Reader) (*manifest.Manifest, error) {
+	tmpdir, err := os.MkdirTemp("", "restore")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	if err := archive.Untar(r, tmpdir); err != nil {
+		return nil, fmt.Errorf("error extracting the file: %v", err)
 	}
 
 	// run through each file and apply it
-	files, err := os.ReadDir(tmpdir)
+	groups, err := restoreFiles(tmpdir)
 	if err != nil {
-		return fmt.Errorf("failed to find extracted files to restore: %v", err)
+		return nil, fmt.Errorf("failed to find extracted files to restore: %v", err)
 	}
-	readers := make([]io.ReadSeeker, 0)
-	for _, f := range files {
-		// ignore directories
-		if f.IsDir() {
-			continue
+	// the manifest was logged as the files were found, so one that cannot be read is left out
+	var m *manifest.Manifest
+	if f, err := os.Open(filepath.Join(tmpdir, manifest.Filename)); err == nil {
+		m, _ = manifest.Read(f)
+		f.Close()
+	}
+	readers := make([][]io.ReadSeeker, 0, len(groups))
+	for _, files := range groups {
+		group := make([]io.ReadSeeker, 0, len(files))
+		for _, f := range files {
+			name, err := filepath.Rel(tmpdir, f)
+			if err != nil {
+				return nil, err
+			}
+			if !dumpFileIncluded(opts.Filter, filepath.ToSlash(name)) {
+				log.Debugf("skipping %s", name)
+				continue
+			}
+			file, err := os.Open(f)
+			if err != nil {
+				continue
+			}
+			defer file.Close()
+			group = append(group, file)
 		}
-		file, err := os.Open(path.Join(tmpdir, f.Name()))
+		readers = append(readers, group)
+	}
+	if err := database.Restore(opts.DBConn, opts.DatabasesMap, database.RestoreOpts{
+		Parallelism: opts.Parallelism,
+		Filter:      opts.Filter,
+	}, readers); err != nil {
+		return nil, fmt.Errorf("failed to restore database: %v", err)
+	}
+	return m, nil
+}
+
+// restoreFiles lists the files extracted to dir, in groups which must be restored in order.
+// The files within a group are independent of one another. A dump made in parallel has a
+// directory for each schema, containing a file for each table; those are restored first,
+// as the file for the schema itself, at the top level, has the views, triggers and other
+// objects that depend upon the tables. The manifest is not restored.
+func restoreFiles(dir string) ([][]string, error) {
+	var tables, others []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			continue
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if filepath.Dir(p) == filepath.Clean(dir) {
+			if d.Name() == manifest.Filename {
+				if f, err := os.Open(p); err == nil {
+					logManifest(f)
+					f.Close()
+				}
+				return nil
+			}
+			others = append(others, p)
+		} else {
+			tables = append(tables, p)
 		}
-		defer file.Close()
-		readers = append(readers, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := database.Restore(dbconn, databasesMap, readers); err != nil {
-		return fmt.Errorf("failed to restore database: %v", err)
+	var groups [][]string
+	for _, group := range [][]string{tables, others} {
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
 	}
+	return groups, nil
+}
 
-	// execute post-restore scripts if any
-	if err := postRestore(target.URL()); err != nil {
-		return fmt.Errorf("error running post-restove: %v", err)
+// dumpFileIncluded whether the filter selects anything in a file of the dump, from its name: the
+// file of a schema, <schema>_<timestamp>.sql, or of a table in a parallel dump,
+// <schema>_<timestamp>/<table>.sql. Files named otherwise are included, to be filtered by
+// their statements.
+func dumpFileIncluded(filter database.RestoreFilter, name string) bool {
+	dir, file, isTable := strings.Cut(name, "/")
+	match := dumpFileRE.FindStringSubmatch(strings.TrimSuffix(dir, ".sql"))
+	if match == nil {
+		return true
 	}
-	return nil
+	if !isTable {
+		return filter.SchemaIncluded(match[1])
+	}
+	table, err := url.PathUnescape(strings.TrimSuffix(file, ".sql"))
+	if err != nil {
+		return true
+	}
+	return filter.TableIncluded(match[1], table)
 }
 
 // run pre-restore scripts, if they exist
@@ -0,0 +1,362 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/go-test/deep"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+)
+
+func TestRestoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"a_2024-01-01T00:00:00Z.sql",
+		"b_2024-01-01T00:00:00Z.sql",
+		"b_2024-01-01T00:00:00Z/t1.sql",
+		"b_2024-01-01T00:00:00Z/t2.sql",
+		"c_2024-01-01T00:00:00Z/t1.sql",
+		"c_2024-01-01T00:00:00Z.sql",
+		"manifest.json",
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := restoreFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range got {
+		for i := range group {
+			group[i], _ = filepath.Rel(dir, group[i])
+		}
+	}
+	expected := [][]string{
+		{
+			"b_2024-01-01T00:00:00Z/t1.sql",
+			"b_2024-01-01T00:00:00Z/t2.sql",
+			"c_2024-01-01T00:00:00Z/t1.sql",
+		},
+		{
+			"a_2024-01-01T00:00:00Z.sql",
+			"b_2024-01-01T00:00:00Z.sql",
+			"c_2024-01-01T00:00:00Z.sql",
+		},
+	}
+	if diff := deep.Equal(got, expected); diff != nil {
+		t.Errorf("mismatched files: %v", diff)
+	}
+}
+
+func TestDumpFileIncluded(t *testing.T) {
+	filter := database.RestoreFilter{IncludeTables: []string{"shop.orders", "shop.my table"}}
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"shop_2024-01-01T00:00:00Z.sql", true},
+		{"crm_2024-01-01T00:00:00Z.sql", false},
+		{"shop_2024-01-01T00:00:00Z/orders.sql", true},
+		{"shop_2024-01-01T00:00:00Z/customers.sql", false},
+		{"shop_2024-01-01T00:00:00Z/my%20table.sql", true},
+		{"crm_2024-01-01T00:00:00Z/orders.sql", false},
+		// named otherwise, so left to the statements in it
+		{"mydump.sql", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dumpFileIncluded(filter, tt.name); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecryptStream(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptor, err := encrypt.NewAgeEncryptor([]byte(identity.Recipient().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptor, err := encrypt.NewAgeDecryptor([]byte(identity.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "CREATE TABLE `t` (`id` int);\n"
+
+	tests := []struct {
+		name      string
+		encryptor encrypt.Encryptor
+		decryptor encrypt.Decryptor
+		err       bool
+	}{
+		{"unencrypted", nil, nil, false},
+		{"encrypted", encryptor, decryptor, false},
+		{"encrypted without key", encryptor, nil, true},
+		{"unencrypted with key", nil, decryptor, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := archiveWriter(&buf, &compression.GzipCompressor{}, tt.encryptor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := decryptStream(bufio.NewReader(&buf), tt.decryptor, "backup")
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			compressor, err := detectCompressor(r, "backup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cr, err := compressor.Uncompress(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if closer, ok := cr.(io.Closer); ok {
+				defer closer.Close()
+			}
+			b, err := io.ReadAll(cr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != data {
+				t.Errorf("expected %q, got %q", data, string(b))
+			}
+		})
+	}
+}
+
+// closeRecorder a reader that records whether it was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// recordingCompressor an uncompressor returning a closeRecorder
+type recordingCompressor struct {
+	compression.NoneCompressor
+	reader *closeRecorder
+}
+
+func (c *recordingCompressor) Uncompress(in io.Reader) (io.Reader, error) {
+	c.reader = &closeRecorder{Reader: in}
+	return c.reader, nil
+}
+
+func TestPullArchiveClose(t *testing.T) {
+	dir := t.TempDir()
+	name := "db_backup_2024-01-02T03:04:05Z.tar"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressor := &recordingCompressor{}
+	cr, err := pullArchive(store, name, compressor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "archive" {
+		t.Errorf("expected %q, got %q", "archive", string(b))
+	}
+	if err := cr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the uncompressor, such as the decoder of zstd, is closed with the file
+	if !compressor.reader.closed {
+		t.Error("uncompressor was not closed")
+	}
+
+	// and that of zstd closes without error
+	var buf bytes.Buffer
+	zstd := &compression.ZstdCompressor{}
+	w, err := zstd.Compress(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name = "db_backup_2024-01-02T03:04:05Z.tar.zst"
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cr, err = pullArchive(store, name, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cr.(archiveReader).Reader.(io.Closer); !ok {
+		t.Error("zstd uncompressor cannot be closed")
+	}
+	if err := cr.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPeekManifest(t *testing.T) {
+	// a dump streamed in parallel, with the parts of its files interleaved
+	opts := DumpOptions{DBConn: database.Connection{Host: "db"}, Compressor: &compression.NoneCompressor{}, Streaming: true, Parallelism: 2}
+	var buf bytes.Buffer
+	sw := archive.NewStreamWriter(&buf, 4)
+	if err := writeStreamManifest(sw, preliminaryManifest(time.Now(), opts, "8.2.0", []string{"app"})); err != nil {
+		t.Fatal(err)
+	}
+	a, b := sw.Create("app/a.sql"), sw.Create("app/b.sql")
+	for i := 0; i < 3; i++ {
+		for _, w := range []io.Writer{a, b} {
+			if _, err := io.WriteString(w, "INSERT INTO t VALUES (1);\n"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, w := range []io.Closer{a, b, sw} {
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, r := peekManifest(bytes.NewReader(buf.Bytes()))
+	if m == nil || !interleaved(m) {
+		t.Fatalf("expected manifest of an interleaved dump, got %+v", m)
+	}
+	// the whole archive still is read, from its start, and extracting it puts the parts back together
+	dir := t.TempDir()
+	if err := archive.Untar(r, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app/a.sql", "app/b.sql"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := strings.Repeat("INSERT INTO t VALUES (1);\n", 3); string(b) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, string(b))
+		}
+	}
+	// whereas reading it as a stream fails on the interleaved parts
+	ar := archive.NewStreamReader(bytes.NewReader(buf.Bytes()))
+	var err error
+	for err == nil {
+		_, err = ar.Next()
+	}
+	if !errors.Is(err, archive.ErrPartOutOfOrder) {
+		t.Errorf("expected parts out of order, got %v", err)
+	}
+
+	// neither a dump that was not streamed in parallel, nor one without a manifest, is interleaved
+	opts.Parallelism = 1
+	buf.Reset()
+	sw = archive.NewStreamWriter(&buf, 0)
+	if err := writeStreamManifest(sw, preliminaryManifest(time.Now(), opts, "8.2.0", []string{"app"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := peekManifest(&buf); m == nil || interleaved(m) {
+		t.Errorf("expected manifest of a dump that is not interleaved, got %+v", m)
+	}
+	if m, r := peekManifest(strings.NewReader("not an archive")); m != nil || interleaved(m) {
+		t.Errorf("expected no manifest, got %+v", m)
+	} else if b, _ := io.ReadAll(r); string(b) != "not an archive" {
+		t.Errorf("expected the whole file to be read, got %q", string(b))
+	}
+}
+
+func TestResolveTargetFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"db_backup_2026-09-29T00:00:00Z.tgz",
+		"db_backup_2026-09-30T23:59:59Z.tar.zst",
+		"db_backup_2026-10-01T00-00-00Z.tgz",
+		"db_backup_2026-10-02T00:00:00Z.tgz.age",
+		"other.tgz",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := storage.ParseURL("file://"+dir, credentials.Creds{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := storage.ParseURL("file://"+t.TempDir(), credentials.Creds{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		opts     RestoreOptions
+		expected string
+		wantErr  bool
+	}{
+		{"specific file", RestoreOptions{Target: store, TargetFile: "other.tgz"}, "other.tgz", false},
+		{"latest", RestoreOptions{Target: store, TargetFile: LatestBackup}, "db_backup_2026-10-02T00:00:00Z.tgz.age", false},
+		{"latest before", RestoreOptions{Target: store, TargetFile: LatestBackup, Before: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)}, "db_backup_2026-09-30T23:59:59Z.tar.zst", false},
+		{"latest before all", RestoreOptions{Target: store, TargetFile: LatestBackup, Before: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}, "", true},
+		{"no backups", RestoreOptions{Target: empty, TargetFile: LatestBackup}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := resolveTargetFile(tt.opts)
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			}
+			if file != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, file)
+			}
+		})
+	}
+}
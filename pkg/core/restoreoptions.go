@@ -0,0 +1,36 @@
+package core
+
+import (
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+type RestoreOptions struct {
+	Target storage.Storage
+	// TargetFile the backup file in the target; LatestBackup for the most recent backup
+	TargetFile string
+	// Before when restoring the LatestBackup, the most recent backup made before this time;
+	// if zero, the most recent of all
+	Before       time.Time
+	DBConn       database.Connection
+	DatabasesMap map[string]string
+	// Compressor the compression of the file; if nil, it is detected from the file
+	Compressor compression.Compressor
+	// Decryptor decrypts the file, if it is encrypted
+	Decryptor   encrypt.Decryptor
+	Parallelism int
+	// Filter selects the schemas and tables to restore
+	Filter database.RestoreFilter
+	// Until and UntilGTID if either is set, the backup is restored, then the binary log archived
+	// to the target replayed from the position of the backup up to the last transaction started
+	// at or before Until, or up to and including the transaction UntilGTID. With Until, the
+	// LatestBackup is the most recent made before it.
+	Until     time.Time
+	UntilGTID string
+	// SkipGTIDs the GTIDs of transactions in the binary log not to replay
+	SkipGTIDs []string
+}
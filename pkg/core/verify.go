@@ -0,0 +1,206 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+)
+
+// dumpFileRE matches the name of a file of a dump, <schema>_<timestamp>, from which the
+// schema is taken if the file does not set it
+var dumpFileRE = regexp.MustCompile(`^(.+)_\d{4}-\d{2}-\d{2}T\d{2}[:-]\d{2}[:-]\d{2}Z$`)
+
+// ErrVerifyFailed the backup was read, but has problems
+var ErrVerifyFailed = errors.New("backup failed verification")
+
+// VerifyResult what was found in a backup by Verify
+type VerifyResult struct {
+	// Manifest whether the backup has a manifest, against which its files were checked
+	Manifest bool
+	// Files the number of dump files in the backup
+	Files   int
+	Schemas []SchemaVerification
+	// Problems each problem found with the backup
+	Problems []string
+}
+
+// SchemaVerification the statements in the dump of a schema, and the rows they insert
+type SchemaVerification struct {
+	Name       string
+	Statements int
+	Rows       int64
+}
+
+// Verify checks that a backup can be restored, without restoring it: that it can be decrypted,
+// uncompressed and extracted, that its files match the checksums in its manifest, if it has one,
+// and that every statement in them can be parsed. Returns ErrVerifyFailed if the backup was read
+// but had problems, each of which is in the result.
+func Verify(opts VerifyOptions) (*VerifyResult, error) {
+	log.Infof("verifying %s", opts.TargetFile)
+	cr, err := pullArchive(opts.Target, opts.TargetFile, opts.Compressor, opts.Decryptor)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+
+	tmpdir, err := os.MkdirTemp("", "verify")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	if err := archive.Untar(cr, tmpdir); err != nil {
+		return nil, fmt.Errorf("error extracting the file: %v", err)
+	}
+
+	result, err := verifyFiles(tmpdir)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Problems) > 0 {
+		return result, ErrVerifyFailed
+	}
+	return result, nil
+}
+
+// verifyFiles verifies the files of a backup extracted to dir
+func verifyFiles(dir string) (*VerifyResult, error) {
+	result := &VerifyResult{}
+	var (
+		m     *manifest.Manifest
+		files = map[string]manifest.File{}
+	)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if name == manifest.Filename {
+			if m, err = manifest.Read(f); err != nil {
+				result.Problems = append(result.Problems, err.Error())
+			}
+			return nil
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, f)
+		if err != nil {
+			return err
+		}
+		files[name] = manifest.File{Name: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extracted files: %v", err)
+	}
+	result.Files = len(files)
+
+	if m != nil {
+		result.Manifest = true
+		result.Problems = append(result.Problems, checkFiles(m.Files, files)...)
+	}
+
+	// parse every file, in order, so the problems are in a consistent order
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counts := map[string]database.StatementCounts{}
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extracted file %s: %v", name, err)
+		}
+		fileCounts, err := database.CountStatements(f, dumpFileSchema(name))
+		f.Close()
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: %v", name, err))
+		}
+		for schema, c := range fileCounts {
+			total := counts[schema]
+			total.Statements += c.Statements
+			total.Rows += c.Rows
+			counts[schema] = total
+		}
+	}
+	for schema, c := range counts {
+		result.Schemas = append(result.Schemas, SchemaVerification{Name: schema, Statements: c.Statements, Rows: c.Rows})
+	}
+	sort.Slice(result.Schemas, func(i, j int) bool { return result.Schemas[i].Name < result.Schemas[j].Name })
+
+	// the rows dumped, as recorded in the manifest, should all be in the dump
+	if m != nil {
+		for _, s := range m.Schemas {
+			var rows int64
+			for _, t := range s.Tables {
+				rows += t.Rows
+			}
+			if got := counts[s.Name].Rows; got != rows {
+				result.Problems = append(result.Problems, fmt.Sprintf("schema %s has %d rows, manifest has %d", s.Name, got, rows))
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkFiles compares the files in the backup with those in its manifest
+func checkFiles(expected []manifest.File, actual map[string]manifest.File) []string {
+	var problems []string
+	seen := map[string]bool{}
+	for _, e := range expected {
+		seen[e.Name] = true
+		a, ok := actual[e.Name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: in manifest, missing from backup", e.Name))
+		case a.Size != e.Size:
+			problems = append(problems, fmt.Sprintf("%s: size %d, manifest has %d", e.Name, a.Size, e.Size))
+		case a.SHA256 != e.SHA256:
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", e.Name))
+		}
+	}
+	var extra []string
+	for name := range actual {
+		if !seen[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		problems = append(problems, fmt.Sprintf("%s: in backup, missing from manifest", name))
+	}
+	return problems
+}
+
+// dumpFileSchema the schema of a dump file, from its name: either <schema>_<timestamp>.sql,
+// or, for the tables of a parallel dump, <schema>_<timestamp>/<table>.sql. Returns the name
+// itself if it is neither.
+func dumpFileSchema(name string) string {
+	base := strings.TrimSuffix(strings.SplitN(name, "/", 2)[0], ".sql")
+	if match := dumpFileRE.FindStringSubmatch(base); match != nil {
+		return match[1]
+	}
+	return base
+}
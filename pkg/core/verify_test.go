@@ -0,0 +1,128 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/archive"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
+)
+
+func TestVerify(t *testing.T) {
+	const (
+		schemaFile = "app_2024-01-02T03:04:05Z.sql"
+		tableFile  = "app_2024-01-02T03:04:05Z/users.sql"
+		schemaSQL  = "-- Go SQL Dump\nCREATE DATABASE IF NOT EXISTS `app`;\nUSE `app`;\nCREATE VIEW `v` AS SELECT 1;\n"
+		tableSQL   = "CREATE TABLE `users` (`id` int, `name` text);\nINSERT INTO `users` (`id`,`name`) VALUES (1,'a(b'),(2,'c\\'d');\nINSERT INTO `users` (`id`,`name`) VALUES (3,'e''f');\n"
+	)
+	tests := []struct {
+		name     string
+		files    map[string]string
+		manifest bool
+		// tamper changes the files after the manifest is made
+		tamper   map[string]string
+		expected *VerifyResult
+		err      error
+	}{
+		{"valid with manifest", map[string]string{schemaFile: schemaSQL, tableFile: tableSQL}, true, nil, &VerifyResult{
+			Manifest: true,
+			Files:    2,
+			Schemas:  []SchemaVerification{{Name: "app", Statements: 6, Rows: 3}},
+		}, nil},
+		{"valid without manifest", map[string]string{tableFile: tableSQL}, false, nil, &VerifyResult{
+			Files:   1,
+			Schemas: []SchemaVerification{{Name: "app", Statements: 3, Rows: 3}},
+		}, nil},
+		{"checksum mismatch", map[string]string{schemaFile: schemaSQL, tableFile: tableSQL}, true, map[string]string{tableFile: tableSQL[:len(tableSQL)-2] + "X\n"}, &VerifyResult{
+			Manifest: true,
+			Files:    2,
+			Schemas:  []SchemaVerification{{Name: "app", Statements: 6, Rows: 3}},
+			Problems: []string{tableFile + ": checksum mismatch"},
+		}, ErrVerifyFailed},
+		{"truncated", map[string]string{schemaFile: schemaSQL}, true, map[string]string{schemaFile: schemaSQL + "INSERT INTO `users` VALUES (4,'unterminated"}, &VerifyResult{
+			Manifest: true,
+			Files:    1,
+			Schemas:  []SchemaVerification{{Name: "app", Statements: 3}},
+			Problems: []string{
+				schemaFile + ": size 135, manifest has 92",
+				schemaFile + ": failed to parse: unterminated single-quoted string starting at line 5: unexpected EOF",
+			},
+		}, ErrVerifyFailed},
+		{"extra file", map[string]string{schemaFile: schemaSQL}, true, map[string]string{"other.sql": "SELECT 1;\n"}, &VerifyResult{
+			Manifest: true,
+			Files:    2,
+			Schemas:  []SchemaVerification{{Name: "app", Statements: 3}, {Name: "other", Statements: 1}},
+			Problems: []string{"other.sql: in backup, missing from manifest"},
+		}, ErrVerifyFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, targetDir := t.TempDir(), t.TempDir()
+			m := manifest.New(time.Now())
+			create := m.TrackFiles(createIn(src))
+			for name, content := range tt.files {
+				f, err := create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.WriteString(f, content); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.manifest {
+				m.Schemas = []manifest.Schema{{Name: "app", Tables: []manifest.Table{{Name: "users", Rows: int64(len(tt.files)-1) * 3}}}}
+				if err := writeManifest(m, src); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, content := range tt.tamper {
+				if err := os.WriteFile(path.Join(src, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			const filename = "db_backup_2024-01-02T03:04:05Z.tgz"
+			gz, err := compression.GetCompressor("gzip", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := os.Create(filepath.Join(targetDir, filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cw, err := archiveWriter(out, gz, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := archive.Tar(src, cw); err != nil {
+				t.Fatal(err)
+			}
+			out.Close()
+			store, err := storage.ParseURL("file://"+targetDir, credentials.Creds{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := Verify(VerifyOptions{Target: store, TargetFile: filename})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if diff := deep.Equal(result, tt.expected); diff != nil {
+				t.Errorf("mismatched result: %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package core
+
+import (
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/encrypt"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
+)
+
+type VerifyOptions struct {
+	Target     storage.Storage
+	TargetFile string
+	// Compressor the compression of the file; if nil, it is detected from the file
+	Compressor compression.Compressor
+	// Decryptor decrypts the file, if it is encrypted
+	Decryptor encrypt.Decryptor
+}
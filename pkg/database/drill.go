@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// CountRows counts the rows in each of the tables in schema
+func CountRows(dbconn Connection, schema string, tables []string) (map[string]int64, error) {
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var count int64
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", quoteIdentifier(schema), quoteIdentifier(table))).Scan(&count); err != nil {
+			return counts, fmt.Errorf("failed to count rows in %s.%s: %w", schema, table, err)
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// QueryValue runs query with schema as the default database, if it is set, and returns the
+// first column of the first row of the result, or "" if there are no rows
+func QueryValue(dbconn Connection, schema, query string) (string, error) {
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return "", fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+	if schema != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+quoteIdentifier(schema)); err != nil {
+			return "", fmt.Errorf("failed to use database %s: %w", schema, err)
+		}
+	}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]any, len(columns))
+	var first sql.NullString
+	values[0] = &first
+	for i := 1; i < len(values); i++ {
+		values[i] = new(sql.RawBytes)
+	}
+	if err := rows.Scan(values...); err != nil {
+		return "", err
+	}
+	return first.String, nil
+}
+
+// DropDatabases drops each of the databases, if it exists
+func DropDatabases(dbconn Connection, names []string) error {
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range names {
+		if _, err := db.Exec("DROP DATABASE IF EXISTS " + quoteIdentifier(name)); err != nil {
+			return fmt.Errorf("failed to drop database %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
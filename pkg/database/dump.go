@@ -1,19 +1,68 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
 
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
 )
 
 type DumpOpts struct {
 	Compact             bool
 	SuppressUseDatabase bool
 	MaxAllowedPacket    int
+	Triggers            bool
+	Routines            bool
+	Events              bool
+	// Parallelism how many tables to dump at once, each on its own connection
+	Parallelism int
+	// IncludeTables and ExcludeTables patterns of the tables to dump, as schema.table; see TableFilter
+	IncludeTables []string
+	ExcludeTables []string
+	// RowFilters the rows to dump of each table, by schema.table; all of them for any table not in it
+	RowFilters map[string]mysql.RowFilter
+	// Masks how to mask the values of columns, by schema.table.column
+	Masks map[string]mask.Rule
+	// MaskSalt the salt of the masks that derive their value from the original; if blank, a
+	// random one is used, so values are masked differently in each dump
+	MaskSalt string
+	// NoData dump only the structure of tables; NoCreateInfo only their rows
+	NoData       bool
+	NoCreateInfo bool
+	// NoDataTables patterns of the tables, as schema.table, of which to dump only the structure; see TableFilter
+	NoDataTables []string
+	// SourceData how to write the position in the binary log to the header of the dump of each
+	// schema, one of the mysql.SourceData modes. Unless it is mysql.SourceDataNone, the dump is
+	// from a snapshot, even if not in parallel, so that the position is consistent with it.
+	SourceData int
+}
+
+// DumpResult what was dumped
+type DumpResult struct {
+	ServerVersion string
+	// BinlogPosition the position in the binary log of the dump, or nil if unknown. When dumping
+	// from a snapshot, it is that of the snapshot; otherwise, it is the position as the dump began,
+	// which is exact only if nothing was written during the dump.
+	BinlogPosition *mysql.BinlogPosition
+	// BinlogConsistent whether BinlogPosition is that of a snapshot, and so exact
+	BinlogConsistent bool
+	Schemas          []SchemaResult
 }
 
-func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
+// SchemaResult what was dumped of a single schema
+type SchemaResult struct {
+	Name   string
+	Tables []mysql.TableStats
+}
+
+func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) (*DumpResult, error) {
 
 	// TODO: dump data for each writer:
 	// per schema
@@ -22,13 +71,67 @@ func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
 	//    mysqldump -A $MYSQLDUMP_OPTS
 	// all at once limited to some databases
 	//    mysqldump --databases $DB_NAMES $MYSQLDUMP_OPTS
-	for _, writer := range writers {
-		db, err := sql.Open("mysql", dbconn.MySQL())
+	tableFilter, err := NewTableFilter(opts.IncludeTables, opts.ExcludeTables)
+	if err != nil {
+		return nil, err
+	}
+	masks, err := newMasks(opts.Masks, opts.MaskSalt)
+	if err != nil {
+		return nil, err
+	}
+	// a masked schema that is not dumped is most likely a mistake in its name, so fail before dumping anything
+	for schema := range masks {
+		if !writersInclude(writers, schema) {
+			return nil, fmt.Errorf("masked schema %s is not dumped, so its columns would not be masked", schema)
+		}
+	}
+	// the tables without data are those the filter would exclude
+	noDataFilter, err := NewTableFilter(nil, opts.NoDataTables)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	result := &DumpResult{}
+	if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&result.ServerVersion); err != nil {
+		return nil, fmt.Errorf("failed to get server version: %v", err)
+	}
+
+	// to dump in parallel, all of the connections share a single snapshot, so the
+	// dump is consistent across every table in every schema; a snapshot also is the
+	// only way to get a position in the binary log that is consistent with the dump
+	var snapshot *mysql.Snapshot
+	if opts.Parallelism > 1 || opts.SourceData != mysql.SourceDataNone {
+		snapshot, err = mysql.NewSnapshot(ctx, db, max(opts.Parallelism, 1))
 		if err != nil {
-			return fmt.Errorf("failed to open connection to database: %v", err)
+			return nil, fmt.Errorf("failed to create consistent snapshot: %v", err)
 		}
-		defer db.Close()
+		defer snapshot.Close()
+		result.BinlogPosition = snapshot.BinlogPosition()
+		result.BinlogConsistent = result.BinlogPosition != nil
+		if opts.SourceData != mysql.SourceDataNone && result.BinlogPosition == nil {
+			return nil, errors.New("failed to get position in binary log for source data, check that binary logging is enabled and for REPLICATION CLIENT privilege")
+		}
+	} else if result.BinlogPosition, err = mysql.QueryBinlogPosition(ctx, db); err != nil {
+		// the dump does not depend upon it, so carry on without it
+		log.Debugf("unable to get binary log position: %v", err)
+	}
+
+	for _, writer := range writers {
 		for _, schema := range writer.Schemas {
+			schema := schema
+			var tableOut func(string) (io.WriteCloser, error)
+			if writer.TableWriter != nil {
+				tableWriter := writer.TableWriter
+				tableOut = func(table string) (io.WriteCloser, error) {
+					return tableWriter(schema, table)
+				}
+			}
 			dumper := &mysql.Data{
 				Out:                 writer.Writer,
 				Connection:          db,
@@ -37,12 +140,122 @@ func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
 				Compact:             opts.Compact,
 				SuppressUseDatabase: opts.SuppressUseDatabase,
 				MaxAllowedPacket:    opts.MaxAllowedPacket,
+				Triggers:            opts.Triggers,
+				Routines:            opts.Routines,
+				Events:              opts.Events,
+				Snapshot:            snapshot,
+				TableOut:            tableOut,
+				IgnoreTable: func(table string) bool {
+					return !tableFilter.Included(schema, table)
+				},
+				RowFilters:   schemaRowFilters(opts.RowFilters, schema),
+				Masks:        masks[schema],
+				NoData:       opts.NoData,
+				NoCreateInfo: opts.NoCreateInfo,
+				NoDataTable: func(table string) bool {
+					return !noDataFilter.Included(schema, table)
+				},
+				SourceData: opts.SourceData,
 			}
 			if err := dumper.Dump(); err != nil {
-				return fmt.Errorf("failed to dump database %s: %v", schema, err)
+				return nil, fmt.Errorf("failed to dump database %s: %v", schema, err)
+			}
+			stats := dumper.Stats()
+			if err := checkMasked(schema, masks[schema], stats); err != nil {
+				return nil, err
+			}
+			result.Schemas = append(result.Schemas, SchemaResult{Name: schema, Tables: stats})
+		}
+		// the writer is complete, so let it be flushed, rather than waiting for all of the others
+		if closer, ok := writer.Writer.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return nil, fmt.Errorf("failed to complete dump of %v: %v", writer.Schemas, err)
 			}
 		}
 	}
 
+	return result, nil
+}
+
+// schemaRowFilters the row filters of the tables in schema, by table name, from those of all
+// tables, by schema.table
+func schemaRowFilters(filters map[string]mysql.RowFilter, schema string) map[string]mysql.RowFilter {
+	var result map[string]mysql.RowFilter
+	for name, filter := range filters {
+		if s, table, ok := strings.Cut(name, "."); ok && s == schema {
+			if result == nil {
+				result = make(map[string]mysql.RowFilter)
+			}
+			result[table] = filter
+		}
+	}
+	return result
+}
+
+// writersInclude whether any of the writers dumps the schema
+func writersInclude(writers []DumpWriter, schema string) bool {
+	for _, writer := range writers {
+		for _, s := range writer.Schemas {
+			if s == schema {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkMasked checks that every masked table of the schema was dumped with its masks. A table that
+// was not dumped, or was with its rows unmasked, most likely is a mistake in its name, or a filter
+// that leaves it out, so the dump fails, rather than leave the column it was meant for unmasked
+// somewhere else. A table of which only the structure was dumped has nothing to mask.
+func checkMasked(schema string, tables map[string]map[string]mask.Masker, stats []mysql.TableStats) error {
+	for table := range tables {
+		masked := false
+		for _, s := range stats {
+			if s.Name == table && (s.Masked || s.NoData) {
+				masked = true
+				break
+			}
+		}
+		if !masked {
+			return fmt.Errorf("masked table %s.%s was not dumped with its columns masked, check its name and the table filters", schema, table)
+		}
+	}
 	return nil
 }
+
+// newMasks creates the maskers of the rules, by schema, table and column, from the rules by
+// schema.table.column
+func newMasks(rules map[string]mask.Rule, salt string) (map[string]map[string]map[string]mask.Masker, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	saltBytes := []byte(salt)
+	if salt == "" {
+		var err error
+		if saltBytes, err = mask.RandomSalt(); err != nil {
+			return nil, err
+		}
+	}
+	masks := make(map[string]map[string]map[string]mask.Masker)
+	for name, rule := range rules {
+		schema, rest, _ := strings.Cut(name, ".")
+		i := strings.LastIndex(rest, ".")
+		if schema == "" || i < 1 || i == len(rest)-1 {
+			return nil, fmt.Errorf("invalid masked column %s, must be schema.table.column", name)
+		}
+		table, column := rest[:i], rest[i+1:]
+		masker, err := mask.New(rule, saltBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mask of %s: %v", name, err)
+		}
+		if masks[schema] == nil {
+			masks[schema] = make(map[string]map[string]mask.Masker)
+		}
+		if masks[schema][table] == nil {
+			masks[schema][table] = make(map[string]mask.Masker)
+		}
+		masks[schema][table][column] = masker
+	}
+	return masks, nil
+}
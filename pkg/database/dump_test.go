@@ -0,0 +1,47 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
+)
+
+func TestCheckMasked(t *testing.T) {
+	masker, err := mask.New(mask.Rule{Type: mask.Null}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	masks := map[string]map[string]mask.Masker{"customers": {"email": masker}}
+	tests := []struct {
+		name    string
+		stats   []mysql.TableStats
+		wantErr bool
+	}{
+		{"masked", []mysql.TableStats{{Name: "customers", Masked: true}, {Name: "orders"}}, false},
+		{"structure only", []mysql.TableStats{{Name: "customers", NoData: true}}, false},
+		{"not dumped", []mysql.TableStats{{Name: "orders"}}, true},
+		{"dumped unmasked", []mysql.TableStats{{Name: "customers"}}, true},
+		{"other case", []mysql.TableStats{{Name: "Customers", Masked: true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMasked("shop", masks, tt.stats)
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestWritersInclude(t *testing.T) {
+	writers := []DumpWriter{{Schemas: []string{"shop", "crm"}}, {Schemas: []string{"audit"}}}
+	for schema, expected := range map[string]bool{"shop": true, "audit": true, "shopp": false} {
+		if got := writersInclude(writers, schema); got != expected {
+			t.Errorf("%s: expected %v, got %v", schema, expected, got)
+		}
+	}
+}
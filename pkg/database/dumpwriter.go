@@ -6,5 +6,9 @@ import (
 
 type DumpWriter struct {
 	Schemas []string
-	Writer  io.Writer
+	// Writer where the schemas are dumped. If it also is an io.Closer, it is closed once they are complete.
+	Writer io.Writer
+	// TableWriter, if set, returns the writer for each base table in a schema, which then
+	// is dumped there rather than to Writer. Required to dump tables in parallel.
+	TableWriter func(schema, table string) (io.WriteCloser, error)
 }
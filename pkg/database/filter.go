@@ -0,0 +1,132 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// versionCommentRegex the start of a conditional comment, e.g. `/*!50001 `, which a dump
+	// wraps around statements for versions of the server that support them
+	versionCommentRegex = regexp.MustCompile(`^/\*!\d*\s*`)
+	identifier          = "`((?:[^`]|``)+)`"
+	// statements about a table or view, the name of which is the first submatch
+	tableStatementRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)^(?:DROP|CREATE|ALTER)\s+(?:TEMPORARY\s+)?TABLE\s+(?:IF\s+(?:NOT\s+)?EXISTS\s+)?` + identifier),
+		regexp.MustCompile(`(?i)^LOCK\s+TABLES\s+` + identifier),
+		regexp.MustCompile(`(?i)^(?:INSERT|REPLACE)\s+(?:IGNORE\s+)?INTO\s+` + identifier),
+		regexp.MustCompile(`(?i)^DROP\s+VIEW\s+(?:IF\s+EXISTS\s+)?` + identifier),
+		// the definer and other options before the object never have parentheses, which keeps a
+		// routine, the body of which might create a view, from matching
+		regexp.MustCompile(`(?is)^CREATE\b[^()]*?\bVIEW\s+` + identifier),
+		// a trigger is part of the table on which it is
+		regexp.MustCompile(`(?is)^CREATE\b[^()]*?\bTRIGGER\s+` + identifier + `\s+(?:BEFORE|AFTER)\s+\w+\s+ON\s+` + identifier),
+	}
+	// statements about objects of the schema as a whole, rather than a table
+	schemaObjectRegex = regexp.MustCompile(`(?is)^(?:DROP\s+(?:PROCEDURE|FUNCTION|EVENT|TRIGGER)\b|CREATE\b[^()]*?\b(?:PROCEDURE|FUNCTION|EVENT)\b)`)
+	// statements that create or drop a scheduled event; as with views, the definer and other options
+	// before the event never have parentheses, and the keyword is not part of a quoted name
+	eventStatementRegex = regexp.MustCompile(`(?is)^(?:DROP\s+EVENT\b|CREATE\b[^()]*?[^` + "`" + `\w]EVENT\s)`)
+	// statements that set the position in the binary log from which the server replicates, as
+	// written by a dump with source data
+	sourceDataRegex = regexp.MustCompile(`(?i)^(?:CHANGE\s+(?:MASTER|REPLICATION\s+SOURCE)\s+TO\b|SET\s+(?:GLOBAL\s+gtid_slave_pos|@@GLOBAL\.GTID_PURGED)\s*=)`)
+)
+
+// RestoreFilter selects the schemas and tables to restore. Tables are given as schema.table.
+// An empty filter selects everything.
+type RestoreFilter struct {
+	IncludeSchemas []string
+	ExcludeSchemas []string
+	IncludeTables  []string
+	ExcludeTables  []string
+}
+
+// Validate checks that the tables of the filter are in the form schema.table
+func (f RestoreFilter) Validate() error {
+	for _, t := range append(slices.Clone(f.IncludeTables), f.ExcludeTables...) {
+		if schema, table, ok := strings.Cut(t, "."); !ok || schema == "" || table == "" {
+			return fmt.Errorf("invalid table %s, must be schema.table", t)
+		}
+	}
+	return nil
+}
+
+// IsEmpty whether the filter selects everything
+func (f RestoreFilter) IsEmpty() bool {
+	return len(f.IncludeSchemas) == 0 && len(f.ExcludeSchemas) == 0 && len(f.IncludeTables) == 0 && len(f.ExcludeTables) == 0
+}
+
+// SchemaIncluded whether anything in the schema is selected. If tables are included but
+// schemas are not, the schemas of those tables are selected.
+func (f RestoreFilter) SchemaIncluded(schema string) bool {
+	if containsFold(f.ExcludeSchemas, schema) {
+		return false
+	}
+	if len(f.IncludeSchemas) > 0 {
+		return containsFold(f.IncludeSchemas, schema)
+	}
+	if len(f.IncludeTables) > 0 {
+		for _, t := range f.IncludeTables {
+			if s, _, _ := strings.Cut(t, "."); strings.EqualFold(s, schema) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// TableIncluded whether the table in the schema is selected
+func (f RestoreFilter) TableIncluded(schema, table string) bool {
+	if !f.SchemaIncluded(schema) {
+		return false
+	}
+	name := schema + "." + table
+	if containsFold(f.ExcludeTables, name) {
+		return false
+	}
+	return len(f.IncludeTables) == 0 || containsFold(f.IncludeTables, name)
+}
+
+// statementIncluded whether a statement, run in the schema, is selected. Statements about a
+// table are selected with the table; those about other objects of the schema, such as routines
+// and events, only when the whole schema is selected, rather than specific tables. Other
+// statements, such as those that set up the session, are selected with the schema.
+func (f RestoreFilter) statementIncluded(schema, stmt string) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	// statements before any schema is chosen set up the session
+	if schema != "" && !f.SchemaIncluded(schema) {
+		return false
+	}
+	stmt = versionCommentRegex.ReplaceAllString(stmt, "")
+	for _, re := range tableStatementRegexes {
+		if match := re.FindStringSubmatch(stmt); match != nil {
+			return f.TableIncluded(schema, unescapeIdentifier(match[len(match)-1]))
+		}
+	}
+	if schemaObjectRegex.MatchString(stmt) {
+		return len(f.IncludeTables) == 0
+	}
+	// the position of the dump is not that of the server once only some of it is restored
+	if sourceDataRegex.MatchString(stmt) {
+		return false
+	}
+	return true
+}
+
+// isEventStatement whether the statement creates or drops a scheduled event
+func isEventStatement(stmt string) bool {
+	return eventStatementRegex.MatchString(versionCommentRegex.ReplaceAllString(stmt, ""))
+}
+
+func unescapeIdentifier(name string) string {
+	return strings.ReplaceAll(name, "``", "`")
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(e string) bool { return strings.EqualFold(e, s) })
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestRestoreFilterStatementIncluded(t *testing.T) {
+	tableOnly := RestoreFilter{IncludeTables: []string{"shop.orders"}}
+	schemaOnly := RestoreFilter{IncludeSchemas: []string{"shop"}, ExcludeTables: []string{"shop.audit"}}
+	tests := []struct {
+		name     string
+		filter   RestoreFilter
+		schema   string
+		stmt     string
+		expected bool
+	}{
+		{"empty filter", RestoreFilter{}, "crm", "DROP TABLE IF EXISTS `customers`", true},
+		{"session setup", tableOnly, "", "/*!40101 SET NAMES utf8mb4 */", true},
+		{"create database", tableOnly, "shop", "CREATE DATABASE /*!32312 IF NOT EXISTS*/ `shop`", true},
+		{"other schema", tableOnly, "crm", "SET @saved_cs_client = @@character_set_client", false},
+		{"drop table", tableOnly, "shop", "DROP TABLE IF EXISTS `orders`", true},
+		{"create other table", tableOnly, "shop", "CREATE TABLE `customers` (`id` int)", false},
+		{"insert", tableOnly, "shop", "INSERT INTO `orders` VALUES (1),(2)", true},
+		{"insert other table", tableOnly, "shop", "INSERT INTO `customers` VALUES (1)", false},
+		{"lock table", tableOnly, "shop", "LOCK TABLES `orders` WRITE", true},
+		{"disable keys", tableOnly, "shop", "/*!40000 ALTER TABLE `orders` DISABLE KEYS */", true},
+		{"disable keys of other table", tableOnly, "shop", "/*!40000 ALTER TABLE `customers` DISABLE KEYS */", false},
+		{"case insensitive", tableOnly, "SHOP", "INSERT INTO `Orders` VALUES (1)", true},
+		{"view", tableOnly, "shop", "/*!50001 CREATE ALGORITHM=UNDEFINED */\n/*!50013 DEFINER=`root`@`%` SQL SECURITY DEFINER */\n/*!50001 VIEW `recent` AS select 1 */", false},
+		{"trigger", tableOnly, "shop", "CREATE DEFINER=`root`@`%` TRIGGER `orders_bi` BEFORE INSERT ON `orders` FOR EACH ROW SET NEW.id = 1", true},
+		{"trigger on other table", tableOnly, "shop", "CREATE DEFINER=`root`@`%` TRIGGER `customers_bi` BEFORE INSERT ON `customers` FOR EACH ROW SET NEW.id = 1", false},
+		{"routine with tables", tableOnly, "shop", "CREATE DEFINER=`root`@`%` PROCEDURE `p`() BEGIN CREATE VIEW `orders` AS SELECT 1; END", false},
+		{"routine with schema", schemaOnly, "shop", "CREATE DEFINER=`root`@`%` PROCEDURE `p`() BEGIN SELECT 1; END", true},
+		{"excluded table", schemaOnly, "shop", "INSERT INTO `audit` VALUES (1)", false},
+		{"source data", tableOnly, "", "CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000042', MASTER_LOG_POS=1234", false},
+		{"source data gtid", tableOnly, "", "SET GLOBAL gtid_slave_pos='0-1-5678'", false},
+		{"source data without filter", RestoreFilter{}, "", "CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000042', MASTER_LOG_POS=1234", true},
+		{"escaped identifier", RestoreFilter{IncludeTables: []string{"shop.a`b"}}, "shop", "INSERT INTO `a``b` VALUES (1)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.statementIncluded(tt.schema, tt.stmt); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsEventStatement(t *testing.T) {
+	tests := []struct {
+		name     string
+		stmt     string
+		expected bool
+	}{
+		{"create event", "CREATE DEFINER=`root`@`%` EVENT `purge` ON SCHEDULE EVERY 1 DAY DO DELETE FROM `orders`", true},
+		{"drop event", "/*!50106 DROP EVENT IF EXISTS `purge` */", true},
+		{"create table", "CREATE TABLE `event` (`id` int)", false},
+		{"create table named with event", "CREATE TABLE `my event` (`id` int)", false},
+		{"mysqldump event", "/*!50106 CREATE*/ /*!50117 DEFINER=`root`@`localhost`*/ /*!50106 EVENT `purge` ON SCHEDULE EVERY 1 DAY DO DELETE FROM `orders` */", true},
+		{"insert", "INSERT INTO `event` VALUES (1)", false},
+		{"routine creating an event", "CREATE DEFINER=`root`@`%` PROCEDURE `p`() BEGIN CREATE EVENT `e` ON SCHEDULE AT NOW() DO SELECT 1; END", false},
+		{"trigger", "CREATE DEFINER=`root`@`%` TRIGGER `orders_bi` BEFORE INSERT ON `orders` FOR EACH ROW SET NEW.id = 1", false},
+		{"session setup", "/*!50106 SET TIME_ZONE = 'SYSTEM' */", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEventStatement(tt.stmt); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRestoreFilterValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  RestoreFilter
+		wantErr bool
+	}{
+		{"empty", RestoreFilter{}, false},
+		{"valid", RestoreFilter{IncludeTables: []string{"shop.orders"}, ExcludeTables: []string{"crm.audit"}}, false},
+		{"missing schema", RestoreFilter{IncludeTables: []string{".orders"}}, true},
+		{"missing table", RestoreFilter{ExcludeTables: []string{"crm"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
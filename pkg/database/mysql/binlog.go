@@ -0,0 +1,128 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SourceDataNone the position in the binary log is not written to the dump
+	SourceDataNone = 0
+	// SourceDataStatement the position is written as statements that make the server into which
+	// the dump is restored replicate from it, as mysqldump --source-data=1
+	SourceDataStatement = 1
+	// SourceDataComment the statements are written as comments, for information only, as
+	// mysqldump --source-data=2
+	SourceDataComment = 2
+)
+
+// BinlogPosition a position in the binary log of the server
+type BinlogPosition struct {
+	File     string
+	Position uint64
+	// GTID the set of global transaction IDs up to the position, if the server has them
+	GTID string
+
+	// mysql whether the server is MySQL, rather than MariaDB, which differ in how they are
+	// told to replicate from the position
+	mysql bool
+}
+
+// sourceData the statements that start replication from the position, as they are written to the
+// header of the dump, commented out if commented is true
+func (p *BinlogPosition) sourceData(commented bool) string {
+	var stmts []string
+	if p.mysql {
+		stmts = append(stmts, fmt.Sprintf("CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='%s', SOURCE_LOG_POS=%d;", sanitize(p.File), p.Position))
+		if p.GTID != "" {
+			stmts = append(stmts, fmt.Sprintf("SET @@GLOBAL.GTID_PURGED='%s';", sanitize(p.GTID)))
+		}
+	} else {
+		stmts = append(stmts, fmt.Sprintf("CHANGE MASTER TO MASTER_LOG_FILE='%s', MASTER_LOG_POS=%d;", sanitize(p.File), p.Position))
+		if p.GTID != "" {
+			stmts = append(stmts, fmt.Sprintf("SET GLOBAL gtid_slave_pos='%s';", sanitize(p.GTID)))
+		}
+	}
+	var b strings.Builder
+	b.WriteString("--\n-- Position to start replication or point-in-time recovery from\n--\n\n")
+	for _, stmt := range stmts {
+		if commented {
+			b.WriteString("-- ")
+		}
+		b.WriteString(stmt + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// contextQueryer is satisfied by a *sql.DB, *sql.Conn and *sql.Tx
+type contextQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// QueryBinlogPosition get the current position in the binary log of the server. Returns nil
+// if binary logging is not enabled. This requires the REPLICATION CLIENT privilege, called
+// BINLOG MONITOR in recent versions of MariaDB. For the position to be consistent with what
+// is dumped, it must be queried while writes are blocked, as when creating a Snapshot.
+func QueryBinlogPosition(ctx context.Context, q contextQueryer) (*BinlogPosition, error) {
+	status, err := queryRowMap(ctx, q, "SHOW MASTER STATUS")
+	if err != nil {
+		// renamed in MySQL 8.4
+		var err2 error
+		if status, err2 = queryRowMap(ctx, q, "SHOW BINARY LOG STATUS"); err2 != nil {
+			return nil, err
+		}
+	}
+	if status == nil {
+		return nil, nil
+	}
+	pos := &BinlogPosition{File: status["File"].String}
+	if pos.Position, err = strconv.ParseUint(status["Position"].String, 10, 64); err != nil {
+		return nil, err
+	}
+	// MySQL reports the GTIDs with the position; MariaDB has its own variable
+	if gtid, ok := status["Executed_Gtid_Set"]; ok {
+		pos.GTID = gtid.String
+		pos.mysql = true
+		return pos, nil
+	}
+	gtid, err := queryRowMap(ctx, q, "SELECT @@GLOBAL.gtid_binlog_pos AS gtid")
+	if err == nil && gtid != nil {
+		pos.GTID = gtid["gtid"].String
+	}
+	return pos, nil
+}
+
+// queryRowMap runs a query that returns at most one row, returning it keyed by column name,
+// or nil if there was no row
+func queryRowMap(ctx context.Context, q contextQueryer, query string) (map[string]sql.NullString, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]sql.NullString, len(cols))
+	scans := make([]interface{}, len(cols))
+	for i := range values {
+		scans[i] = &values[i]
+	}
+	if err := rows.Scan(scans...); err != nil {
+		return nil, err
+	}
+	result := make(map[string]sql.NullString, len(cols))
+	for i, col := range cols {
+		result[col] = values[i]
+	}
+	return result, rows.Err()
+}
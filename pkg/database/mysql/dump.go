@@ -19,9 +19,14 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
+	"sync"
 	"text/template"
 	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
 )
 
 /*
@@ -30,24 +35,84 @@ Data struct to configure dump behavior
 	Out:              Stream to wite to
 	Connection:       Database connection to dump
 	IgnoreTables:     Mark sensitive tables to ignore
+	IgnoreTable:      Ignore any table for which this returns true, as well as IgnoreTables
 	MaxAllowedPacket: Sets the largest packet size to use in backups
 	LockTables:       Lock all tables for the duration of the dump
+	Triggers:         Dump the triggers defined on the dumped tables
+	Routines:         Dump stored procedures and functions
+	Events:           Dump scheduled events
+	Snapshot:         Read from these connections, rather than a transaction on Connection
+	TableOut:         Write each base table to its own writer, rather than to Out
+	RowFilters:       Dump only the rows of each table, by name, selected by its filter
+	Masks:            Mask the values of columns, by table and column name
+	NoData:           Dump only the structure of tables, without their rows
+	NoCreateInfo:     Dump only the rows of tables, without their structure or views
+	NoDataTable:      Dump only the structure of any table for which this returns true
+	SourceData:       Write the position in the binary log of Snapshot to the header, one of the SourceData modes
 */
 type Data struct {
 	Out                 io.Writer
 	Connection          *sql.DB
 	IgnoreTables        []string
+	IgnoreTable         func(name string) bool
 	MaxAllowedPacket    int
 	LockTables          bool
 	Schema              string
 	Compact             bool
 	Host                string
 	SuppressUseDatabase bool
-
-	tx         *sql.Tx
+	Triggers            bool
+	Routines            bool
+	Events              bool
+	Snapshot            *Snapshot
+	TableOut            func(table string) (io.WriteCloser, error)
+	RowFilters          map[string]RowFilter
+	Masks               map[string]map[string]mask.Masker
+	NoData              bool
+	NoCreateInfo        bool
+	NoDataTable         func(name string) bool
+	SourceData          int
+
+	tx         queryer
 	headerTmpl *template.Template
 	footerTmpl *template.Template
 	err        error
+	statsMu    sync.Mutex
+	stats      []TableStats
+}
+
+// RowFilter selects the rows of a table to dump
+type RowFilter struct {
+	// Where the condition of a WHERE clause, e.g. `created_at > '2024-01-01'`; all rows if blank
+	Where string
+	// Limit the most rows to dump; all of them if 0
+	Limit int
+}
+
+// clause the clauses to add to the SELECT of the rows of a table. The condition is in parentheses,
+// on a line of its own, so that neither an OR nor a trailing comment in it reaches past it.
+func (f RowFilter) clause() string {
+	var clause string
+	if f.Where != "" {
+		clause += " WHERE (" + f.Where + "\n)"
+	}
+	if f.Limit > 0 {
+		clause += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+	return clause
+}
+
+// TableStats what was dumped of a single base table
+type TableStats struct {
+	Name string
+	// NoData whether only the structure of the table was dumped, without its rows
+	NoData bool
+	// Rows the number of rows dumped
+	Rows int64
+	// Bytes the size of the SQL for the table, including its structure
+	Bytes int64
+	// Masked whether the rows of the table were dumped with its columns masked
+	Masked bool
 }
 
 type metaData struct {
@@ -56,6 +121,7 @@ type metaData struct {
 	CompleteTime  string
 	Host          string
 	Database      string
+	SourceData    string
 }
 
 const (
@@ -83,11 +149,14 @@ const headerTmpl = `-- Go SQL Dump {{ .DumpVersion }}
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
---
+{{ .SourceData }}--
 -- Current Database: ` + "`{{.Database}}`" + `
 --
 `
 
+// takes a *metaData
+const headerTmplCompact = `{{ .SourceData }}`
+
 const createUseDatabaseHeader = `
 CREATE DATABASE /*!32312 IF NOT EXISTS*/ ` + "`{{.Database}}`" + ` /*!40100 DEFAULT CHARACTER SET utf8mb4 COLLATE uca1400_ai_ci */ /*!80016 DEFAULT ENCRYPTION='N' */;
 
@@ -144,9 +213,14 @@ func (data *Data) Dump() error {
 		return err
 	}
 
+	if err := data.sourceData(&meta); err != nil {
+		return err
+	}
 	if err := data.headerTmpl.Execute(data.Out, meta); err != nil {
 		return err
 	}
+	// only the dump of the schema as a whole has the position, not those of its tables
+	meta.SourceData = ""
 
 	tables, err := data.getTables()
 	if err != nil {
@@ -173,6 +247,34 @@ func (data *Data) Dump() error {
 		}()
 	}
 
+	// routines come before the tables, so that any views that call a
+	// stored function can be created
+	if data.Routines {
+		routines, err := data.getRoutines()
+		if err != nil {
+			return err
+		}
+		for _, r := range routines {
+			if err := data.dumpTable(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	if data.TableOut != nil {
+		// base tables go to their own writers, possibly concurrently, while everything
+		// else, including the views that depend upon them, stays in Out
+		var views []Table
+		for _, table := range tables {
+			if _, ok := table.(*baseTable); !ok {
+				views = append(views, table)
+			}
+		}
+		if err := data.dumpTablesSeparately(tables, meta); err != nil {
+			return err
+		}
+		tables = views
+	}
 	for _, name := range tables {
 		if err := data.dumpTable(name); err != nil {
 			return err
@@ -182,6 +284,42 @@ func (data *Data) Dump() error {
 		return data.err
 	}
 
+	// the actual views replace their temporary stand-ins only once all of the tables
+	// and views exist, as mysqldump does, as any one of them may depend on the others
+	for _, table := range tables {
+		if v, ok := table.(*view); ok {
+			if err := v.ExecuteFinal(data.Out, data.Compact); err != nil {
+				return err
+			}
+		}
+	}
+
+	// triggers come after all of the tables, as each one requires its table to exist,
+	// and should not fire while the data is being loaded
+	if data.Triggers {
+		triggers, err := data.getTriggers()
+		if err != nil {
+			return err
+		}
+		for _, t := range triggers {
+			if err := data.dumpTable(t); err != nil {
+				return err
+			}
+		}
+	}
+
+	if data.Events {
+		events, err := data.getEvents()
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := data.dumpTable(e); err != nil {
+				return err
+			}
+		}
+	}
+
 	meta.CompleteTime = time.Now().UTC().Format("2006-01-02 15:04:05")
 	return data.footerTmpl.Execute(data.Out, meta)
 }
@@ -193,23 +331,58 @@ func (data *Data) selectSchema() error {
 	if data.Schema == "" {
 		return errors.New("cannot select schema when one is not provided")
 	}
+	if data.Snapshot != nil {
+		return data.Snapshot.use(data.Schema)
+	}
 	_, err := data.Connection.Exec("USE `" + data.Schema + "`")
 	return err
 }
 
 // begin starts a read only transaction that will be whatever the database was
-// when it was called
-func (data *Data) begin() (err error) {
-	data.tx, err = data.Connection.BeginTx(context.Background(), &sql.TxOptions{
+// when it was called. If we were given a snapshot, its transactions already are
+// started, so we just use them.
+func (data *Data) begin() error {
+	if data.Snapshot != nil {
+		if data.Snapshot.Size() == 0 {
+			return errors.New("snapshot is closed")
+		}
+		data.tx = data.Snapshot.conns[0]
+		return nil
+	}
+	tx, err := data.Connection.BeginTx(context.Background(), &sql.TxOptions{
 		Isolation: sql.LevelRepeatableRead,
 		ReadOnly:  true,
 	})
-	return
+	if err != nil {
+		return err
+	}
+	data.tx = tx
+	return nil
 }
 
-// rollback cancels the transaction
+// sourceData sets the position in the binary log of the snapshot on the metadata of the header,
+// if it is to be written to the dump
+func (data *Data) sourceData(meta *metaData) error {
+	if data.SourceData == SourceDataNone {
+		return nil
+	}
+	if data.SourceData != SourceDataStatement && data.SourceData != SourceDataComment {
+		return fmt.Errorf("invalid source data %d, must be %d, %d or %d", data.SourceData, SourceDataNone, SourceDataStatement, SourceDataComment)
+	}
+	// only a snapshot has a position that is consistent with what is dumped
+	if data.Snapshot == nil || data.Snapshot.BinlogPosition() == nil {
+		return errors.New("source data requires the position in the binary log of a snapshot")
+	}
+	meta.SourceData = data.Snapshot.BinlogPosition().sourceData(data.SourceData == SourceDataComment)
+	return nil
+}
+
+// rollback cancels the transaction. A snapshot is left for its owner to close.
 func (data *Data) rollback() error {
-	return data.tx.Rollback()
+	if tx, ok := data.tx.(*sql.Tx); ok {
+		return tx.Rollback()
+	}
+	return nil
 }
 
 // MARK: writter methods
@@ -221,7 +394,121 @@ func (data *Data) dumpTable(table Table) error {
 	if err := table.Init(); err != nil {
 		return err
 	}
-	return table.Execute(data.Out, data.Compact)
+	base, ok := table.(*baseTable)
+	if !ok {
+		return table.Execute(data.Out, data.Compact)
+	}
+	out := &countingWriter{w: data.Out}
+	if err := table.Execute(out, data.Compact); err != nil {
+		return err
+	}
+	data.addStats(base, out.n)
+	return nil
+}
+
+// Stats what was dumped of each base table, in order of name
+func (data *Data) Stats() []TableStats {
+	data.statsMu.Lock()
+	defer data.statsMu.Unlock()
+	stats := make([]TableStats, len(data.stats))
+	copy(stats, data.stats)
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+func (data *Data) addStats(table *baseTable, bytes int64) {
+	data.statsMu.Lock()
+	defer data.statsMu.Unlock()
+	data.stats = append(data.stats, TableStats{Name: table.Name(), NoData: !table.WithData(), Rows: table.rowCount, Bytes: bytes, Masked: table.masks != nil})
+}
+
+// dumpTablesSeparately dumps each base table to its own writer from TableOut. Each
+// one gets the header and footer, so that it can be restored on its own. If we have a
+// snapshot, the tables are dumped concurrently, one on each of its connections.
+func (data *Data) dumpTablesSeparately(tables []Table, meta metaData) error {
+	conns := []queryer{data.tx}
+	if data.Snapshot != nil {
+		conns = conns[:0]
+		for _, c := range data.Snapshot.conns {
+			conns = append(conns, c)
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		queue    = make(chan *baseTable)
+		done     = make(chan struct{})
+	)
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn queryer) {
+			defer wg.Done()
+			for table := range queue {
+				// once one has failed, the rest are only drained from the queue
+				select {
+				case <-done:
+					continue
+				default:
+				}
+				table.conn = conn
+				if err := data.dumpTableTo(table, meta); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						close(done)
+					}
+					mu.Unlock()
+				}
+			}
+		}(conn)
+	}
+	func() {
+		defer close(queue)
+		for _, table := range tables {
+			t, ok := table.(*baseTable)
+			if !ok {
+				continue
+			}
+			select {
+			case queue <- t:
+			case <-done:
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	return firstErr
+}
+
+// dumpTableTo dumps a single base table to its own writer
+func (data *Data) dumpTableTo(table *baseTable, meta metaData) error {
+	out, err := data.TableOut(table.Name())
+	if err != nil {
+		return fmt.Errorf("failed to create output for table %s: %w", table.Name(), err)
+	}
+	defer out.Close()
+	if err := data.headerTmpl.Execute(out, meta); err != nil {
+		return err
+	}
+	if err := table.Init(); err != nil {
+		return fmt.Errorf("failed to initialize table %s: %w", table.Name(), err)
+	}
+	counted := &countingWriter{w: out}
+	if err := table.Execute(counted, data.Compact); err != nil {
+		return fmt.Errorf("failed to dump table %s: %w", table.Name(), err)
+	}
+	if err := table.Err(); err != nil {
+		return fmt.Errorf("failed to read table %s: %w", table.Name(), err)
+	}
+	data.addStats(table, counted.n)
+	tableMeta := meta
+	tableMeta.CompleteTime = time.Now().UTC().Format("2006-01-02 15:04:05")
+	if err := data.footerTmpl.Execute(out, tableMeta); err != nil {
+		return err
+	}
+	return out.Close()
 }
 
 // MARK: get methods
@@ -232,6 +519,8 @@ func (data *Data) getTemplates() (err error) {
 	fTmpl := footerTmpl
 	if data.Compact {
 		fTmpl = footerTmplCompact
+		// the position still is needed, even without the rest of the header
+		hTmpl = headerTmplCompact
 	} else {
 		hTmpl = headerTmpl
 	}
@@ -279,6 +568,10 @@ func (data *Data) getTables() ([]Table, error) {
 		}
 		switch tableType.String {
 		case "VIEW":
+			// a view is only structure
+			if data.NoCreateInfo {
+				continue
+			}
 			tables = append(tables, &view{baseTable: table})
 		case "BASE TABLE":
 			tables = append(tables, &table)
@@ -289,13 +582,135 @@ func (data *Data) getTables() ([]Table, error) {
 	return tables, rows.Err()
 }
 
+func (data *Data) getTriggers() ([]Table, error) {
+	triggers := make([]Table, 0)
+
+	rows, err := data.tx.Query("SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE FROM INFORMATION_SCHEMA.TRIGGERS WHERE TRIGGER_SCHEMA = ? ORDER BY EVENT_OBJECT_TABLE, ACTION_ORDER", data.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list triggers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var triggerName, tableName sql.NullString
+		if err := rows.Scan(&triggerName, &tableName); err != nil {
+			return nil, err
+		}
+		// a trigger on a table we do not dump would fail to restore
+		if !triggerName.Valid || data.isIgnoredTable(tableName.String) {
+			continue
+		}
+		triggers = append(triggers, &trigger{
+			storedObject: storedObject{baseTable: baseTable{
+				name:     triggerName.String,
+				data:     data,
+				database: data.Schema,
+			}},
+			table: tableName.String,
+		})
+	}
+	return triggers, rows.Err()
+}
+
+func (data *Data) getRoutines() ([]Table, error) {
+	routines := make([]Table, 0)
+
+	rows, err := data.tx.Query("SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ? AND ROUTINE_TYPE IN ('"+routineFunction+"', '"+routineProcedure+"') ORDER BY ROUTINE_TYPE, ROUTINE_NAME", data.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routines: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var routineName, routineType sql.NullString
+		if err := rows.Scan(&routineName, &routineType); err != nil {
+			return nil, err
+		}
+		if !routineName.Valid {
+			continue
+		}
+		routines = append(routines, &routine{
+			storedObject: storedObject{baseTable: baseTable{
+				name:     routineName.String,
+				data:     data,
+				database: data.Schema,
+			}},
+			kind: routineType.String,
+		})
+	}
+	return routines, rows.Err()
+}
+
+func (data *Data) getEvents() ([]Table, error) {
+	events := make([]Table, 0)
+
+	rows, err := data.tx.Query("SELECT EVENT_NAME FROM INFORMATION_SCHEMA.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME", data.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventName sql.NullString
+		if err := rows.Scan(&eventName); err != nil {
+			return nil, err
+		}
+		if !eventName.Valid {
+			continue
+		}
+		events = append(events, &event{
+			storedObject: storedObject{baseTable: baseTable{
+				name:     eventName.String,
+				data:     data,
+				database: data.Schema,
+			}},
+		})
+	}
+	return events, rows.Err()
+}
+
+// showCreate runs one of the SHOW CREATE statements, returning the single resulting row
+// keyed by column name. The columns returned vary by object type and server version,
+// so we do not scan into fixed positions.
+func (data *Data) showCreate(query string) (map[string]sql.NullString, error) {
+	rows, err := data.tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("no rows returned")
+	}
+	values := make([]sql.NullString, len(cols))
+	scans := make([]interface{}, len(cols))
+	for i := range values {
+		scans[i] = &values[i]
+	}
+	if err := rows.Scan(scans...); err != nil {
+		return nil, err
+	}
+	result := make(map[string]sql.NullString, len(cols))
+	for i, col := range cols {
+		result[col] = values[i]
+	}
+	return result, rows.Err()
+}
+
 func (data *Data) isIgnoredTable(name string) bool {
 	for _, item := range data.IgnoreTables {
 		if item == name {
 			return true
 		}
 	}
-	return false
+	return data.IgnoreTable != nil && data.IgnoreTable(name)
 }
 
 func (meta *metaData) updateServerVersion(data *Data) (err error) {
@@ -305,6 +720,18 @@ func (meta *metaData) updateServerVersion(data *Data) (err error) {
 	return
 }
 
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 func sub(a, b int) int {
 	return a - b
 }
@@ -0,0 +1,179 @@
+package mysql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRowFilterClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   RowFilter
+		expected string
+	}{
+		{"none", RowFilter{}, ""},
+		{"where", RowFilter{Where: "id > 10"}, " WHERE (id > 10\n)"},
+		{"limit", RowFilter{Limit: 5}, " LIMIT 5"},
+		{"where and limit", RowFilter{Where: "id > 10", Limit: 5}, " WHERE (id > 10\n) LIMIT 5"},
+		{"or", RowFilter{Where: "a = 1 OR b = 2", Limit: 5}, " WHERE (a = 1 OR b = 2\n) LIMIT 5"},
+		{"trailing comment", RowFilter{Where: "id > 10 -- recent", Limit: 5}, " WHERE (id > 10 -- recent\n) LIMIT 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if clause := tt.filter.clause(); clause != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, clause)
+			}
+		})
+	}
+}
+
+// separateOut collects the output of each table dumped to its own writer
+type separateOut struct {
+	mu     sync.Mutex
+	tables map[string]*bytes.Buffer
+	// fail whether creating the output of a table fails
+	fail bool
+}
+
+func (o *separateOut) tableOut(name string) (io.WriteCloser, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.tables == nil {
+		o.tables = map[string]*bytes.Buffer{}
+	}
+	o.tables[name] = &bytes.Buffer{}
+	if o.fail {
+		return nil, errors.New("failed to create output")
+	}
+	return nopWriteCloser{o.tables[name]}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// expectTable expects the base table, with a single int column, to be dumped with the rows of ids
+func expectTable(mock sqlmock.Sqlmock, name string, ids ...int64) {
+	mock.ExpectQuery("SHOW COLUMNS FROM `" + name + "`").WillReturnRows(
+		sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).AddRow("id", "int", "YES", "", nil, ""))
+	mock.ExpectQuery("SHOW CREATE TABLE `" + name + "`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow(name, "CREATE TABLE `"+name+"` (`id` int)"))
+	rows := sqlmock.NewRowsWithColumnDefinition(sqlmock.NewColumn("id").OfType("INT", int64(0)).Nullable(true))
+	for _, id := range ids {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery("SELECT `id` FROM `" + name + "`").WillReturnRows(rows)
+}
+
+func TestDumpTablesSeparately(t *testing.T) {
+	s, mock := newMockSnapshot(t, 2)
+	// the tables are dumped concurrently, on each of the connections
+	mock.MatchExpectationsInOrder(false)
+	expectTable(mock, "a", 1, 2)
+	expectTable(mock, "b", 3)
+	expectTable(mock, "c")
+
+	out := &separateOut{}
+	data := &Data{Schema: "shop", Compact: true, Snapshot: s, TableOut: out.tableOut}
+	if err := data.getTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.begin(); err != nil {
+		t.Fatal(err)
+	}
+	var tables []Table
+	for _, name := range []string{"a", "b", "c"} {
+		tables = append(tables, &baseTable{name: name, data: data, database: "shop"})
+	}
+	// views stay in the dump of the schema
+	tables = append(tables, &view{baseTable: baseTable{name: "v", data: data, database: "shop"}})
+	if err := data.dumpTablesSeparately(tables, metaData{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if len(out.tables) != 3 {
+		t.Errorf("dumped %d tables, expected 3", len(out.tables))
+	}
+	for name, ids := range map[string][]int{"a": {1, 2}, "b": {3}} {
+		for _, id := range ids {
+			if !strings.Contains(out.tables[name].String(), fmt.Sprintf("INSERT INTO `%s` (`id`) VALUES (%d);", name, id)) {
+				t.Errorf("row %d of table %s missing from its dump:\n%s", id, name, out.tables[name])
+			}
+		}
+	}
+	var rows []int64
+	for _, stats := range data.Stats() {
+		rows = append(rows, stats.Rows)
+	}
+	if fmt.Sprint(rows) != "[2 1 0]" {
+		t.Errorf("rows %v, expected [2 1 0]", rows)
+	}
+}
+
+func TestDumpTablesSeparatelyFailure(t *testing.T) {
+	t.Run("output", func(t *testing.T) {
+		s, mock := newMockSnapshot(t, 2)
+		out := &separateOut{fail: true}
+		data := &Data{Schema: "shop", Compact: true, Snapshot: s, TableOut: out.tableOut}
+		if err := data.getTemplates(); err != nil {
+			t.Fatal(err)
+		}
+		if err := data.begin(); err != nil {
+			t.Fatal(err)
+		}
+		var tables []Table
+		for i := 0; i < 20; i++ {
+			tables = append(tables, &baseTable{name: fmt.Sprintf("t%02d", i), data: data, database: "shop"})
+		}
+		if err := data.dumpTablesSeparately(tables, metaData{}); err == nil || !strings.Contains(err.Error(), "failed to create output") {
+			t.Fatalf("unexpected error %v", err)
+		}
+		// once the first has failed, no more are started than were in progress on the other connections
+		if len(out.tables) > s.Size() {
+			t.Errorf("%d tables were started after the first failed", len(out.tables)-1)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		s, mock := newMockSnapshot(t, 1)
+		mock.ExpectQuery("SHOW COLUMNS FROM `a`").WillReturnError(errors.New("table is corrupt"))
+		out := &separateOut{}
+		data := &Data{Schema: "shop", Compact: true, Snapshot: s, TableOut: out.tableOut}
+		if err := data.getTemplates(); err != nil {
+			t.Fatal(err)
+		}
+		if err := data.begin(); err != nil {
+			t.Fatal(err)
+		}
+		tables := []Table{
+			&baseTable{name: "a", data: data, database: "shop"},
+			&baseTable{name: "b", data: data, database: "shop"},
+		}
+		err := data.dumpTablesSeparately(tables, metaData{})
+		if err == nil || !strings.Contains(err.Error(), "failed to initialize table a: table is corrupt") {
+			t.Fatalf("unexpected error %v", err)
+		}
+		// the only connection failed on the first table, so the second is not dumped
+		if _, ok := out.tables["b"]; ok {
+			t.Error("table b dumped after table a failed")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
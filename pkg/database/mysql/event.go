@@ -0,0 +1,42 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+)
+
+// event a scheduled event
+type event struct {
+	storedObject
+}
+
+var (
+	eventFullTemplate = parseStoredObjectTemplate("mysqldumpEvent", `
+--
+-- Dumping event {{ esc .Name }}
+--
+
+/*!50106 DROP EVENT IF EXISTS {{ esc .Name }} */;`)
+	eventCompactTemplate = parseStoredObjectTemplate("mysqldumpEventCompact", `
+/*!50106 DROP EVENT IF EXISTS {{ esc .Name }} */;`)
+)
+
+// Init retrieves the event definition via SHOW CREATE EVENT
+func (e *event) Init() error {
+	row, err := e.data.showCreate("SHOW CREATE EVENT " + esc(e.Name()))
+	if err != nil {
+		return fmt.Errorf("failed to get definition for event %s: %w", e.name, err)
+	}
+	if row["Event"].String != e.name {
+		return fmt.Errorf("returned event %s is not the same as requested event %s", row["Event"].String, e.name)
+	}
+	return e.initDefinition(row, "event", "Create Event")
+}
+
+func (e *event) Execute(out io.Writer, compact bool) error {
+	tmpl := eventFullTemplate
+	if compact {
+		tmpl = eventCompactTemplate
+	}
+	return tmpl.Execute(out, e)
+}
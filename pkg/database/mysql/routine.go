@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	routineProcedure = "PROCEDURE"
+	routineFunction  = "FUNCTION"
+)
+
+// routine a stored procedure or stored function
+type routine struct {
+	storedObject
+	kind string
+}
+
+var (
+	routineFullTemplate = parseStoredObjectTemplate("mysqldumpRoutine", `
+--
+-- Dumping routine {{ .Kind }} {{ esc .Name }}
+--
+
+/*!50003 DROP {{ .Kind }} IF EXISTS {{ esc .Name }} */;`)
+	routineCompactTemplate = parseStoredObjectTemplate("mysqldumpRoutineCompact", `
+/*!50003 DROP {{ .Kind }} IF EXISTS {{ esc .Name }} */;`)
+)
+
+// Init retrieves the routine definition via SHOW CREATE PROCEDURE or SHOW CREATE FUNCTION
+func (r *routine) Init() error {
+	var nameCol, createCol string
+	switch r.kind {
+	case routineProcedure:
+		nameCol, createCol = "Procedure", "Create Procedure"
+	case routineFunction:
+		nameCol, createCol = "Function", "Create Function"
+	default:
+		return fmt.Errorf("unknown routine type %s for routine %s", r.kind, r.name)
+	}
+	row, err := r.data.showCreate("SHOW CREATE " + r.kind + " " + esc(r.Name()))
+	if err != nil {
+		return fmt.Errorf("failed to get definition for %s %s: %w", r.kind, r.name, err)
+	}
+	if row[nameCol].String != r.name {
+		return fmt.Errorf("returned %s %s is not the same as requested %s", r.kind, row[nameCol].String, r.name)
+	}
+	return r.initDefinition(row, r.kind, createCol)
+}
+
+func (r *routine) Execute(out io.Writer, compact bool) error {
+	tmpl := routineFullTemplate
+	if compact {
+		tmpl = routineCompactTemplate
+	}
+	return tmpl.Execute(out, r)
+}
+
+// Kind whether this is a PROCEDURE or a FUNCTION
+func (r *routine) Kind() string {
+	return r.kind
+}
@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// queryer is satisfied by both a *sql.Tx and a snapshot connection, so the dump
+// can read from either
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// snapshotConn a single connection within a Snapshot
+type snapshotConn struct {
+	conn *sql.Conn
+}
+
+func (c *snapshotConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (c *snapshotConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+// Snapshot a set of connections, each with its own transaction, all of which see the
+// database at the same point in time. This allows tables to be dumped concurrently,
+// while the dump as a whole remains consistent.
+//
+// The transactions are started with START TRANSACTION WITH CONSISTENT SNAPSHOT while
+// all of the connections are held under FLUSH TABLES WITH READ LOCK, so that no write can
+// be committed between the start of one and the next. The lock is released as soon as
+// the last transaction has started. This requires the RELOAD privilege, and is only
+// consistent for transactional storage engines, such as InnoDB.
+type Snapshot struct {
+	conns    []*snapshotConn
+	position *BinlogPosition
+}
+
+// NewSnapshot opens size connections from db, and starts a transaction on each at the same snapshot.
+func NewSnapshot(ctx context.Context, db *sql.DB, size int) (*Snapshot, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("snapshot size must be at least 1, not %d", size)
+	}
+	s := &Snapshot{}
+	for i := 0; i < size; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("failed to open connection %d of %d: %w", i+1, size, err)
+		}
+		s.conns = append(s.conns, &snapshotConn{conn: conn})
+	}
+
+	lock := s.conns[0].conn
+	if _, err := lock.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("failed to lock tables, check for RELOAD privilege: %w", err)
+	}
+	for i, c := range s.conns {
+		if _, err := c.conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+			_, _ = lock.ExecContext(ctx, "UNLOCK TABLES")
+			_ = s.Close()
+			return nil, fmt.Errorf("failed to set isolation level on connection %d: %w", i+1, err)
+		}
+		if _, err := c.conn.ExecContext(ctx, "START TRANSACTION /*!40100 WITH CONSISTENT SNAPSHOT */"); err != nil {
+			_, _ = lock.ExecContext(ctx, "UNLOCK TABLES")
+			_ = s.Close()
+			return nil, fmt.Errorf("failed to start transaction on connection %d: %w", i+1, err)
+		}
+	}
+	// while writes are blocked, the binary log is at exactly the point of the snapshot; it is
+	// not an error to be unable to read it, as the dump does not depend upon it
+	s.position, _ = QueryBinlogPosition(ctx, lock)
+	if _, err := lock.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("failed to unlock tables: %w", err)
+	}
+	return s, nil
+}
+
+// Size the number of connections in the snapshot
+func (s *Snapshot) Size() int {
+	return len(s.conns)
+}
+
+// BinlogPosition the position in the binary log at which the snapshot was taken, or nil if
+// binary logging is not enabled or the position could not be read
+func (s *Snapshot) BinlogPosition() *BinlogPosition {
+	return s.position
+}
+
+// use selects the schema on every connection
+func (s *Snapshot) use(schema string) error {
+	for i, c := range s.conns {
+		if _, err := c.conn.ExecContext(context.Background(), "USE "+esc(schema)); err != nil {
+			return fmt.Errorf("failed to select schema %s on connection %d: %w", schema, i+1, err)
+		}
+	}
+	return nil
+}
+
+// Close ends the transactions and returns the connections to the pool
+func (s *Snapshot) Close() error {
+	var errs []error
+	for _, c := range s.conns {
+		// the transaction only ever reads, so rolling back is the same as committing
+		_, _ = c.conn.ExecContext(context.Background(), "ROLLBACK")
+		if err := c.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.conns = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	isolationStmt = "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"
+	snapshotStmt  = "START TRANSACTION /*!40100 WITH CONSISTENT SNAPSHOT */"
+)
+
+// newMockSnapshot a snapshot of size connections to a mock database, at binlog.000002:157
+func newMockSnapshot(t *testing.T, size int) (*Snapshot, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < size; i++ {
+		mock.ExpectExec(isolationStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(snapshotStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("binlog.000002", "157", "", "", "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"))
+	mock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+	s, err := NewSnapshot(context.Background(), db, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	return s, mock
+}
+
+// expectClose expects the snapshot of size connections to be closed
+func expectClose(mock sqlmock.Sqlmock, size int) {
+	for i := 0; i < size; i++ {
+		mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+func TestNewSnapshot(t *testing.T) {
+	s, mock := newMockSnapshot(t, 2)
+	if s.Size() != 2 {
+		t.Errorf("snapshot has %d connections, expected 2", s.Size())
+	}
+	pos := s.BinlogPosition()
+	if pos == nil || pos.File != "binlog.000002" || pos.Position != 157 || pos.GTID != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5" {
+		t.Errorf("mismatched position in binary log: %+v", pos)
+	}
+	expectClose(mock, 2)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewSnapshotErrors(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name string
+		// expect the statements up to and including the one that fails
+		expect   func(mock sqlmock.Sqlmock)
+		expected string
+	}{
+		{"lock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnError(failed)
+		}, "RELOAD privilege"},
+		{"isolation level", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(isolationStmt).WillReturnError(failed)
+			mock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+		}, "isolation level on connection 1"},
+		{"transaction", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(isolationStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(snapshotStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(isolationStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(snapshotStmt).WillReturnError(failed)
+			mock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+		}, "start transaction on connection 2"},
+		{"unlock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+			for i := 0; i < 2; i++ {
+				mock.ExpectExec(isolationStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(snapshotStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(sqlmock.NewRows([]string{"File", "Position"}))
+			mock.ExpectExec("UNLOCK TABLES").WillReturnError(failed)
+		}, "unlock tables"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			tt.expect(mock)
+			// the transactions of every connection are ended, whether or not they were started
+			expectClose(mock, 2)
+			s, err := NewSnapshot(context.Background(), db, 2)
+			if err == nil {
+				t.Fatal("missing error")
+			}
+			if s != nil {
+				t.Error("snapshot returned with an error")
+			}
+			if !errors.Is(err, failed) || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("error %q does not mention %q", err, tt.expected)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if _, err := NewSnapshot(context.Background(), nil, 0); err == nil {
+		t.Error("missing error for a snapshot without connections")
+	}
+}
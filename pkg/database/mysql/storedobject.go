@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"text/template"
+)
+
+// storedObject what triggers, routines and events have in common: a definition, and the
+// session variables that were in effect when it was created, which are set around it in the
+// dump so that it is recreated identically
+type storedObject struct {
+	baseTable
+	sqlMode string
+	// timeZone the time zone of an event; blank for other objects, which do not have one
+	timeZone  string
+	charset   string
+	collation string
+	createSQL string
+}
+
+// initDefinition sets the definition of the object, of the given kind, from the column createCol
+// of the row returned by its SHOW CREATE statement, along with its session variables
+func (o *storedObject) initDefinition(row map[string]sql.NullString, kind, createCol string) error {
+	createSQL := row[createCol]
+	if !createSQL.Valid {
+		return fmt.Errorf("no definition returned for %s %s, check privileges", kind, o.name)
+	}
+	o.createSQL = createSQL.String
+	o.sqlMode = row["sql_mode"].String
+	o.timeZone = row["time_zone"].String
+	o.charset = row["character_set_client"].String
+	o.collation = row["collation_connection"].String
+	return nil
+}
+
+func (o *storedObject) CreateSQL() ([]string, error) {
+	return []string{o.createSQL}, nil
+}
+
+func (o *storedObject) SQLMode() string {
+	return o.sqlMode
+}
+
+func (o *storedObject) TimeZone() string {
+	return o.timeZone
+}
+
+func (o *storedObject) Charset() string {
+	return o.charset
+}
+
+func (o *storedObject) Collation() string {
+	return o.collation
+}
+
+// parseStoredObjectTemplate parses the template of a kind of stored object, which starts with
+// the statement that drops it, and is followed by storedObjectTmpl
+func parseStoredObjectTemplate(name, text string) *template.Template {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"sub": sub,
+		"esc": esc,
+	}).Parse(text + storedObjectTmpl)
+	if err != nil {
+		panic(fmt.Errorf("could not parse template %s: %w", name, err))
+	}
+	return tmpl
+}
+
+// storedObjectTmpl the definition of a stored object, with its session variables set around it
+const storedObjectTmpl = `
+{{- if .TimeZone }}
+/*!50106 SET @save_time_zone       = @@TIME_ZONE */ ;
+/*!50106 SET TIME_ZONE             = '{{ .TimeZone }}' */ ;
+{{- end }}
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = {{ .Charset }} */ ;
+/*!50003 SET character_set_results = {{ .Charset }} */ ;
+/*!50003 SET collation_connection  = {{ .Collation }} */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = '{{ .SQLMode }}' */ ;
+DELIMITER ;;
+{{ index .CreateSQL 0 }} ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+{{- if .TimeZone }}
+/*!50106 SET TIME_ZONE             = @save_time_zone */ ;
+{{- end }}
+`
@@ -0,0 +1,89 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func TestStoredObjectInitDefinition(t *testing.T) {
+	row := map[string]sql.NullString{
+		"Create Event":         {String: "CREATE EVENT `purge` ON SCHEDULE EVERY 1 DAY DO SELECT 1", Valid: true},
+		"sql_mode":             {String: "STRICT_TRANS_TABLES", Valid: true},
+		"time_zone":            {String: "SYSTEM", Valid: true},
+		"character_set_client": {String: "utf8mb4", Valid: true},
+		"collation_connection": {String: "utf8mb4_general_ci", Valid: true},
+	}
+	o := &storedObject{baseTable: baseTable{name: "purge"}}
+	if err := o.initDefinition(row, "event", "Create Event"); err != nil {
+		t.Fatal(err)
+	}
+	createSQL, _ := o.CreateSQL()
+	if createSQL[0] != row["Create Event"].String || o.SQLMode() != "STRICT_TRANS_TABLES" || o.TimeZone() != "SYSTEM" ||
+		o.Charset() != "utf8mb4" || o.Collation() != "utf8mb4_general_ci" {
+		t.Errorf("mismatched definition: %+v", o)
+	}
+	// without privileges, the definition is NULL
+	delete(row, "Create Event")
+	if err := o.initDefinition(row, "event", "Create Event"); err == nil {
+		t.Error("missing error for an event without a definition")
+	}
+}
+
+func TestStoredObjectExecute(t *testing.T) {
+	definition := storedObject{sqlMode: "STRICT_TRANS_TABLES", charset: "utf8mb4", collation: "utf8mb4_general_ci"}
+	session := `/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'STRICT_TRANS_TABLES' */ ;
+DELIMITER ;;
+`
+	restore := ` ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+`
+
+	tr := &trigger{storedObject: definition, table: "orders"}
+	tr.name, tr.createSQL = "orders_bi", "CREATE TRIGGER `orders_bi` BEFORE INSERT ON `orders` FOR EACH ROW SET NEW.id = 1"
+	r := &routine{storedObject: definition, kind: routineProcedure}
+	r.name, r.createSQL = "p", "CREATE PROCEDURE `p`() SELECT 1"
+	e := &event{storedObject: definition}
+	e.name, e.createSQL, e.timeZone = "purge", "CREATE EVENT `purge` ON SCHEDULE EVERY 1 DAY DO SELECT 1", "SYSTEM"
+
+	tests := []struct {
+		name     string
+		object   Table
+		compact  bool
+		expected string
+	}{
+		{"trigger", tr, false, "\n--\n-- Trigger `orders_bi` on table `orders`\n--\n\n/*!50032 DROP TRIGGER IF EXISTS `orders_bi` */;\n" + session + tr.createSQL + restore},
+		{"trigger compact", tr, true, "\n/*!50032 DROP TRIGGER IF EXISTS `orders_bi` */;\n" + session + tr.createSQL + restore},
+		{"routine", r, false, "\n--\n-- Dumping routine PROCEDURE `p`\n--\n\n/*!50003 DROP PROCEDURE IF EXISTS `p` */;\n" + session + r.createSQL + restore},
+		{"routine compact", r, true, "\n/*!50003 DROP PROCEDURE IF EXISTS `p` */;\n" + session + r.createSQL + restore},
+		// only an event has a time zone, which is set around the rest
+		{"event", e, false, "\n--\n-- Dumping event `purge`\n--\n\n/*!50106 DROP EVENT IF EXISTS `purge` */;\n" +
+			"/*!50106 SET @save_time_zone       = @@TIME_ZONE */ ;\n/*!50106 SET TIME_ZONE             = 'SYSTEM' */ ;\n" +
+			session + e.createSQL + restore + "/*!50106 SET TIME_ZONE             = @save_time_zone */ ;\n"},
+		{"event compact", e, true, "\n/*!50106 DROP EVENT IF EXISTS `purge` */;\n" +
+			"/*!50106 SET @save_time_zone       = @@TIME_ZONE */ ;\n/*!50106 SET TIME_ZONE             = 'SYSTEM' */ ;\n" +
+			session + e.createSQL + restore + "/*!50106 SET TIME_ZONE             = @save_time_zone */ ;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.object.Execute(&buf, tt.compact); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
 )
 
 var tableFullTemplate, tableCompactTemplate *template.Template
@@ -53,9 +56,13 @@ type baseTable struct {
 
 	cols     []string
 	data     *Data
+	conn     queryer
 	rows     *sql.Rows
 	database string
 	values   []interface{}
+	rowCount int64
+	// masks the masker of each column, by index, if any of them are masked
+	masks []mask.Masker
 }
 
 func (table *baseTable) Name() string {
@@ -73,9 +80,18 @@ func (table *baseTable) Database() string {
 	return table.database
 }
 
+// queryer the connection from which to read the table. Tables dumped concurrently each
+// are given a connection of their own, otherwise it is the transaction of the dump.
+func (table *baseTable) queryer() queryer {
+	if table.conn != nil {
+		return table.conn
+	}
+	return table.data.tx
+}
+
 func (table *baseTable) CreateSQL() ([]string, error) {
 	var tableReturn, tableSQL sql.NullString
-	if err := table.data.tx.QueryRow("SHOW CREATE TABLE "+esc(table.Name())).Scan(&tableReturn, &tableSQL); err != nil {
+	if err := table.queryer().QueryRow("SHOW CREATE TABLE "+esc(table.Name())).Scan(&tableReturn, &tableSQL); err != nil {
 		return nil, err
 	}
 
@@ -87,7 +103,7 @@ func (table *baseTable) CreateSQL() ([]string, error) {
 }
 
 func (table *baseTable) initColumnData() error {
-	colInfo, err := table.data.tx.Query("SHOW COLUMNS FROM " + esc(table.Name()))
+	colInfo, err := table.queryer().Query("SHOW COLUMNS FROM " + esc(table.Name()))
 	if err != nil {
 		return err
 	}
@@ -142,6 +158,16 @@ func (table *baseTable) columnsList() string {
 	return "`" + strings.Join(table.cols, "`, `") + "`"
 }
 
+// WithCreateInfo whether the structure of the table is dumped
+func (table *baseTable) WithCreateInfo() bool {
+	return !table.data.NoCreateInfo
+}
+
+// WithData whether the rows of the table are dumped
+func (table *baseTable) WithData() bool {
+	return !table.data.NoData && (table.data.NoDataTable == nil || !table.data.NoDataTable(table.Name()))
+}
+
 func (table *baseTable) Init() error {
 	return table.initColumnData()
 }
@@ -156,8 +182,16 @@ func (table *baseTable) Start() error {
 		return nil
 	}
 
+	if err := table.initMasks(); err != nil {
+		return err
+	}
+
 	var err error
-	table.rows, err = table.data.tx.Query("SELECT " + table.columnsList() + " FROM " + esc(table.Name()))
+	query := "SELECT " + table.columnsList() + " FROM " + esc(table.Name())
+	if filter, ok := table.data.RowFilters[table.Name()]; ok {
+		query += filter.clause()
+	}
+	table.rows, err = table.queryer().Query(query)
 	if err != nil {
 		return err
 	}
@@ -174,6 +208,30 @@ func (table *baseTable) Start() error {
 	return nil
 }
 
+// initMasks finds the masker of each column of the table that is masked. A masked column
+// that is not dumped is an error, as it most likely is a mistake in its name, which would
+// leave the column it was meant for unmasked.
+func (table *baseTable) initMasks() error {
+	columns, ok := table.data.Masks[table.Name()]
+	if !ok {
+		return nil
+	}
+	table.masks = make([]mask.Masker, len(table.cols))
+	for name, masker := range columns {
+		found := false
+		for i, col := range table.cols {
+			if strings.EqualFold(col, name) {
+				table.masks[i] = masker
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("masked column %s is not a column dumped of table %s", name, table.Name())
+		}
+	}
+	return nil
+}
+
 func (table *baseTable) Next() bool {
 	if table.rows == nil {
 		if err := table.Start(); err != nil {
@@ -190,6 +248,7 @@ func (table *baseTable) Next() bool {
 			table.err = err
 			return false
 		}
+		table.rowCount++
 	} else {
 		table.rows.Close()
 		table.rows = nil
@@ -210,6 +269,10 @@ func (table *baseTable) RowBuffer() *bytes.Buffer {
 		if key != 0 {
 			b.WriteString(",")
 		}
+		if table.masks != nil && table.masks[key] != nil {
+			writeMasked(&b, table.masks[key], value)
+			continue
+		}
 		switch s := value.(type) {
 		case nil:
 			b.WriteString(nullType)
@@ -258,6 +321,39 @@ func (table *baseTable) RowBuffer() *bytes.Buffer {
 	return &b
 }
 
+// writeMasked writes the masked value of a column. NULL stays NULL, and everything else is
+// masked as a string, which the server converts to the type of the column.
+func writeMasked(b *bytes.Buffer, masker mask.Masker, value interface{}) {
+	var (
+		v     string
+		valid bool
+	)
+	switch s := value.(type) {
+	case *sql.NullString:
+		v, valid = s.String, s.Valid
+	case *sql.NullInt64:
+		v, valid = strconv.FormatInt(s.Int64, 10), s.Valid
+	case *sql.NullFloat64:
+		v, valid = strconv.FormatFloat(s.Float64, 'f', -1, 64), s.Valid
+	case *sql.RawBytes:
+		v, valid = string(*s), len(*s) != 0
+	case *NullDate:
+		v, valid = s.Date.Format("2006-01-02"), s.Valid
+	case *sql.NullTime:
+		v, valid = s.Time.Format("2006-01-02 15:04:05"), s.Valid
+	case nil:
+	default:
+		v, valid = fmt.Sprintf("%s", value), true
+	}
+	if valid {
+		if masked, ok := masker.Mask(v); ok {
+			fmt.Fprintf(b, "'%s'", sanitize(masked))
+			return
+		}
+	}
+	b.WriteString(nullType)
+}
+
 func (table *baseTable) Stream() <-chan string {
 	valueOut := make(chan string, 1)
 	go func() {
@@ -333,7 +429,7 @@ func reflectColumnType(tp *sql.ColumnType) reflect.Type {
 }
 
 // Takes a Table, but is a baseTable
-const tableTmpl = `
+const tableTmpl = `{{ if .WithCreateInfo }}
 --
 -- Table structure for table {{ esc .Name }}
 --
@@ -343,7 +439,7 @@ DROP TABLE IF EXISTS {{ esc .Name }};
 /*!50503 SET character_set_client = utf8mb4 */;
 {{ index .CreateSQL 0 }};
 /*!40101 SET character_set_client = @saved_cs_client */;
-
+{{ end }}{{ if .WithData }}
 --
 -- Dumping data for table {{ esc .Name }}
 --
@@ -355,12 +451,12 @@ LOCK TABLES {{ esc .Name }} WRITE;
 {{ end -}}
 /*!40000 ALTER TABLE {{ esc .Name }} ENABLE KEYS */;
 UNLOCK TABLES;
-`
+{{ end }}`
 
-const tableTmplCompact = `
+const tableTmplCompact = `{{ if .WithCreateInfo }}
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!50503 SET character_set_client = utf8mb4 */;
 {{ index .CreateSQL 0 }};
 /*!40101 SET character_set_client = @saved_cs_client */;
-{{ range $value := .Stream }}{{- $value }}{{ end -}}
+{{ end }}{{ if .WithData }}{{ range $value := .Stream }}{{- $value }}{{ end }}{{ end -}}
 `
@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/mask"
+)
+
+func TestTableMasks(t *testing.T) {
+	salt := []byte("salt")
+	newMasker := func(rule mask.Rule) mask.Masker {
+		m, err := mask.New(rule, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	fixed := newMasker(mask.Rule{Type: mask.Fixed, Value: "x'y"})
+	null := newMasker(mask.Rule{Type: mask.Null})
+	digits := newMasker(mask.Rule{Type: mask.Digits})
+	hash := newMasker(mask.Rule{Type: mask.Hash, Length: 8})
+	hashed, _ := hash.Mask("alice")
+	digitsMasked, _ := digits.Mask("42")
+
+	tests := []struct {
+		name     string
+		masks    map[string]map[string]mask.Masker
+		values   []interface{}
+		expected string
+		wantErr  bool
+	}{
+		{"no masks", nil, []interface{}{
+			&sql.NullInt64{Int64: 1, Valid: true}, &sql.NullString{String: "alice", Valid: true}, &sql.NullString{String: "secret", Valid: true}, &sql.NullInt64{Int64: 42, Valid: true},
+		}, "(1,'alice','secret',42)", false},
+		{"masked columns", map[string]map[string]mask.Masker{"customers": {"name": hash, "NOTES": fixed, "age": digits}}, []interface{}{
+			&sql.NullInt64{Int64: 1, Valid: true}, &sql.NullString{String: "alice", Valid: true}, &sql.NullString{String: "secret", Valid: true}, &sql.NullInt64{Int64: 42, Valid: true},
+		}, "(1,'" + hashed + "','x\\'y','" + digitsMasked + "')", false},
+		{"null stays null", map[string]map[string]mask.Masker{"customers": {"name": hash, "notes": fixed}}, []interface{}{
+			&sql.NullInt64{Int64: 1, Valid: true}, &sql.NullString{}, &sql.NullString{}, &sql.NullInt64{Int64: 42, Valid: true},
+		}, "(1,NULL,NULL,42)", false},
+		{"null mask", map[string]map[string]mask.Masker{"customers": {"notes": null}}, []interface{}{
+			&sql.NullInt64{Int64: 1, Valid: true}, &sql.NullString{String: "alice", Valid: true}, &sql.NullString{String: "secret", Valid: true}, &sql.NullInt64{Int64: 42, Valid: true},
+		}, "(1,'alice',NULL,42)", false},
+		{"other table", map[string]map[string]mask.Masker{"orders": {"notes": fixed}}, []interface{}{
+			&sql.NullInt64{Int64: 1, Valid: true}, &sql.NullString{String: "alice", Valid: true}, &sql.NullString{String: "secret", Valid: true}, &sql.NullInt64{Int64: 42, Valid: true},
+		}, "(1,'alice','secret',42)", false},
+		{"missing column", map[string]map[string]mask.Masker{"customers": {"email": fixed}}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &baseTable{
+				name: "customers",
+				cols: []string{"id", "name", "notes", "age"},
+				data: &Data{Masks: tt.masks},
+			}
+			err := table.initMasks()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err != nil:
+				return
+			}
+			table.values = tt.values
+			if got := table.RowValues(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteMasked(t *testing.T) {
+	fixed, err := mask.New(mask.Rule{Type: mask.Fixed, Value: "masked"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := sql.RawBytes("bytes")
+	emptyRaw := sql.RawBytes{}
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"string", &sql.NullString{String: "a", Valid: true}, "'masked'"},
+		{"null string", &sql.NullString{}, "NULL"},
+		{"int", &sql.NullInt64{Int64: 1, Valid: true}, "'masked'"},
+		{"null int", &sql.NullInt64{}, "NULL"},
+		{"float", &sql.NullFloat64{Float64: 1.5, Valid: true}, "'masked'"},
+		{"bytes", &raw, "'masked'"},
+		{"empty bytes", &emptyRaw, "NULL"},
+		{"date", &NullDate{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Valid: true}, "'masked'"},
+		{"time", &sql.NullTime{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true}, "'masked'"},
+		{"null time", &sql.NullTime{}, "NULL"},
+		{"nil", nil, "NULL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeMasked(&b, fixed, tt.value)
+			if b.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+)
+
+type trigger struct {
+	storedObject
+	table string
+}
+
+var (
+	triggerFullTemplate = parseStoredObjectTemplate("mysqldumpTrigger", `
+--
+-- Trigger {{ esc .Name }} on table {{ esc .Table }}
+--
+
+/*!50032 DROP TRIGGER IF EXISTS {{ esc .Name }} */;`)
+	triggerCompactTemplate = parseStoredObjectTemplate("mysqldumpTriggerCompact", `
+/*!50032 DROP TRIGGER IF EXISTS {{ esc .Name }} */;`)
+)
+
+// Init retrieves the trigger definition, along with the sql_mode and character set
+// that were in effect when it was created, so that it can be recreated identically.
+func (t *trigger) Init() error {
+	row, err := t.data.showCreate("SHOW CREATE TRIGGER " + esc(t.Name()))
+	if err != nil {
+		return fmt.Errorf("failed to get definition for trigger %s: %w", t.name, err)
+	}
+	if row["Trigger"].String != t.name {
+		return fmt.Errorf("returned trigger %s is not the same as requested trigger %s", row["Trigger"].String, t.name)
+	}
+	return t.initDefinition(row, "trigger", "SQL Original Statement")
+}
+
+func (t *trigger) Execute(out io.Writer, compact bool) error {
+	tmpl := triggerFullTemplate
+	if compact {
+		tmpl = triggerCompactTemplate
+	}
+	return tmpl.Execute(out, t)
+}
+
+// Table the table on which the trigger is defined
+func (t *trigger) Table() string {
+	return t.table
+}
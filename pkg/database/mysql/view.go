@@ -15,7 +15,7 @@ type view struct {
 	collation string
 }
 
-var viewFullTemplate, viewCompactTemplate *template.Template
+var viewFullTemplate, viewCompactTemplate, viewFinalFullTemplate, viewFinalCompactTemplate *template.Template
 
 func init() {
 	tmpl, err := template.New("mysqldumpView").Funcs(template.FuncMap{
@@ -35,6 +35,24 @@ func init() {
 		panic(fmt.Errorf("could not parse view compact template: %w", err))
 	}
 	viewCompactTemplate = tmpl
+
+	tmpl, err = template.New("mysqldumpViewFinal").Funcs(template.FuncMap{
+		"sub": sub,
+		"esc": esc,
+	}).Parse(viewFinalTmpl)
+	if err != nil {
+		panic(fmt.Errorf("could not parse view final template: %w", err))
+	}
+	viewFinalFullTemplate = tmpl
+
+	tmpl, err = template.New("mysqldumpViewFinalCompact").Funcs(template.FuncMap{
+		"sub": sub,
+		"esc": esc,
+	}).Parse(viewFinalTmplCompact)
+	if err != nil {
+		panic(fmt.Errorf("could not parse view final compact template: %w", err))
+	}
+	viewFinalCompactTemplate = tmpl
 }
 
 func (v *view) CreateSQL() ([]string, error) {
@@ -92,6 +110,8 @@ func (v *view) Init() error {
 	return nil
 }
 
+// Execute writes a temporary view with the same columns as the view, which stands in for it
+// until every table and view has been created, so that views may depend on one another in any order
 func (v *view) Execute(out io.Writer, compact bool) error {
 	tmpl := viewFullTemplate
 	if compact {
@@ -100,6 +120,15 @@ func (v *view) Execute(out io.Writer, compact bool) error {
 	return tmpl.Execute(out, v)
 }
 
+// ExecuteFinal writes the actual view, replacing the temporary one written by Execute
+func (v *view) ExecuteFinal(out io.Writer, compact bool) error {
+	tmpl := viewFinalFullTemplate
+	if compact {
+		tmpl = viewFinalCompactTemplate
+	}
+	return tmpl.Execute(out, v)
+}
+
 func (v *view) Charset() string {
 	return v.charset
 }
@@ -121,7 +150,10 @@ SET @saved_cs_client     = @@character_set_client;
 /*!50001 CREATE VIEW {{ esc .Name }} AS SELECT 
 {{ $columns := .Columns }}{{ range $index, $column := .Columns }} 1 AS {{ esc $column }}{{ if ne $index (sub (len $columns) 1) }},{{ printf "%c" 10 }}{{ else }}*/;{{ end }}{{ end }}
 SET character_set_client = @saved_cs_client;
+`
 
+// takes a Table, but is a view
+const viewFinalTmpl = `
 --
 -- Current Database: {{ esc .Database }}
 --
@@ -152,7 +184,8 @@ SET @saved_cs_client     = @@character_set_client;
 /*!50001 CREATE VIEW {{ esc .Name }} AS SELECT 
 {{ $columns := .Columns }}{{ range $index, $column := .Columns }} 1 AS {{ esc $column }}{{ if ne $index (sub (len $columns) 1) }},{{ printf "%c" 10 }}{{ else }}*/;{{ end }}{{ end }}
 SET character_set_client = @saved_cs_client;
-
+`
+const viewFinalTmplCompact = `
 USE {{ esc .Database }};
 /*!50001 DROP VIEW IF EXISTS {{ esc .Name }}*/;
 /*!50001 SET @saved_cs_client          = @@character_set_client */;
@@ -1,20 +1,49 @@
 package database
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
+	"sync"
+
+	mysql "github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/statement"
 )
 
 var (
-	useRegex    = regexp.MustCompile(`(?i)^(USE\s*` + "`" + `)([^\s]+)(` + "`" + `\s*;)$`)
-	createRegex = regexp.MustCompile(`(?i)^(CREATE\s+DATABASE\s*(\/\*.*\*\/\s*)?` + "`" + `)([^\s]+)(` + "`" + `\s*(\s*\/\*.*\*\/\s*)?\s*;$)`)
+	useRegex    = regexp.MustCompile(`(?i)^(USE\s*` + "`" + `)([^\s]+)(` + "`" + `\s*)$`)
+	createRegex = regexp.MustCompile(`(?i)^(CREATE\s+DATABASE\s*(\/\*.*\*\/\s*)?` + "`" + `)([^\s]+)(` + "`" + `\s*(\s*\/\*.*\*\/\s*)?\s*$)`)
 )
 
-func Restore(dbconn Connection, databasesMap map[string]string, readers []io.ReadSeeker) error {
+// server errors that mean a statement refers to an object that does not exist yet, and
+// so may succeed once another file in the same group has been restored
+var missingObjectErrors = map[uint16]bool{
+	1049: true, // ER_BAD_DB_ERROR
+	1146: true, // ER_NO_SUCH_TABLE
+	1305: true, // ER_SP_DOES_NOT_EXIST
+	1356: true, // ER_VIEW_INVALID
+}
+
+type RestoreOpts struct {
+	// Parallelism how many files to restore at once, each on its own connection
+	Parallelism int
+	// Filter selects the schemas and tables to restore; statements for others are skipped
+	Filter RestoreFilter
+	// NoEvents skips the statements that create and drop scheduled events, which otherwise run
+	// on the server once restored, even where they were not meant to, such as in scratch schemas
+	NoEvents bool
+}
+
+// Restore restores each group of readers in turn. The readers within a group must not depend
+// on one another, as with a Parallelism greater than 1 they are restored concurrently. In that
+// case, a reader that fails because it refers to an object that does not yet exist, such as a
+// view on a table in another schema, is retried once the rest of its group has been restored.
+func Restore(dbconn Connection, databasesMap map[string]string, opts RestoreOpts, groups [][]io.ReadSeeker) error {
 	db, err := sql.Open("mysql", dbconn.MySQL())
 	if err != nil {
 		return fmt.Errorf("failed to open connection to database: %v", err)
@@ -23,46 +52,163 @@ func Restore(dbconn Connection, databasesMap map[string]string, readers []io.Rea
 
 	// load data into database by reading from each reader
 	ctx := context.Background()
-	for _, r := range readers {
-		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	for _, readers := range groups {
+		if opts.Parallelism <= 1 {
+			for _, r := range readers {
+				if err := restoreReader(ctx, db, databasesMap, opts, r); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := restoreParallel(ctx, db, databasesMap, opts, readers); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreStream restores each reader returned by next in turn, until it returns io.EOF. Each
+// reader is consumed completely before next is called again, so they may all be read from a
+// single stream, without being stored anywhere first. The Parallelism of opts is ignored.
+func RestoreStream(dbconn Connection, databasesMap map[string]string, opts RestoreOpts, next func() (io.Reader, error)) error {
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for {
+		r, err := next()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			return fmt.Errorf("failed to restore database: %w", err)
+			return fmt.Errorf("failed to read restore file: %w", err)
 		}
-		scanner := bufio.NewScanner(r)
-		var current string
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == "" {
-				continue
-			}
-			current += line + "\n"
-			if line[len(line)-1] != ';' {
-				continue
-			}
-			// if we have the line that sets the database, and we need to replace, replace it
-			if createRegex.MatchString(current) {
-				dbName := createRegex.FindStringSubmatch(current)[3]
-				if newName, ok := databasesMap[dbName]; ok {
-					current = createRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${4}", newName))
+		if err := restoreReader(ctx, db, databasesMap, opts, r); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreParallel restores the readers concurrently, retrying any that failed on a missing
+// object for as long as each round restores at least one more of them
+func restoreParallel(ctx context.Context, db *sql.DB, databasesMap map[string]string, opts RestoreOpts, readers []io.ReadSeeker) error {
+	pending := readers
+	for len(pending) > 0 {
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			failed []io.ReadSeeker
+			errs   []error
+			queue  = make(chan io.ReadSeeker)
+		)
+		for i := 0; i < opts.Parallelism && i < len(pending); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for r := range queue {
+					err := restoreReader(ctx, db, databasesMap, opts, r)
+					if err == nil {
+						continue
+					}
+					mu.Lock()
+					if isMissingObject(err) {
+						failed = append(failed, r)
+					}
+					errs = append(errs, err)
+					mu.Unlock()
 				}
+			}()
+		}
+		for _, r := range pending {
+			queue <- r
+		}
+		close(queue)
+		wg.Wait()
+
+		switch {
+		case len(errs) == 0:
+			return nil
+		case len(failed) < len(errs), len(failed) == len(pending):
+			// either something failed that a retry cannot fix, or nothing more was restored
+			return errors.Join(errs...)
+		}
+		log.Debugf("retrying %d restore files that refer to objects not yet restored", len(failed))
+		for _, r := range failed {
+			if _, err := r.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to rewind restore file: %w", err)
 			}
-			if useRegex.MatchString(current) {
-				dbName := useRegex.FindStringSubmatch(current)[2]
-				if newName, ok := databasesMap[dbName]; ok {
-					current = useRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${3}", newName))
-				}
+		}
+		pending = failed
+	}
+	return nil
+}
+
+// restoreReader restores a single reader, in a single transaction, on a connection of its own
+// with foreign key checks disabled, as the tables it refers to may not have been restored yet.
+// Statements not selected by the filter of opts, and events if opts.NoEvents is set, are skipped.
+func restoreReader(ctx context.Context, db *sql.DB, databasesMap map[string]string, opts RestoreOpts, r io.Reader) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SET SESSION FOREIGN_KEY_CHECKS=0"); err != nil {
+		return fmt.Errorf("failed to disable foreign key checks: %w", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	// the schema, as named in the dump, in which statements are being run
+	var schema string
+	scanner := statement.NewScanner(r)
+	for scanner.Scan() {
+		current := scanner.Text()
+		stmtSchema := schema
+		// if we have the line that sets the database, and we need to replace, replace it
+		if createRegex.MatchString(current) {
+			dbName := createRegex.FindStringSubmatch(current)[3]
+			stmtSchema = dbName
+			if newName, ok := databasesMap[dbName]; ok {
+				current = createRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${4}", newName))
 			}
-			// we hit a break, so we have the entire transaction
-			if _, err := tx.Exec(current); err != nil {
-				_ = tx.Rollback()
-				return fmt.Errorf("failed to restore database: %w", err)
+		}
+		if useRegex.MatchString(current) {
+			dbName := useRegex.FindStringSubmatch(current)[2]
+			schema, stmtSchema = dbName, dbName
+			if newName, ok := databasesMap[dbName]; ok {
+				current = useRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${3}", newName))
 			}
-			current = ""
 		}
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to restore database: %w", err)
+		if !opts.Filter.statementIncluded(stmtSchema, current) || (opts.NoEvents && isEventStatement(current)) {
+			continue
+		}
+		// the position of the dump in the binary log is not that of the server when restoring into other databases
+		if len(databasesMap) > 0 && sourceDataRegex.MatchString(current) {
+			continue
+		}
+		if _, err := tx.Exec(current); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to restore database at line %d: %w", scanner.Line(), err)
 		}
 	}
-
+	if err := scanner.Err(); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("failed to read restore file: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
 	return nil
 }
+
+func isMissingObject(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && missingObjectErrors[mysqlErr.Number]
+}
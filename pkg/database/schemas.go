@@ -46,3 +46,18 @@ func GetSchemas(dbconn Connection) ([]string, error) {
 
 	return names, nil
 }
+
+// ServerVersion the version of the database server
+func ServerVersion(dbconn Connection) (string, error) {
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return "", fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRow("SELECT version()").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to get server version: %v", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,335 @@
+// Package statement splits a stream of MySQL/MariaDB SQL, as produced by a dump, into
+// individual statements, the way the mysql command-line client does.
+//
+// It understands single-quoted, double-quoted and backtick-quoted strings with their
+// escapes, `--`, `#` and `/* */` comments, conditional `/*!NNNNN ... */` comments and
+// optimizer hints, and the client-side `DELIMITER` command used around triggers and
+// stored routines. Statements are read from the stream one at a time, so there is no
+// limit on the length of a line or of a single statement.
+package statement
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultDelimiter the statement delimiter in effect until changed by a DELIMITER command
+const DefaultDelimiter = ";"
+
+const delimiterCommand = "delimiter"
+
+type state int
+
+const (
+	stateCode state = iota
+	stateSingleQuote
+	stateDoubleQuote
+	stateBacktick
+	stateLineComment
+	stateBlockComment
+)
+
+func (s state) String() string {
+	switch s {
+	case stateSingleQuote:
+		return "single-quoted string"
+	case stateDoubleQuote:
+		return "double-quoted string"
+	case stateBacktick:
+		return "quoted identifier"
+	case stateLineComment:
+		return "comment"
+	case stateBlockComment:
+		return "comment"
+	}
+	return "statement"
+}
+
+// Scanner reads SQL statements from a stream. Its interface follows that of bufio.Scanner:
+// call Scan until it returns false, reading each statement with Text, and then check Err.
+//
+// Statements are returned without their delimiter and with surrounding whitespace removed.
+// Comments preceding a statement, such as the section headers in a dump, are dropped;
+// comments within a statement are passed through to the server untouched, as are
+// conditional comments and optimizer hints. DELIMITER commands are processed by the
+// Scanner and never returned.
+type Scanner struct {
+	r         *bufio.Reader
+	delimiter string
+	buf       bytes.Buffer
+	text      string
+	err       error
+	line      int
+	stmtLine  int
+}
+
+// NewScanner returns a new Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{
+		r:         bufio.NewReader(r),
+		delimiter: DefaultDelimiter,
+		line:      1,
+	}
+}
+
+// Text returns the most recent statement read by Scan.
+func (s *Scanner) Text() string {
+	return s.text
+}
+
+// Err returns the first error encountered by the Scanner, other than io.EOF.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Delimiter returns the statement delimiter currently in effect.
+func (s *Scanner) Delimiter() string {
+	return s.delimiter
+}
+
+// Line returns the line of the input on which the most recent statement began.
+func (s *Scanner) Line() int {
+	return s.stmtLine
+}
+
+// Scan advances to the next statement, which then is available via Text. It returns
+// false when there are no more statements, either because the input is exhausted or
+// because of an error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	for {
+		text, err := s.next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.err = err
+			}
+			if text == "" {
+				s.text = ""
+				return false
+			}
+		}
+		// empty statements, e.g. `;;` or only comments, are skipped, as the mysql client does
+		if text == "" {
+			continue
+		}
+		s.text = text
+		return true
+	}
+}
+
+// next reads a single statement. It returns io.EOF, possibly together with a final
+// statement that had no delimiter, when the input is exhausted.
+func (s *Scanner) next() (string, error) {
+	var (
+		st      = stateCode
+		cond    bool // inside a conditional comment or optimizer hint
+		started bool // have we seen anything other than whitespace or comments
+		start   int  // line on which the unterminated quote or comment began
+	)
+	s.buf.Reset()
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return "", err
+			}
+			if (st != stateCode && st != stateLineComment) || cond {
+				if cond {
+					st = stateBlockComment
+				}
+				return "", fmt.Errorf("unterminated %s starting at line %d: %w", st, start, io.ErrUnexpectedEOF)
+			}
+			return strings.TrimSpace(s.buf.String()), io.EOF
+		}
+		if c == '\n' {
+			s.line++
+		}
+
+		switch st {
+		case stateLineComment:
+			// comments before the statement are dropped, those inside are kept
+			if started {
+				s.buf.WriteByte(c)
+			}
+			if c == '\n' {
+				st = stateCode
+			}
+			continue
+		case stateBlockComment:
+			if c == '*' && s.peekIs("/") {
+				_, _ = s.r.ReadByte()
+				if started {
+					s.buf.WriteString("*/")
+				}
+				st = stateCode
+				continue
+			}
+			if started {
+				s.buf.WriteByte(c)
+			}
+			continue
+		case stateSingleQuote, stateDoubleQuote, stateBacktick:
+			s.buf.WriteByte(c)
+			switch {
+			case c == '\\' && st != stateBacktick:
+				// the escaped character cannot end the string
+				next, err := s.r.ReadByte()
+				if err != nil {
+					if errors.Is(err, io.EOF) {
+						return "", fmt.Errorf("unterminated %s starting at line %d: %w", st, start, io.ErrUnexpectedEOF)
+					}
+					return "", err
+				}
+				if next == '\n' {
+					s.line++
+				}
+				s.buf.WriteByte(next)
+			case c == '\'' && st == stateSingleQuote, c == '"' && st == stateDoubleQuote, c == '`' && st == stateBacktick:
+				st = stateCode
+			}
+			continue
+		}
+
+		// we are in code
+		if !started {
+			if isSpace(c) {
+				continue
+			}
+			if (c == 'd' || c == 'D') && s.isDelimiterCommand() {
+				if err := s.readDelimiterCommand(); err != nil {
+					return "", err
+				}
+				return "", nil
+			}
+		}
+		if !cond && s.isDelimiter(c) {
+			// consume the rest of the delimiter
+			if _, err := s.r.Discard(len(s.delimiter) - 1); err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(s.buf.String()), nil
+		}
+		switch c {
+		case '\'':
+			st, start = stateSingleQuote, s.line
+		case '"':
+			st, start = stateDoubleQuote, s.line
+		case '`':
+			st, start = stateBacktick, s.line
+		case '#':
+			if !cond {
+				st = stateLineComment
+				if started {
+					s.buf.WriteByte(c)
+				}
+				continue
+			}
+		case '-':
+			if !cond && s.isDashComment() {
+				_, _ = s.r.ReadByte()
+				st = stateLineComment
+				if started {
+					s.buf.WriteString("--")
+				}
+				continue
+			}
+		case '/':
+			if s.peekIs("*") {
+				_, _ = s.r.ReadByte()
+				switch {
+				case cond:
+					// comments do not nest, so this is just text
+					s.buf.WriteString("/*")
+				case s.peekIs("!"), s.peekIs("+"):
+					cond, start = true, s.line
+					s.buf.WriteString("/*")
+					if !started {
+						started, s.stmtLine = true, s.line
+					}
+				default:
+					st, start = stateBlockComment, s.line
+					if started {
+						s.buf.WriteString("/*")
+					}
+				}
+				continue
+			}
+		case '*':
+			if cond && s.peekIs("/") {
+				_, _ = s.r.ReadByte()
+				s.buf.WriteString("*/")
+				cond = false
+				continue
+			}
+		}
+		if !started && !isSpace(c) {
+			started, s.stmtLine = true, s.line
+		}
+		s.buf.WriteByte(c)
+	}
+}
+
+// isDelimiter reports whether c, together with the bytes following it, is the current delimiter
+func (s *Scanner) isDelimiter(c byte) bool {
+	if c != s.delimiter[0] {
+		return false
+	}
+	if len(s.delimiter) == 1 {
+		return true
+	}
+	return s.peekIs(s.delimiter[1:])
+}
+
+// isDashComment reports whether the `-` just read starts a `-- ` comment. MySQL requires the
+// second dash to be followed by whitespace or a control character.
+func (s *Scanner) isDashComment() bool {
+	b, _ := s.r.Peek(2)
+	return len(b) == 2 && b[0] == '-' && b[1] <= ' '
+}
+
+// isDelimiterCommand reports whether the `d` just read starts a DELIMITER command
+func (s *Scanner) isDelimiterCommand() bool {
+	rest := len(delimiterCommand) - 1
+	b, _ := s.r.Peek(rest + 1)
+	if len(b) < rest+1 {
+		return false
+	}
+	return strings.EqualFold(string(b[:rest]), delimiterCommand[1:]) && (b[rest] == ' ' || b[rest] == '\t')
+}
+
+// readDelimiterCommand reads the remainder of a DELIMITER command line, and sets the new delimiter
+func (s *Scanner) readDelimiterCommand() error {
+	line, err := s.r.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if strings.HasSuffix(line, "\n") {
+		s.line++
+	}
+	fields := strings.Fields(line[len(delimiterCommand)-1:])
+	if len(fields) == 0 {
+		return fmt.Errorf("DELIMITER must be followed by a delimiter at line %d", s.line)
+	}
+	delimiter := fields[0]
+	if strings.ContainsAny(delimiter, "\\'\"`") {
+		return fmt.Errorf("invalid delimiter %q at line %d", delimiter, s.line)
+	}
+	s.delimiter = delimiter
+	return nil
+}
+
+// peekIs reports whether the next bytes in the input are exactly match, without consuming them
+func (s *Scanner) peekIs(match string) bool {
+	b, _ := s.r.Peek(len(match))
+	return string(b) == match
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,133 @@
+package statement
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   error
+	}{
+		{"empty", "", nil, nil},
+		{"single", "SELECT 1;", []string{"SELECT 1"}, nil},
+		{"multiple on one line", "SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}, nil},
+		{"multiple lines", "SELECT\n1\n;\nSELECT 2;\n", []string{"SELECT\n1", "SELECT 2"}, nil},
+		{"missing final delimiter", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}, nil},
+		{"empty statements", ";;SELECT 1;;;", []string{"SELECT 1"}, nil},
+		{"semicolon in single quotes", "INSERT INTO t VALUES ('a;\nb');", []string{"INSERT INTO t VALUES ('a;\nb')"}, nil},
+		{"semicolon in double quotes", `INSERT INTO t VALUES ("a;b");`, []string{`INSERT INTO t VALUES ("a;b")`}, nil},
+		{"semicolon in backticks", "SELECT `a;b` FROM t;", []string{"SELECT `a;b` FROM t"}, nil},
+		{"escaped quote", `INSERT INTO t VALUES ('it\'s;', "say \"hi;\"");`, []string{`INSERT INTO t VALUES ('it\'s;', "say \"hi;\"")`}, nil},
+		{"doubled quote", "INSERT INTO t VALUES ('it''s;');", []string{"INSERT INTO t VALUES ('it''s;')"}, nil},
+		{"escaped backslash", `INSERT INTO t VALUES ('a\\');SELECT 2;`, []string{`INSERT INTO t VALUES ('a\\')`, "SELECT 2"}, nil},
+		{"backslash in backticks", "SELECT `a\\`;", []string{"SELECT `a\\`"}, nil},
+		{"dash comment", "-- Table structure;\nDROP TABLE t; -- trailing;\n", []string{"DROP TABLE t"}, nil},
+		{"dash comment in statement", "SELECT 1 -- one; two\n, 2;", []string{"SELECT 1 -- one; two\n, 2"}, nil},
+		{"double dash without space", "SELECT 1--1;", []string{"SELECT 1--1"}, nil},
+		{"dash comment at end of input", "SELECT 1;-- \n", []string{"SELECT 1"}, nil},
+		{"hash comment", "# comment;\nSELECT 1;", []string{"SELECT 1"}, nil},
+		{"hash comment in statement", "SELECT 1 # one;\n;", []string{"SELECT 1 # one;"}, nil},
+		{"block comment", "/* a; b */ SELECT /* c; */ 1;", []string{"SELECT /* c; */ 1"}, nil},
+		{"multi-line block comment", "/*\n * a;\n */\nSELECT 1;", []string{"SELECT 1"}, nil},
+		{"conditional comment", "/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;", []string{"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */"}, nil},
+		{"conditional comment with delimiter", "/*!50003 CREATE TRIGGER x BEFORE INSERT ON t FOR EACH ROW BEGIN SET @a=1; END */;", []string{"/*!50003 CREATE TRIGGER x BEFORE INSERT ON t FOR EACH ROW BEGIN SET @a=1; END */"}, nil},
+		{"conditional comment with quoted end", "/*!50001 SELECT '*/;' */;", []string{"/*!50001 SELECT '*/;' */"}, nil},
+		{"optimizer hint", "SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1;", []string{"SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1"}, nil},
+		{"delimiter", "DELIMITER ;;\nCREATE TRIGGER x BEFORE INSERT ON t FOR EACH ROW BEGIN SET @a=1; SET @b=2; END ;;\nDELIMITER ;\nSELECT 1;", []string{"CREATE TRIGGER x BEFORE INSERT ON t FOR EACH ROW BEGIN SET @a=1; SET @b=2; END", "SELECT 1"}, nil},
+		{"delimiter lowercase", "delimiter $$\nSELECT 1; SELECT 2$$\ndelimiter ;\n", []string{"SELECT 1; SELECT 2"}, nil},
+		{"delimiter after comment", "-- routines\nDELIMITER //\nSELECT 1//", []string{"SELECT 1"}, nil},
+		{"delimiter as identifier", "SELECT delimiter FROM t;", []string{"SELECT delimiter FROM t"}, nil},
+		{"delimiter prefix", "delimiters;", []string{"delimiters"}, nil},
+		{"delimiter missing argument", "DELIMITER \nSELECT 1;", nil, errors.New("DELIMITER must be followed by a delimiter at line 2")},
+		{"unterminated single quote", "SELECT 'abc;", nil, io.ErrUnexpectedEOF},
+		{"unterminated backtick", "SELECT 1;\nSELECT `abc;", []string{"SELECT 1"}, io.ErrUnexpectedEOF},
+		{"unterminated comment", "SELECT 1 /* abc;", nil, io.ErrUnexpectedEOF},
+		{"unterminated conditional comment", "/*!40101 SET a=1;", nil, io.ErrUnexpectedEOF},
+		{"carriage returns", "SELECT 1;\r\nSELECT 2;\r\n", []string{"SELECT 1", "SELECT 2"}, nil},
+		{"long line", "INSERT INTO t VALUES ('" + strings.Repeat("x", 200000) + "');", []string{"INSERT INTO t VALUES ('" + strings.Repeat("x", 200000) + "')"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScanner(strings.NewReader(tt.input))
+			var got []string
+			for s.Scan() {
+				got = append(got, s.Text())
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Errorf("statements mismatch: %v", diff)
+			}
+			err := s.Err()
+			switch {
+			case err == nil && tt.err == nil:
+			case err == nil || tt.err == nil:
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			case !errors.Is(err, tt.err) && err.Error() != tt.err.Error():
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestScannerLine(t *testing.T) {
+	input := "-- header\n\nSELECT 1;\nSELECT\n'a\nb';\n\n/*!40101 SET a=1 */;"
+	s := NewScanner(strings.NewReader(input))
+	var lines []int
+	for s.Scan() {
+		lines = append(lines, s.Line())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(lines, []int{3, 4, 8}); diff != nil {
+		t.Errorf("lines mismatch: %v", diff)
+	}
+}
+
+// FuzzScanner checks that the scanner never panics, and that every statement it returns is
+// stable: scanning it again, with the delimiter that was in effect, yields exactly itself.
+func FuzzScanner(f *testing.F) {
+	seeds := []string{
+		"SELECT 1;",
+		"INSERT INTO t VALUES ('a;b', \"c\\\"d\", `e``f`);",
+		"-- comment\n# comment\n/* comment */SELECT 1;",
+		"/*!40101 SET NAMES utf8 */;\n/*!50003 CREATE*/ /*!50003 TRIGGER x */;;",
+		"DELIMITER ;;\nCREATE PROCEDURE p() BEGIN SELECT 1; END ;;\nDELIMITER ;\n",
+		"SELECT 'unterminated",
+		"SELECT 1--1; SELECT 2 -- x\n;",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		s := NewScanner(strings.NewReader(input))
+		for s.Scan() {
+			text := s.Text()
+			if text == "" {
+				t.Fatalf("empty statement from %q", input)
+			}
+			if text != strings.TrimSpace(text) {
+				t.Fatalf("untrimmed statement %q from %q", text, input)
+			}
+			again := NewScanner(strings.NewReader(text))
+			again.delimiter = s.Delimiter()
+			var got []string
+			for again.Scan() {
+				got = append(got, again.Text())
+			}
+			if again.Err() != nil {
+				t.Fatalf("rescanning %q from %q failed: %v", text, input, again.Err())
+			}
+			if len(got) != 1 || got[0] != text {
+				t.Fatalf("rescanning %q from %q gave %q", text, input, got)
+			}
+		}
+	})
+}
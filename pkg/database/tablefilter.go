@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// TableFilter selects the tables to dump by patterns of their names, as schema.table. A
+// pattern is either a glob, e.g. `logs.*` or `*.sessions`, or a regular expression between
+// slashes, e.g. `/^app\.(log|session)_\d+$/`, which matches anywhere in the name unless
+// anchored. A table is dumped if it matches any of the include patterns, or there are none,
+// and none of the exclude patterns.
+type TableFilter struct {
+	include []tablePattern
+	exclude []tablePattern
+}
+
+type tablePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// NewTableFilter creates a TableFilter from the include and exclude patterns
+func NewTableFilter(include, exclude []string) (*TableFilter, error) {
+	var (
+		f   TableFilter
+		err error
+	)
+	if f.include, err = parseTablePatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = parseTablePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Included whether the table in the schema is selected by the filter. A nil filter selects everything.
+func (f *TableFilter) Included(schema, table string) bool {
+	if f == nil {
+		return true
+	}
+	name := schema + "." + table
+	if matchAny(f.exclude, name) {
+		return false
+	}
+	return len(f.include) == 0 || matchAny(f.include, name)
+}
+
+func parseTablePatterns(patterns []string) ([]tablePattern, error) {
+	parsed := make([]tablePattern, 0, len(patterns))
+	for _, p := range patterns {
+		if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid table pattern %s: %v", p, err)
+			}
+			parsed = append(parsed, tablePattern{re: re})
+			continue
+		}
+		if !strings.Contains(p, ".") {
+			return nil, fmt.Errorf("invalid table pattern %s, must be schema.table", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid table pattern %s: %v", p, err)
+		}
+		parsed = append(parsed, tablePattern{glob: p})
+	}
+	return parsed, nil
+}
+
+func matchAny(patterns []tablePattern, name string) bool {
+	for _, p := range patterns {
+		if p.re != nil {
+			if p.re.MatchString(name) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p.glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestTableFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		schema   string
+		table    string
+		expected bool
+	}{
+		{"no patterns", nil, nil, "shop", "orders", true},
+		{"included glob", []string{"shop.*"}, nil, "shop", "orders", true},
+		{"not included", []string{"shop.*"}, nil, "crm", "customers", false},
+		{"excluded glob", nil, []string{"*.sessions"}, "crm", "sessions", false},
+		{"not excluded", nil, []string{"*.sessions"}, "crm", "session_types", true},
+		{"exclude over include", []string{"shop.*"}, []string{"shop.audit"}, "shop", "audit", false},
+		{"excluded regex", nil, []string{`/^shop\.log_\d+$/`}, "shop", "log_2024", false},
+		{"regex not matched", nil, []string{`/^shop\.log_\d+$/`}, "shop", "log_archive", true},
+		{"unanchored regex", []string{"/order/"}, nil, "shop", "orders_2024", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewTableFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Included(tt.schema, tt.table); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewTableFilterInvalid(t *testing.T) {
+	for _, pattern := range []string{"sessions", "shop.[", "/shop.(/"} {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := NewTableFilter(nil, []string{pattern}); err == nil {
+				t.Error("missing error")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/database/statement"
+)
+
+var insertRegex = regexp.MustCompile(`(?i)^\s*(INSERT|REPLACE)\s`)
+
+// StatementCounts the statements in a dump, and the rows they insert
+type StatementCounts struct {
+	Statements int
+	Rows       int64
+}
+
+// CountStatements parses each statement read from r, as restore would, without running it,
+// and counts the statements and the rows they insert in each schema. Statements are in the
+// schema schema until a `USE <database>` statement changes it.
+func CountStatements(r io.Reader, schema string) (map[string]StatementCounts, error) {
+	counts := map[string]StatementCounts{}
+	scanner := statement.NewScanner(r)
+	for scanner.Scan() {
+		current := scanner.Text()
+		if useRegex.MatchString(current) {
+			schema = useRegex.FindStringSubmatch(current)[2]
+		}
+		c := counts[schema]
+		c.Statements++
+		c.Rows += insertRows(current)
+		counts[schema] = c
+	}
+	if err := scanner.Err(); err != nil {
+		return counts, fmt.Errorf("failed to parse: %w", err)
+	}
+	return counts, nil
+}
+
+// insertRows the number of rows inserted by an INSERT or REPLACE statement, i.e. the number of
+// tuples after its VALUES. Other statements insert none.
+func insertRows(stmt string) int64 {
+	if !insertRegex.MatchString(stmt) {
+		return 0
+	}
+	var (
+		rows   int64
+		depth  int
+		quote  byte
+		values bool
+	)
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case quote != 0:
+			switch {
+			case c == '\\' && quote != '`':
+				i++
+			case c == quote:
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			if depth == 0 && values {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && !values && (c == 'V' || c == 'v'):
+			values = strings.EqualFold(stmt[i:min(i+6, len(stmt))], "VALUES") && (i == 0 || isSpace(stmt[i-1]) || stmt[i-1] == ')')
+		}
+	}
+	return rows
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
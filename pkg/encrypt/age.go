@@ -0,0 +1,58 @@
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+type AgeEncryptor struct {
+	recipients []age.Recipient
+}
+
+// NewAgeEncryptor create an encryptor to the recipients listed in key, one per line
+func NewAgeEncryptor(key []byte) (*AgeEncryptor, error) {
+	recipients, err := age.ParseRecipients(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipients: %w", err)
+	}
+	return &AgeEncryptor{recipients: recipients}, nil
+}
+
+func (a *AgeEncryptor) Encrypt(out io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(out, a.recipients...)
+}
+func (a *AgeEncryptor) Extension() string {
+	return "age"
+}
+func (a *AgeEncryptor) Type() string {
+	return Age
+}
+func (a *AgeEncryptor) Recipients() []string {
+	recipients := make([]string, 0, len(a.recipients))
+	for _, r := range a.recipients {
+		if s, ok := r.(fmt.Stringer); ok {
+			recipients = append(recipients, s.String())
+		}
+	}
+	return recipients
+}
+
+type AgeDecryptor struct {
+	identities []age.Identity
+}
+
+// NewAgeDecryptor create a decryptor with the identities listed in key, one per line
+func NewAgeDecryptor(key []byte) (*AgeDecryptor, error) {
+	identities, err := age.ParseIdentities(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age identities: %w", err)
+	}
+	return &AgeDecryptor{identities: identities}, nil
+}
+
+func (a *AgeDecryptor) Decrypt(in io.Reader) (io.Reader, error) {
+	return age.Decrypt(in, a.identities...)
+}
@@ -0,0 +1,102 @@
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	// Age encryption with age, https://age-encryption.org
+	Age = "age"
+	// PGP encryption with OpenPGP, as by gpg
+	PGP = "pgp"
+)
+
+// ageMagic the line with which every age encrypted file begins
+const ageMagic = "age-encryption.org/v1\n"
+
+// Encryptor encrypts a backup as it is written
+type Encryptor interface {
+	// Encrypt returns a writer that encrypts everything written to it to out. Closing it
+	// completes the encryption, but does not close out.
+	Encrypt(out io.Writer) (io.WriteCloser, error)
+	// Extension the extension added to the name of an encrypted file, without the leading dot
+	Extension() string
+	// Type the type of encryption, as given to GetEncryptor
+	Type() string
+	// Recipients who can decrypt: age recipients, or OpenPGP key fingerprints
+	Recipients() []string
+}
+
+// Decryptor decrypts a backup as it is read
+type Decryptor interface {
+	Decrypt(in io.Reader) (io.Reader, error)
+}
+
+// GetEncryptor get the encryptor of the named type, which encrypts to the recipients in key:
+// for age, a recipients file, with one recipient per line; for pgp, one or more public
+// keys, armored or binary.
+func GetEncryptor(name string, key []byte) (Encryptor, error) {
+	switch name {
+	case Age:
+		return NewAgeEncryptor(key)
+	case PGP:
+		return NewPGPEncryptor(key)
+	default:
+		return nil, fmt.Errorf("unknown encryption type: %s", name)
+	}
+}
+
+// GetDecryptor get the decryptor of the named type, which decrypts with the identities in key:
+// for age, an identities file, with one identity per line; for pgp, one or more private keys,
+// armored or binary, which must not be protected by a passphrase. If name is empty, the type
+// is determined from the key.
+func GetDecryptor(name string, key []byte) (Decryptor, error) {
+	switch name {
+	case Age:
+		return NewAgeDecryptor(key)
+	case PGP:
+		return NewPGPDecryptor(key)
+	case "":
+		if d, err := NewAgeDecryptor(key); err == nil {
+			return d, nil
+		}
+		if d, err := NewPGPDecryptor(key); err == nil {
+			return d, nil
+		}
+		return nil, fmt.Errorf("key is neither age identities nor an OpenPGP private key")
+	default:
+		return nil, fmt.Errorf("unknown encryption type: %s", name)
+	}
+}
+
+// Detect get the type of encryption of a file from the bytes with which it begins, or an
+// empty string if it does not appear to be encrypted. As an OpenPGP message is recognised
+// by its first byte alone, only check for encryption after ruling out the formats that a
+// backup would have if it were not encrypted.
+func Detect(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte(ageMagic)):
+		return Age
+	case len(header) > 0 && isPGPEncrypted(header[0]):
+		return PGP
+	default:
+		return ""
+	}
+}
+
+// isPGPEncrypted whether b is the tag of the first packet of an encrypted OpenPGP message,
+// which is a public-key or symmetric-key encrypted session key, in the old or new format
+func isPGPEncrypted(b byte) bool {
+	if b&0x80 == 0 {
+		return false
+	}
+	var tag byte
+	if b&0x40 != 0 {
+		tag = b & 0x3f
+	} else {
+		tag = (b >> 2) & 0x0f
+	}
+	return tag == 1 || tag == 3
+}
@@ -0,0 +1,120 @@
+package encrypt
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// testKeys generate a public and private key of the given type
+func testKeys(t *testing.T, name string) (public, private []byte) {
+	t.Helper()
+	switch name {
+	case Age:
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte("# backups\n" + identity.Recipient().String() + "\n"), []byte(identity.String() + "\n")
+	case PGP:
+		entity, err := openpgp.NewEntity("backup", "", "backup@example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pub, priv bytes.Buffer
+		w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := entity.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := entity.SerializePrivate(&priv, nil); err != nil {
+			t.Fatal(err)
+		}
+		return pub.Bytes(), priv.Bytes()
+	}
+	t.Fatalf("unknown type %s", name)
+	return nil, nil
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	data := strings.Repeat("INSERT INTO `t` VALUES (1,'abc');\n", 1000)
+	for _, name := range []string{Age, PGP} {
+		t.Run(name, func(t *testing.T) {
+			public, private := testKeys(t, name)
+			e, err := GetEncryptor(name, public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			w, err := e.Encrypt(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(buf.Bytes(), []byte("INSERT")) {
+				t.Errorf("encrypted data contains plaintext")
+			}
+			if detected := Detect(buf.Bytes()); detected != name {
+				t.Errorf("detected %q", detected)
+			}
+
+			// the type of the key is detected when not given
+			d, err := GetDecryptor("", private)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := d.Decrypt(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != data {
+				t.Errorf("mismatched data after round trip")
+			}
+
+			// a public key cannot decrypt
+			if _, err := GetDecryptor(name, public); err == nil {
+				t.Errorf("expected error decrypting with public key")
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		expected string
+	}{
+		{"age", []byte(ageMagic + "-> X25519 abc\n"), Age},
+		{"pgp new format", []byte{0xc1, 0x0c}, PGP},
+		{"pgp old format", []byte{0x85, 0x01}, PGP},
+		{"pgp symmetric", []byte{0xc3, 0x0d}, PGP},
+		{"pgp signature", []byte{0xc2, 0x0d}, ""},
+		{"gzip", []byte{0x1f, 0x8b, 0x08}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		if detected := Detect(tt.header); detected != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, detected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+type PGPEncryptor struct {
+	keys openpgp.EntityList
+}
+
+// NewPGPEncryptor create an encryptor to the public keys in key
+func NewPGPEncryptor(key []byte) (*PGPEncryptor, error) {
+	keys, err := readKeyRing(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP public keys: %w", err)
+	}
+	return &PGPEncryptor{keys: keys}, nil
+}
+
+func (p *PGPEncryptor) Encrypt(out io.Writer) (io.WriteCloser, error) {
+	return openpgp.Encrypt(out, p.keys, nil, &openpgp.FileHints{IsBinary: true}, nil)
+}
+func (p *PGPEncryptor) Extension() string {
+	return "gpg"
+}
+func (p *PGPEncryptor) Type() string {
+	return PGP
+}
+func (p *PGPEncryptor) Recipients() []string {
+	recipients := make([]string, 0, len(p.keys))
+	for _, k := range p.keys {
+		recipients = append(recipients, fmt.Sprintf("%X", k.PrimaryKey.Fingerprint))
+	}
+	return recipients
+}
+
+type PGPDecryptor struct {
+	keys openpgp.EntityList
+}
+
+// NewPGPDecryptor create a decryptor with the private keys in key
+func NewPGPDecryptor(key []byte) (*PGPDecryptor, error) {
+	keys, err := readKeyRing(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP private keys: %w", err)
+	}
+	if len(keys.DecryptionKeys()) == 0 {
+		return nil, errors.New("no OpenPGP private keys that can decrypt")
+	}
+	for _, k := range keys.DecryptionKeys() {
+		if k.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("OpenPGP private key %s is protected by a passphrase", k.PrivateKey.KeyIdString())
+		}
+	}
+	return &PGPDecryptor{keys: keys}, nil
+}
+
+func (p *PGPDecryptor) Decrypt(in io.Reader) (io.Reader, error) {
+	md, err := openpgp.ReadMessage(in, p.keys, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !md.IsEncrypted {
+		return nil, errors.New("OpenPGP message is not encrypted")
+	}
+	return md.UnverifiedBody, nil
+}
+
+// readKeyRing read the keys in key, whether armored or binary
+func readKeyRing(key []byte) (openpgp.EntityList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(key))
+}
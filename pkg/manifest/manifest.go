@@ -0,0 +1,205 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Filename the name of the manifest in the backup archive
+	Filename = "manifest.json"
+	// ManifestVersion the version of the format of the manifest
+	ManifestVersion = "manifest.databack.io/v1"
+)
+
+// Manifest describes a backup: what produced it, from where, and what it contains. It is
+// written to the backup archive alongside the dump files.
+type Manifest struct {
+	Version     string    `json:"version"`
+	ToolVersion string    `json:"tool-version"`
+	Server      Server    `json:"server"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Options     Options   `json:"options"`
+	// Compression the compression of the archive
+	Compression string `json:"compression"`
+	// Encryption the encryption of the archive, if any
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// Binlog the position in the binary log of the server to which the backup corresponds, if known
+	Binlog  *BinlogPosition `json:"binlog,omitempty"`
+	Schemas []Schema        `json:"schemas"`
+	Files   []File          `json:"files"`
+	// Preliminary whether this is the manifest written at the start of a streamed backup, before
+	// anything was dumped, so it has neither the end, the tables, the position in the binary log
+	// nor the files of the backup. The complete manifest is the last file of the archive.
+	Preliminary bool `json:"preliminary,omitempty"`
+
+	mu sync.Mutex
+}
+
+type Server struct {
+	Host    string `json:"host"`
+	Version string `json:"version"`
+}
+
+// Options the options with which the dump was made
+type Options struct {
+	Compact             bool `json:"compact,omitempty"`
+	SuppressUseDatabase bool `json:"suppress-use-database,omitempty"`
+	MaxAllowedPacket    int  `json:"max-allowed-packet,omitempty"`
+	Triggers            bool `json:"triggers"`
+	Routines            bool `json:"routines"`
+	Events              bool `json:"events"`
+	Parallelism         int  `json:"parallelism"`
+	Streaming           bool `json:"streaming"`
+	NoData              bool `json:"no-data,omitempty"`
+	NoCreateInfo        bool `json:"no-create-info,omitempty"`
+	SourceData          int  `json:"source-data,omitempty"`
+}
+
+type Encryption struct {
+	Type       string   `json:"type"`
+	Recipients []string `json:"recipients"`
+}
+
+type BinlogPosition struct {
+	File     string `json:"file"`
+	Position uint64 `json:"position"`
+	GTID     string `json:"gtid,omitempty"`
+	// Consistent whether the position is exactly that of the backup, as it was taken from a
+	// snapshot; otherwise, it is the position as the backup began, and anything written during
+	// the backup may or may not be in it
+	Consistent bool `json:"consistent"`
+}
+
+type Schema struct {
+	Name   string  `json:"name"`
+	Tables []Table `json:"tables"`
+}
+
+type Table struct {
+	Name  string `json:"name"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+	// NoData whether only the structure of the table was dumped, without its rows
+	NoData bool `json:"no-data,omitempty"`
+	// Where and Limit the filter of the rows dumped, if only some of them were
+	Where string `json:"where,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+	// Masked the columns of which the values were masked
+	Masked []string `json:"masked,omitempty"`
+}
+
+// Partial whether the rows of any table were filtered or left out, so the backup does not have all of its data
+func (m *Manifest) Partial() bool {
+	for _, s := range m.Schemas {
+		for _, t := range s.Tables {
+			if t.NoData || t.Where != "" || t.Limit > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// File a file in the archive, before compression
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// New create a manifest for a backup started at start
+func New(start time.Time) *Manifest {
+	return &Manifest{
+		Version:     ManifestVersion,
+		ToolVersion: ToolVersion(),
+		Start:       start.UTC(),
+	}
+}
+
+// ToolVersion the version of this tool, from the information built into the binary
+func ToolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return ""
+}
+
+// TrackFiles wraps create, which creates each file of the backup, so that the size and
+// SHA-256 of each file are added to the manifest as it is closed. Files may be written
+// concurrently.
+func (m *Manifest) TrackFiles(create func(name string) (io.WriteCloser, error)) func(name string) (io.WriteCloser, error) {
+	return func(name string) (io.WriteCloser, error) {
+		w, err := create(name)
+		if err != nil {
+			return nil, err
+		}
+		return &trackedFile{WriteCloser: w, m: m, name: name, hash: sha256.New()}, nil
+	}
+}
+
+func (m *Manifest) addFile(f File) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files = append(m.Files, f)
+}
+
+// Write writes the manifest as JSON to w, with its files in order of name
+func (m *Manifest) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// Read reads a manifest written by Write
+func Read(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("unknown manifest version: %s", m.Version)
+	}
+	return &m, nil
+}
+
+// trackedFile a file of the backup whose size and hash are being tracked
+type trackedFile struct {
+	io.WriteCloser
+	m      *Manifest
+	name   string
+	hash   hash.Hash
+	size   int64
+	closed bool
+}
+
+func (t *trackedFile) Write(p []byte) (int, error) {
+	n, err := t.WriteCloser.Write(p)
+	t.hash.Write(p[:n])
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *trackedFile) Close() error {
+	if err := t.WriteCloser.Close(); err != nil {
+		return err
+	}
+	// files may be closed more than once, but only are complete the first time
+	if !t.closed {
+		t.closed = true
+		t.m.addFile(File{Name: t.name, Size: t.size, SHA256: hex.EncodeToString(t.hash.Sum(nil))})
+	}
+	return nil
+}
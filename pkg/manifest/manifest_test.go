@@ -0,0 +1,105 @@
+package manifest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestTrackFiles(t *testing.T) {
+	m := New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	create := m.TrackFiles(func(name string) (io.WriteCloser, error) {
+		return nopCloser{io.Discard}, nil
+	})
+	for _, f := range []struct {
+		name string
+		data string
+	}{
+		{"b.sql", "abc"},
+		{"a.sql", ""},
+	} {
+		w, err := create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, f.data); err != nil {
+			t.Fatal(err)
+		}
+		// closing twice records the file once
+		for i := 0; i < 2; i++ {
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []File{
+		{Name: "a.sql", Size: 0, SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{Name: "b.sql", Size: 3, SHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+	if diff := deep.Equal(read.Files, expected); diff != nil {
+		t.Errorf("mismatched files: %v", diff)
+	}
+	if !read.Start.Equal(m.Start) {
+		t.Errorf("mismatched start %v", read.Start)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{"valid", `{"version": "` + ManifestVersion + `", "schemas": [{"name": "a", "tables": [{"name": "t", "rows": 2, "bytes": 100}]}]}`, false},
+		{"unknown version", `{"version": "manifest.databack.io/v99"}`, true},
+		{"invalid", `{"version":`, true},
+	}
+	for _, tt := range tests {
+		m, err := Read(strings.NewReader(tt.input))
+		if (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+			continue
+		}
+		if err == nil && m.Schemas[0].Tables[0].Rows != 2 {
+			t.Errorf("%s: mismatched schemas %v", tt.name, m.Schemas)
+		}
+	}
+}
+
+func TestPartial(t *testing.T) {
+	tests := []struct {
+		name     string
+		tables   []Table
+		expected bool
+	}{
+		{"all rows", []Table{{Name: "t", Rows: 2}}, false},
+		{"where", []Table{{Name: "t", Rows: 2}, {Name: "u", Rows: 1, Where: "id > 1"}}, true},
+		{"limit", []Table{{Name: "t", Rows: 10, Limit: 10}}, true},
+		{"no data", []Table{{Name: "t", NoData: true}}, true},
+	}
+	for _, tt := range tests {
+		m := &Manifest{Schemas: []Schema{{Name: "a", Tables: tt.tables}}}
+		if got := m.Partial(); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
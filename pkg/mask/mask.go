@@ -0,0 +1,254 @@
+// Package mask masks the values of columns as they are dumped, so that a backup never
+// contains the real values of personal or otherwise sensitive data.
+//
+// Masks that derive their value from the original, such as hash, email, name and digits,
+// are deterministic for a given salt: the same value always is masked the same way, so
+// values that are equal, such as those of keys that join tables, still are equal once masked.
+package mask
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Null replaces the value with NULL
+	Null = "null"
+	// Fixed replaces the value with a fixed value
+	Fixed = "fixed"
+	// Hash replaces the value with its salted SHA-256 hash, in hex
+	Hash = "hash"
+	// Email replaces the value with a fake email address, at example.com
+	Email = "email"
+	// Name replaces the value with a fake name
+	Name = "name"
+	// Partial replaces all but the first and last characters of the value with `*`
+	Partial = "partial"
+	// Digits replaces each digit of the value with another, keeping everything else, so
+	// that the format of phone numbers, card numbers and the like is preserved
+	Digits = "digits"
+)
+
+// Masker masks the values of a column
+type Masker interface {
+	// Mask returns the masked value, and false if it is NULL
+	Mask(value string) (string, bool)
+}
+
+// Rule how to mask a column
+type Rule struct {
+	// Type of mask, one of Null, Fixed, Hash, Email, Name, Partial, Digits
+	Type string
+	// Value the value of a Fixed mask
+	Value string
+	// KeepStart and KeepEnd the characters of the value kept at its start and end by a Partial mask
+	KeepStart int
+	KeepEnd   int
+	// Length the length to which a Hash is truncated, to fit its column; all of it if 0
+	Length int
+}
+
+// ParseRule parses a rule as given on the command line: the type, followed by its arguments,
+// separated by `:`, i.e. `null`, `fixed:<value>`, `hash`, `hash:<length>`, `email`, `name`,
+// `partial:<keep-start>:<keep-end>` or `digits`
+func ParseRule(s string) (Rule, error) {
+	typ, args, _ := strings.Cut(s, ":")
+	rule := Rule{Type: typ}
+	var err error
+	switch typ {
+	case Fixed:
+		rule.Value = args
+	case Hash:
+		if args != "" {
+			if rule.Length, err = strconv.Atoi(args); err != nil {
+				return rule, fmt.Errorf("invalid length of hash mask %s: %v", s, err)
+			}
+		}
+	case Partial:
+		start, end, ok := strings.Cut(args, ":")
+		if !ok {
+			return rule, fmt.Errorf("invalid partial mask %s, must be partial:<keep-start>:<keep-end>", s)
+		}
+		if rule.KeepStart, err = strconv.Atoi(start); err != nil {
+			return rule, fmt.Errorf("invalid partial mask %s: %v", s, err)
+		}
+		if rule.KeepEnd, err = strconv.Atoi(end); err != nil {
+			return rule, fmt.Errorf("invalid partial mask %s: %v", s, err)
+		}
+	default:
+		if args != "" {
+			return rule, fmt.Errorf("mask %s takes no arguments: %s", typ, s)
+		}
+	}
+	return rule, rule.Validate()
+}
+
+// Validate checks that the rule is one that can be applied
+func (r Rule) Validate() error {
+	switch r.Type {
+	case Null, Fixed, Email, Name, Digits:
+	case Hash:
+		if r.Length < 0 || r.Length > sha256.Size*2 {
+			return fmt.Errorf("invalid length of hash mask %d, must be between 0 and %d", r.Length, sha256.Size*2)
+		}
+	case Partial:
+		if r.KeepStart < 0 || r.KeepEnd < 0 {
+			return fmt.Errorf("invalid partial mask, characters to keep must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown mask type: %s", r.Type)
+	}
+	return nil
+}
+
+// New creates the Masker for the rule, with salt for those masks that derive their value from the original
+func New(rule Rule, salt []byte) (Masker, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	switch rule.Type {
+	case Null:
+		return nullMask{}, nil
+	case Fixed:
+		return fixedMask{value: rule.Value}, nil
+	case Hash:
+		return hashMask{salt: salt, length: rule.Length}, nil
+	case Email:
+		return emailMask{salt: salt}, nil
+	case Name:
+		return nameMask{salt: salt}, nil
+	case Partial:
+		return partialMask{keepStart: rule.KeepStart, keepEnd: rule.KeepEnd}, nil
+	default:
+		return digitsMask{salt: salt}, nil
+	}
+}
+
+// RandomSalt a new random salt, for when none is set
+func RandomSalt() ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return salt, nil
+}
+
+type nullMask struct{}
+
+func (nullMask) Mask(string) (string, bool) {
+	return "", false
+}
+
+type fixedMask struct {
+	value string
+}
+
+func (m fixedMask) Mask(string) (string, bool) {
+	return m.value, true
+}
+
+type hashMask struct {
+	salt   []byte
+	length int
+}
+
+func (m hashMask) Mask(value string) (string, bool) {
+	h := hex.EncodeToString(digest(m.salt, value))
+	if m.length > 0 {
+		h = h[:m.length]
+	}
+	return h, true
+}
+
+type emailMask struct {
+	salt []byte
+}
+
+func (m emailMask) Mask(value string) (string, bool) {
+	d := digest(m.salt, value)
+	first, last := fakeName(d)
+	// the name alone would collide in a column of any size, so the local part carries 64 bits of
+	// the digest, to keep the addresses of a unique column unique
+	return fmt.Sprintf("%s.%s.%s@example.com", strings.ToLower(first), strings.ToLower(last), hex.EncodeToString(d[4:12])), true
+}
+
+type nameMask struct {
+	salt []byte
+}
+
+func (m nameMask) Mask(value string) (string, bool) {
+	first, last := fakeName(digest(m.salt, value))
+	return first + " " + last, true
+}
+
+type partialMask struct {
+	keepStart, keepEnd int
+}
+
+func (m partialMask) Mask(value string) (string, bool) {
+	runes := []rune(value)
+	if len(runes) <= m.keepStart+m.keepEnd {
+		return strings.Repeat("*", len(runes)), true
+	}
+	for i := m.keepStart; i < len(runes)-m.keepEnd; i++ {
+		runes[i] = '*'
+	}
+	return string(runes), true
+}
+
+type digitsMask struct {
+	salt []byte
+}
+
+func (m digitsMask) Mask(value string) (string, bool) {
+	d := digest(m.salt, value)
+	runes := []rune(value)
+	var n int
+	for i, r := range runes {
+		if r < '0' || r > '9' {
+			continue
+		}
+		// each digit takes a byte of the digest, extended with further digests for long values
+		if n > 0 && n%len(d) == 0 {
+			d = digest(m.salt, value+strconv.Itoa(n))
+		}
+		b := d[n%len(d)]
+		n++
+		// keep a leading digit that is not 0 from becoming 0, so the number keeps its length
+		if i == 0 && r != '0' {
+			runes[i] = rune('1' + b%9)
+			continue
+		}
+		runes[i] = rune('0' + b%10)
+	}
+	return string(runes), true
+}
+
+// digest the salted SHA-256 of the value
+func digest(salt []byte, value string) []byte {
+	h := hmac.New(sha256.New, salt)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// fakeName a first and last name, chosen by the digest
+func fakeName(d []byte) (string, string) {
+	return firstNames[binary.BigEndian.Uint16(d[0:2])%uint16(len(firstNames))],
+		lastNames[binary.BigEndian.Uint16(d[2:4])%uint16(len(lastNames))]
+}
+
+var firstNames = []string{
+	"Alex", "Bailey", "Charlie", "Dana", "Eden", "Finley", "Harper", "Jamie", "Jordan", "Kai",
+	"Logan", "Morgan", "Noah", "Olive", "Parker", "Quinn", "Riley", "Sam", "Taylor", "Zoe",
+}
+
+var lastNames = []string{
+	"Anderson", "Brown", "Clarke", "Davies", "Evans", "Foster", "Green", "Harris", "Jones", "King",
+	"Lewis", "Martin", "Nguyen", "Patel", "Roberts", "Smith", "Taylor", "Walker", "White", "Wilson",
+}
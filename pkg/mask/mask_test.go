@@ -0,0 +1,121 @@
+package mask
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected Rule
+		wantErr  bool
+	}{
+		{"null", Rule{Type: Null}, false},
+		{"fixed:redacted: yes", Rule{Type: Fixed, Value: "redacted: yes"}, false},
+		{"fixed", Rule{Type: Fixed}, false},
+		{"hash", Rule{Type: Hash}, false},
+		{"hash:16", Rule{Type: Hash, Length: 16}, false},
+		{"hash:65", Rule{}, true},
+		{"partial:0:4", Rule{Type: Partial, KeepEnd: 4}, false},
+		{"partial:4", Rule{}, true},
+		{"partial:-1:2", Rule{}, true},
+		{"digits", Rule{Type: Digits}, false},
+		{"email:x", Rule{}, true},
+		{"scramble", Rule{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := deep.Equal(rule, tt.expected); diff != nil {
+				t.Errorf("mismatched rule: %v", diff)
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	salt := []byte("salt")
+	tests := []struct {
+		name  string
+		rule  Rule
+		value string
+		// expected the masked value, if it is fixed, else match checks its form
+		expected string
+		match    *regexp.Regexp
+		null     bool
+	}{
+		{"null", Rule{Type: Null}, "secret", "", nil, true},
+		{"fixed", Rule{Type: Fixed, Value: "redacted"}, "secret", "redacted", nil, false},
+		{"hash", Rule{Type: Hash}, "secret", "", regexp.MustCompile(`^[0-9a-f]{64}$`), false},
+		{"hash truncated", Rule{Type: Hash, Length: 12}, "secret", "", regexp.MustCompile(`^[0-9a-f]{12}$`), false},
+		{"email", Rule{Type: Email}, "jane@corp.example", "", regexp.MustCompile(`^[a-z]+\.[a-z]+\.[0-9a-f]{16}@example\.com$`), false},
+		{"name", Rule{Type: Name}, "Jane Citizen", "", regexp.MustCompile(`^[A-Z][a-z]+ [A-Z][a-z]+$`), false},
+		{"partial", Rule{Type: Partial, KeepStart: 1, KeepEnd: 4}, "4111111111111111", "4***********1111", nil, false},
+		{"partial multibyte", Rule{Type: Partial, KeepEnd: 1}, "héllo", "****o", nil, false},
+		{"partial short", Rule{Type: Partial, KeepStart: 2, KeepEnd: 2}, "abc", "***", nil, false},
+		{"digits", Rule{Type: Digits}, "+61 (2) 9876-5432", "", regexp.MustCompile(`^\+\d\d \(\d\) \d{4}-\d{4}$`), false},
+		{"digits long", Rule{Type: Digits}, "12345678901234567890123456789012345678901234567890", "", regexp.MustCompile(`^[1-9]\d{49}$`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.rule, salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			masked, ok := m.Mask(tt.value)
+			if ok == tt.null {
+				t.Fatalf("expected null %v, got %v", tt.null, !ok)
+			}
+			switch {
+			case tt.match != nil && !tt.match.MatchString(masked):
+				t.Errorf("masked value %q does not match %s", masked, tt.match)
+			case tt.match == nil && masked != tt.expected:
+				t.Errorf("expected %q, got %q", tt.expected, masked)
+			}
+			if tt.match != nil && masked == tt.value {
+				t.Errorf("value was not masked: %q", masked)
+			}
+			// the same value and salt always mask the same way
+			if again, _ := m.Mask(tt.value); again != masked {
+				t.Errorf("masked differently: %q and %q", masked, again)
+			}
+		})
+	}
+}
+
+func TestMaskEmailUnique(t *testing.T) {
+	m, err := New(Rule{Type: Email}, []byte("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const count = 200000
+	seen := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		value := fmt.Sprintf("user%d@corp.example", i)
+		masked, _ := m.Mask(value)
+		if other, ok := seen[masked]; ok {
+			t.Fatalf("%s and %s both masked to %s", other, value, masked)
+		}
+		seen[masked] = value
+	}
+}
+
+func TestMaskSalt(t *testing.T) {
+	a, _ := New(Rule{Type: Hash}, []byte("a"))
+	b, _ := New(Rule{Type: Hash}, []byte("b"))
+	ma, _ := a.Mask("secret")
+	mb, _ := b.Mask("secret")
+	if ma == mb {
+		t.Errorf("different salts masked the same: %s", ma)
+	}
+}
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"context"
 	"io"
 	"io/fs"
 	"net/url"
@@ -26,6 +27,23 @@ func (f *File) Push(target, source string) (int64, error) {
 	return copyFile(source, filepath.Join(f.path, target))
 }
 
+func (f *File) PushStream(ctx context.Context, target string, r io.Reader) (int64, error) {
+	dst, err := os.Create(filepath.Join(f.path, target))
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+	n, err := io.Copy(dst, r)
+	if err != nil {
+		return n, err
+	}
+	return n, dst.Close()
+}
+
+func (f *File) PullStream(ctx context.Context, source string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(f.path, source))
+}
+
 func (f *File) Protocol() string {
 	return "file"
 }
@@ -3,6 +3,7 @@ package s3
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/url"
 	"os"
@@ -124,6 +125,50 @@ func (s *S3) Push(target, source string) (int64, error) {
 	return 0, nil
 }
 
+// PushStream uploads from r as it is read. The uploader sends it as a multipart upload,
+// buffering only a single part at a time, so the size need not be known in advance.
+func (s *S3) PushStream(ctx context.Context, target string, r io.Reader) (int64, error) {
+	// get the s3 client
+	client, err := s.getClient()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get AWS client: %v", err)
+	}
+	bucket, key := s.url.Hostname(), s.url.Path
+
+	uploader := manager.NewUploader(client)
+
+	cr := &countingReader{r: r}
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(path.Join(key, target)),
+		Body:   cr,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload file, %v", err)
+	}
+	return cr.n, nil
+}
+
+// PullStream reads the object directly from the response, rather than through the downloader,
+// which needs to be able to write the parts it retrieves concurrently at any offset.
+func (s *S3) PullStream(ctx context.Context, source string) (io.ReadCloser, error) {
+	// get the s3 client
+	client, err := s.getClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS client: %v", err)
+	}
+	bucket, key := s.url.Hostname(), path.Join(s.url.Path, source)
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file, %v", err)
+	}
+	return out.Body, nil
+}
+
 func (s *S3) Protocol() string {
 	return "s3"
 }
@@ -233,6 +278,18 @@ func getEndpoint(endpoint string) string {
 	return e
 }
 
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 type s3FileInfo struct {
 	name         string
 	lastModified time.Time
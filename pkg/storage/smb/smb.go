@@ -1,6 +1,7 @@
 package smb
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -96,6 +97,41 @@ func (s *SMB) Push(target, source string) (int64, error) {
 	return copied, err
 }
 
+func (s *SMB) PushStream(ctx context.Context, target string, r io.Reader) (int64, error) {
+	var (
+		copied int64
+		err    error
+	)
+	err = s.exec(s.url, func(fs *smb2.Share, sharepath string) error {
+		smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, filepath.Base(strings.ReplaceAll(target, ":", "-")))
+		to, err := fs.WithContext(ctx).Create(smbFilename)
+		if err != nil {
+			return err
+		}
+		defer to.Close()
+		copied, err = io.Copy(to, r)
+		if err != nil {
+			return err
+		}
+		return to.Close()
+	})
+	return copied, err
+}
+
+func (s *SMB) PullStream(ctx context.Context, source string) (io.ReadCloser, error) {
+	fs, sharepath, disconnect, err := s.connect(s.url)
+	if err != nil {
+		return nil, err
+	}
+	smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, filepath.Base(strings.ReplaceAll(source, ":", "-")))
+	f, err := fs.WithContext(ctx).Open(smbFilename)
+	if err != nil {
+		disconnect()
+		return nil, err
+	}
+	return &smbReadCloser{File: f, disconnect: disconnect}, nil
+}
+
 func (s *SMB) Protocol() string {
 	return "smb"
 }
@@ -124,8 +160,18 @@ func (s *SMB) Remove(target string) error {
 }
 
 func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) error) error {
+	fs, sharepath, disconnect, err := s.connect(u)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+	return command(fs, sharepath)
+}
+
+// connect mounts the share, returning a function to unmount it and disconnect
+func (s *SMB) connect(u url.URL) (fs *smb2.Share, sharepath string, disconnect func(), err error) {
 	var (
-		username, password, domain string
+		username, password, domain, share string
 	)
 
 	hostname, port, path := u.Hostname(), u.Port(), u.Path
@@ -133,8 +179,8 @@ func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) err
 	if port == "" {
 		port = defaultSMBPort
 	}
-	host := fmt.Sprintf("%s:%s", hostname, port)
-	share, sharepath := parseSMBPath(path)
+	host := net.JoinHostPort(hostname, port)
+	share, sharepath = parseSMBPath(path)
 	if s.username == "" && u.User != nil {
 		username = u.User.Username()
 		password, _ = u.User.Password()
@@ -144,9 +190,8 @@ func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) err
 
 	conn, err := net.Dial("tcp", host)
 	if err != nil {
-		return err
+		return nil, "", nil, err
 	}
-	defer conn.Close()
 
 	d := &smb2.Dialer{
 		Initiator: &smb2.NTLMInitiator{
@@ -158,20 +203,34 @@ func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) err
 
 	smbConn, err := d.Dial(conn)
 	if err != nil {
-		return err
+		conn.Close()
+		return nil, "", nil, err
 	}
-	defer func() {
-		_ = smbConn.Logoff()
-	}()
 
-	fs, err := smbConn.Mount(share)
+	fs, err = smbConn.Mount(share)
 	if err != nil {
-		return err
+		_ = smbConn.Logoff()
+		conn.Close()
+		return nil, "", nil, err
 	}
-	defer func() {
+	disconnect = func() {
 		_ = fs.Umount()
-	}()
-	return command(fs, sharepath)
+		_ = smbConn.Logoff()
+		conn.Close()
+	}
+	return fs, sharepath, disconnect, nil
+}
+
+// smbReadCloser a file on a share, which disconnects from the share when closed
+type smbReadCloser struct {
+	*smb2.File
+	disconnect func()
+}
+
+func (r *smbReadCloser) Close() error {
+	err := r.File.Close()
+	r.disconnect()
+	return err
 }
 
 // parseSMBDomain parse a username to get an SMB domain
@@ -1,9 +1,17 @@
 package storage
 
-import "io/fs"
+import (
+	"context"
+	"io"
+	"io/fs"
+)
 
 type Storage interface {
 	Push(target, source string) (int64, error)
+	// PushStream write everything from r to target, without needing a local file or knowing the size in advance
+	PushStream(ctx context.Context, target string, r io.Reader) (int64, error)
+	// PullStream open source for reading, without needing a local file; the caller must close it
+	PullStream(ctx context.Context, source string) (io.ReadCloser, error)
 	Pull(source, target string) (int64, error)
 	Protocol() string
 	URL() string
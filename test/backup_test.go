@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
@@ -17,15 +18,19 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/binlog"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/compression"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/core"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/database"
+	dbmysql "github.com/nullsecurity-australia/mariadb-backup/pkg/database/mysql"
+	"github.com/nullsecurity-australia/mariadb-backup/pkg/manifest"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage"
 	"github.com/nullsecurity-australia/mariadb-backup/pkg/storage/credentials"
 	"github.com/docker/docker/api/types"
@@ -314,6 +319,9 @@ func (d *dockerContext) createBackupFile(mysqlCID, mysqlUser, mysqlPass, outfile
 	(3, "Sam", "2012-11-03", "00:17:00", "2012-11-03 00:17:00", "2012-11-03 00:17:00"),
 	(4, "Sarah", "2012-11-04", "00:18:00", "2012-11-04 00:18:00", "2012-11-04 00:18:00");
 	create view view1 as select id, name from t1;
+	create trigger t1_name before insert on t1 for each row set NEW.name = trim(NEW.name);
+	create procedure count_t1() select count(*) from t1;
+	create event purge_t1 on schedule every 1 day disable do delete from t1 where id < 0;
 	`}
 	attachResp, exitCode, err := d.execInContainer(ctx, mysqlCID, mysqlCreateCmd)
 	if err != nil {
@@ -327,7 +335,7 @@ func (d *dockerContext) createBackupFile(mysqlCID, mysqlUser, mysqlPass, outfile
 	_, _ = stdcopy.StdCopy(&bufo, &bufe, attachResp.Reader)
 
 	// Dump the database - do both compact and non-compact
-	mysqlDumpCompactCmd := []string{"mysqldump", "-hlocalhost", "--protocol=tcp", "--complete-insert", fmt.Sprintf("-u%s", mysqlUser), fmt.Sprintf("-p%s", mysqlPass), "--compact", "--databases", "tester"}
+	mysqlDumpCompactCmd := []string{"mysqldump", "-hlocalhost", "--protocol=tcp", "--complete-insert", "--skip-triggers", "--set-gtid-purged=OFF", fmt.Sprintf("-u%s", mysqlUser), fmt.Sprintf("-p%s", mysqlPass), "--compact", "--databases", "tester"}
 	attachResp, exitCode, err = d.execInContainer(ctx, mysqlCID, mysqlDumpCompactCmd)
 	if err != nil {
 		return fmt.Errorf("failed to attach to exec: %w", err)
@@ -348,7 +356,7 @@ func (d *dockerContext) createBackupFile(mysqlCID, mysqlUser, mysqlPass, outfile
 	bufo.Reset()
 	bufe.Reset()
 
-	mysqlDumpCmd := []string{"mysqldump", "-hlocalhost", "--protocol=tcp", "--complete-insert", fmt.Sprintf("-u%s", mysqlUser), fmt.Sprintf("-p%s", mysqlPass), "--databases", "tester"}
+	mysqlDumpCmd := []string{"mysqldump", "-hlocalhost", "--protocol=tcp", "--complete-insert", "--skip-triggers", "--set-gtid-purged=OFF", fmt.Sprintf("-u%s", mysqlUser), fmt.Sprintf("-p%s", mysqlPass), "--databases", "tester"}
 	attachResp, exitCode, err = d.execInContainer(ctx, mysqlCID, mysqlDumpCmd)
 	if err != nil {
 		return fmt.Errorf("failed to attach to exec: %w", err)
@@ -490,6 +498,11 @@ slow_query_log  =1
 slow_query_log_file=/var/log/mysql/mysql_slow.log
 long_query_time =2
 log_queries_not_using_indexes = 1
+# the test user creates triggers without SUPER
+log_bin_trust_function_creators = 1
+# so transactions can be replayed up to a GTID
+gtid_mode                = ON
+enforce_gtid_consistency = ON
 `
 	confFile := filepath.Join(base, "log.cnf")
 	if err := os.WriteFile(confFile, []byte(mysqlConf), 0644); err != nil {
@@ -713,8 +726,8 @@ func checkDumpTest(t *testing.T, base string, expected []byte, s3backend gofakes
 }
 
 // gunzipUntarScanFilter is a helper function to extract the actual data from a backup
-// It unzips, untars getting the first file, and then scans the file for lines we do not
-// care about, returning the remaining content.
+// It unzips, untars getting the first file after the manifest, and then scans the file for
+// lines we do not care about, returning the remaining content.
 func gunzipUntarScanFilter(r io.Reader) (b []byte, err error) {
 	gr, err := gzip.NewReader(r)
 	if err != nil {
@@ -722,8 +735,14 @@ func gunzipUntarScanFilter(r io.Reader) (b []byte, err error) {
 	}
 	defer gr.Close()
 	tr := tar.NewReader(gr)
-	if _, err := tr.Next(); err != nil {
-		return nil, err
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if header.Name != manifest.Filename {
+			break
+		}
 	}
 	return filterLines(tr), nil
 }
@@ -872,5 +891,390 @@ func TestIntegration(t *testing.T) {
 			}, base, true, backupData, mysql, smb, s3, s3backend, checkDumpTest)
 		})
 
+		// dump and restore the triggers, routines and events
+		t.Run("stored objects", func(t *testing.T) {
+			runStoredObjectsTest(t, base, mysql)
+		})
+
+		// dump tables concurrently, and restore them
+		t.Run("parallel", func(t *testing.T) {
+			runParallelTest(t, base, mysql)
+		})
+
+		// archive the binary log
+		t.Run("binlog", func(t *testing.T) {
+			runBinlogTest(t, base, mysql)
+		})
+
 	})
 }
+
+// runStoredObjectsTest dumps the database with its triggers, routines and events, drops them, and
+// checks that restoring the dump recreates them
+func runStoredObjectsTest(t *testing.T, base string, mysql containerPort) {
+	dbconn := database.Connection{
+		User: mysqlUser,
+		Pass: mysqlPass,
+		Host: "localhost",
+		Port: mysql.port,
+	}
+	root, err := sql.Open("mysql", database.Connection{User: mysqlRootUser, Pass: mysqlRootPass, Host: "localhost", Port: mysql.port}.MySQL())
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer root.Close()
+	storedObjects := func() []string {
+		t.Helper()
+		rows, err := root.Query(`SELECT CONCAT('trigger ', TRIGGER_NAME, ' ', ACTION_STATEMENT) FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = 'tester'
+			UNION ALL SELECT CONCAT(LOWER(ROUTINE_TYPE), ' ', ROUTINE_NAME, ' ', ROUTINE_DEFINITION) FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = 'tester'
+			UNION ALL SELECT CONCAT('event ', EVENT_NAME, ' ', EVENT_DEFINITION, ' ', STATUS) FROM information_schema.EVENTS WHERE EVENT_SCHEMA = 'tester'`)
+		if err != nil {
+			t.Fatalf("failed to list stored objects: %v", err)
+		}
+		defer rows.Close()
+		var objects []string
+		for rows.Next() {
+			var object string
+			if err := rows.Scan(&object); err != nil {
+				t.Fatalf("failed to list stored objects: %v", err)
+			}
+			objects = append(objects, object)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("failed to list stored objects: %v", err)
+		}
+		sort.Strings(objects)
+		return objects
+	}
+	expected := storedObjects()
+	if len(expected) != 3 {
+		t.Fatalf("expected a trigger, a procedure and an event in the database, found %v", expected)
+	}
+
+	localPath := filepath.Join(base, "stored-objects")
+	if err := os.MkdirAll(localPath, 0o755); err != nil {
+		t.Fatalf("failed to create local path %s: %v", localPath, err)
+	}
+	store, err := storage.ParseURL("file://"+localPath, credentials.Creds{})
+	if err != nil {
+		t.Fatalf("invalid target url: %v", err)
+	}
+	if err := core.Dump(core.DumpOptions{
+		Targets:    []storage.Storage{store},
+		DBNames:    []string{"tester"},
+		DBConn:     dbconn,
+		Compressor: &compression.GzipCompressor{},
+		Triggers:   true,
+		Routines:   true,
+		Events:     true,
+	}); err != nil {
+		t.Fatalf("failed to dump database: %v", err)
+	}
+
+	for _, stmt := range []string{
+		"DROP TRIGGER tester.t1_name",
+		"DROP PROCEDURE tester.count_t1",
+		"DROP EVENT tester.purge_t1",
+	} {
+		if _, err := root.Exec(stmt); err != nil {
+			t.Fatalf("failed to drop stored object: %v", err)
+		}
+	}
+	if objects := storedObjects(); len(objects) != 0 {
+		t.Fatalf("stored objects left after dropping them: %v", objects)
+	}
+
+	if err := core.Restore(core.RestoreOptions{
+		Target:     store,
+		TargetFile: core.LatestBackup,
+		DBConn:     dbconn,
+	}); err != nil {
+		t.Fatalf("failed to restore database: %v", err)
+	}
+	assert.Equal(t, expected, storedObjects(), "stored objects not restored")
+}
+
+// runParallelTest dumps several tables concurrently, on the connections of a snapshot, changes
+// them, and checks that restoring the dump, also concurrently, brings back the rows that were dumped
+func runParallelTest(t *testing.T, base string, mysql containerPort) {
+	// the snapshot locks the tables while its transactions start, which needs the RELOAD privilege
+	rootconn := database.Connection{User: mysqlRootUser, Pass: mysqlRootPass, Host: "localhost", Port: mysql.port}
+	root, err := sql.Open("mysql", rootconn.MySQL())
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer root.Close()
+	tables := []string{"t1", "p1", "p2", "p3", "p4"}
+	for _, table := range tables[1:] {
+		for _, stmt := range []string{
+			fmt.Sprintf("CREATE TABLE tester.%s LIKE tester.t1", table),
+			fmt.Sprintf("INSERT INTO tester.%s SELECT * FROM tester.t1", table),
+		} {
+			if _, err := root.Exec(stmt); err != nil {
+				t.Fatalf("failed to create table %s: %v", table, err)
+			}
+		}
+	}
+	defer func() {
+		for _, table := range tables[1:] {
+			if _, err := root.Exec(fmt.Sprintf("DROP TABLE IF EXISTS tester.%s", table)); err != nil {
+				t.Errorf("failed to drop table %s: %v", table, err)
+			}
+		}
+	}()
+	tableRows := func(table string) []string {
+		t.Helper()
+		rows, err := root.Query(fmt.Sprintf("SELECT * FROM tester.%s ORDER BY id", table))
+		if err != nil {
+			t.Fatalf("failed to read table %s: %v", table, err)
+		}
+		defer rows.Close()
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("failed to read table %s: %v", table, err)
+		}
+		var result []string
+		for rows.Next() {
+			values := make([]sql.NullString, len(cols))
+			scans := make([]interface{}, len(cols))
+			for i := range values {
+				scans[i] = &values[i]
+			}
+			if err := rows.Scan(scans...); err != nil {
+				t.Fatalf("failed to read table %s: %v", table, err)
+			}
+			result = append(result, fmt.Sprint(values))
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("failed to read table %s: %v", table, err)
+		}
+		return result
+	}
+	expected := map[string][]string{}
+	for _, table := range tables {
+		expected[table] = tableRows(table)
+	}
+
+	localPath := filepath.Join(base, "parallel")
+	if err := os.MkdirAll(localPath, 0o755); err != nil {
+		t.Fatalf("failed to create local path %s: %v", localPath, err)
+	}
+	store, err := storage.ParseURL("file://"+localPath, credentials.Creds{})
+	if err != nil {
+		t.Fatalf("invalid target url: %v", err)
+	}
+	if err := core.Dump(core.DumpOptions{
+		Targets:     []storage.Storage{store},
+		DBNames:     []string{"tester"},
+		DBConn:      rootconn,
+		Compressor:  &compression.GzipCompressor{},
+		Triggers:    true,
+		Parallelism: 4,
+	}); err != nil {
+		t.Fatalf("failed to dump database: %v", err)
+	}
+
+	// change every table, so that the restore has to bring back what was dumped
+	for _, table := range tables {
+		if _, err := root.Exec(fmt.Sprintf("DELETE FROM tester.%s WHERE id > 2", table)); err != nil {
+			t.Fatalf("failed to change table %s: %v", table, err)
+		}
+		if _, err := root.Exec(fmt.Sprintf("INSERT INTO tester.%s (id, name) VALUES (99, 'changed')", table)); err != nil {
+			t.Fatalf("failed to change table %s: %v", table, err)
+		}
+	}
+
+	if err := core.Restore(core.RestoreOptions{
+		Target:      store,
+		TargetFile:  core.LatestBackup,
+		DBConn:      rootconn,
+		Parallelism: 4,
+	}); err != nil {
+		t.Fatalf("failed to restore database: %v", err)
+	}
+	for _, table := range tables {
+		assert.Equal(t, expected[table], tableRows(table), "rows of table %s not restored", table)
+	}
+}
+
+// runBinlogTest archives the binary log of the changes to the database, twice, and checks that
+// the second run resumes where the first ended. It then dumps the database with its position in
+// the binary log, archives the changes made after it, and checks that a point-in-time restore
+// replays exactly those up to the time or GTID given.
+func runBinlogTest(t *testing.T, base string, mysql containerPort) {
+	ctx := context.Background()
+	dbconn := database.Connection{
+		User: mysqlUser,
+		Pass: mysqlPass,
+		Host: "localhost",
+		Port: mysql.port,
+	}
+	// dumping with the position in the binary log, and replaying it, need privileges of their own
+	rootconn := database.Connection{User: mysqlRootUser, Pass: mysqlRootPass, Host: "localhost", Port: mysql.port}
+	root, err := sql.Open("mysql", rootconn.MySQL())
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer root.Close()
+	if _, err := root.Exec("GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO user"); err != nil {
+		t.Fatalf("failed to grant replication privileges: %v", err)
+	}
+	pos, err := dbmysql.QueryBinlogPosition(ctx, root)
+	if err != nil || pos == nil {
+		t.Fatalf("failed to get position in binary log: %v", err)
+	}
+	insert := func(id int) {
+		t.Helper()
+		if _, err := root.Exec("INSERT INTO tester.t1 (id, name) VALUES (?, ?)", id, fmt.Sprintf("binlog%d", id)); err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	localPath := filepath.Join(base, "binlogs")
+	if err := os.MkdirAll(localPath, 0o755); err != nil {
+		t.Fatalf("failed to create local path %s: %v", localPath, err)
+	}
+	store, err := storage.ParseURL("file://"+localPath, credentials.Creds{})
+	if err != nil {
+		t.Fatalf("invalid target url: %v", err)
+	}
+	opts := core.BinlogOptions{
+		Targets:    []storage.Storage{store},
+		DBConn:     dbconn,
+		Compressor: &compression.GzipCompressor{},
+		ServerID:   12345,
+		Start:      binlog.Position{File: pos.File, Pos: pos.Position},
+		Once:       true,
+	}
+	insert(101)
+	insert(102)
+	if err := core.Binlog(ctx, opts); err != nil {
+		t.Fatalf("failed to archive binary log: %v", err)
+	}
+	// resumes from the end of the last segment
+	insert(103)
+	opts.Start = binlog.Position{}
+	if err := core.Binlog(ctx, opts); err != nil {
+		t.Fatalf("failed to archive binary log: %v", err)
+	}
+
+	files, err := os.ReadDir(localPath)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	var segments []binlog.Segment
+	for _, f := range files {
+		seg, ok := binlog.ParseSegmentName(f.Name())
+		if !ok {
+			t.Errorf("unexpected file %s", f.Name())
+			continue
+		}
+		segments = append(segments, seg)
+		// each is a binary log file of its own, that has the rows inserted
+		r, err := os.Open(filepath.Join(localPath, f.Name()))
+		if err != nil {
+			t.Fatalf("failed to open segment: %v", err)
+		}
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("failed to uncompress segment: %v", err)
+		}
+		tr := tar.NewReader(gr)
+		if _, err := tr.Next(); err != nil {
+			t.Fatalf("failed to read segment archive: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		r.Close()
+		if err != nil {
+			t.Fatalf("failed to read segment: %v", err)
+		}
+		assert.True(t, bytes.HasPrefix(data, binlog.Magic), "segment %s is not a binary log file", f.Name())
+	}
+	if len(segments) != 2 {
+		t.Fatalf("%d segments, expected 2: %v", len(segments), segments)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Before(segments[j]) })
+	assert.Equal(t, pos.File, segments[0].File)
+	assert.Equal(t, pos.Position, segments[0].Start)
+	assert.Equal(t, segments[0].End, segments[1].Start, "second segment does not start where the first ends")
+
+	// a backup, to the same target, from which the changes after it are replayed
+	if err := core.Dump(core.DumpOptions{
+		Targets:    []storage.Storage{store},
+		DBNames:    []string{"tester"},
+		DBConn:     rootconn,
+		Compressor: &compression.GzipCompressor{},
+		SourceData: dbmysql.SourceDataComment,
+	}); err != nil {
+		t.Fatalf("failed to dump database: %v", err)
+	}
+	gtidExecuted := func() string {
+		t.Helper()
+		var gtids string
+		if err := root.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&gtids); err != nil {
+			t.Fatalf("failed to get executed GTIDs: %v", err)
+		}
+		return gtids
+	}
+	// each insert is a transaction of its own, started in a later second than the one before
+	insert(104)
+	time.Sleep(time.Second)
+	until := time.Now()
+	time.Sleep(time.Second)
+	before := gtidExecuted()
+	insert(105)
+	var gtid string
+	if err := root.QueryRow("SELECT GTID_SUBTRACT(@@GLOBAL.gtid_executed, ?)", before).Scan(&gtid); err != nil {
+		t.Fatalf("failed to get GTID of insert: %v", err)
+	}
+	insert(106)
+	if err := core.Binlog(ctx, opts); err != nil {
+		t.Fatalf("failed to archive binary log: %v", err)
+	}
+
+	ids := func() []int {
+		t.Helper()
+		rows, err := root.Query("SELECT id FROM tester.t1 ORDER BY id")
+		if err != nil {
+			t.Fatalf("failed to list rows: %v", err)
+		}
+		defer rows.Close()
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("failed to list rows: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("failed to list rows: %v", err)
+		}
+		return ids
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 101, 102, 103, 104, 105, 106}, ids())
+
+	tests := []struct {
+		name      string
+		until     time.Time
+		untilGTID string
+		expected  []int
+	}{
+		{"until", until, "", []int{1, 2, 3, 4, 101, 102, 103, 104}},
+		{"until gtid", time.Time{}, gtid, []int{1, 2, 3, 4, 101, 102, 103, 104, 105}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := core.Restore(core.RestoreOptions{
+				Target:     store,
+				TargetFile: core.LatestBackup,
+				DBConn:     rootconn,
+				Until:      tt.until,
+				UntilGTID:  tt.untilGTID,
+			}); err != nil {
+				t.Fatalf("failed to restore database: %v", err)
+			}
+			assert.Equal(t, tt.expected, ids())
+		})
+	}
+}